@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Kirides/simpleApi/models"
+	"github.com/Kirides/simpleApi/services"
+	"github.com/Kirides/simpleApi/stores"
+	"github.com/Kirides/simpleApi/stores/migrations"
+)
+
+// runCommand runs the command named by the first argument instead of starting the server.
+// An interrupt cancels the command.
+func runCommand(args []string, policy *services.PasswordPolicy, hasher services.PasswordHasher) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	switch args[0] {
+	case "import":
+		return runImport(ctx, args[1:], policy, hasher)
+	case "export":
+		return runExport(ctx, args[1:])
+	}
+	return fmt.Errorf("Unknown command '%s', expected 'import', 'export' or 'migrate'", args[0])
+}
+
+// runImport imports users from a file, or stdin if the file is '-'
+func runImport(ctx context.Context, args []string, policy *services.PasswordPolicy, hasher services.PasswordHasher) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	format := fs.String("format", "", "format of the file (csv, jsonl), by default taken from the file extension")
+	dryRun := fs.Bool("dry-run", false, "only validate the users without importing them")
+	batchSize := fs.Int("batch-size", 500, "amount of users inserted per transaction")
+	report := fs.String("report", "", "file the errors are written to as CSV")
+	org := fs.String("org", "", "organization all users are assigned to, by default the org column is used")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: simpleApi [flags] import [import flags] FILE")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("Expected exactly one file")
+	}
+	path := fs.Arg(0)
+	if *format == "" {
+		*format = formatFromExtension(path)
+	}
+	if !services.ValidUserFormat(*format) {
+		return fmt.Errorf("Unknown format '%s'", *format)
+	}
+
+	var in io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	importer := services.NewUserImporter(userStore)
+	importer.PasswordPolicy = policy
+	importer.PasswordHasher = hasher
+	importer.BatchSize = *batchSize
+	importer.Orgs = orgStore
+	if *org != "" {
+		if _, err := orgStore.GetOrg(ctx, *org); err != nil {
+			return fmt.Errorf("Could not find organization '%s'. Error: %v", *org, err)
+		}
+		importer.OrgID = *org
+	}
+	result, importErr := importer.Import(ctx, in, *format, *dryRun)
+
+	for _, e := range result.Errors {
+		log.Printf("line %d (%s): %s", e.Line, e.Username, e.Error)
+	}
+	if *report != "" {
+		if err := writeImportReport(*report, result); err != nil {
+			return fmt.Errorf("Could not write report. Error: %v", err)
+		}
+	}
+	verb := "imported"
+	if *dryRun {
+		verb = "would import"
+	}
+	log.Printf("read %d users, %s %d, %d failed", result.Total, verb, result.Imported, result.Failed)
+	return importErr
+}
+
+func writeImportReport(path string, result services.UserImportResult) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := result.WriteErrorReport(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// runExport exports users into a file, or stdout if no file is specified
+func runExport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("format", "", "format of the file (csv, jsonl), by default taken from the file extension")
+	out := fs.String("o", "-", "file the users are written to, '-' for stdout")
+	status := fs.String("status", models.StatusActive+","+models.StatusDisabled, "comma separated statuses of the exported users, 'all' for every user")
+	withHashes := fs.Bool("with-password-hashes", false, "include password hashes, so the users can be imported into another instance")
+	org := fs.String("org", "", "only export the users of the organization")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: simpleApi [flags] export [export flags]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *format == "" {
+		*format = formatFromExtension(*out)
+	}
+	if !services.ValidUserFormat(*format) {
+		return fmt.Errorf("Unknown format '%s'", *format)
+	}
+	q := stores.UserQuery{OrgID: *org}
+	if *status != "all" {
+		q.Statuses = strings.Split(*status, ",")
+	}
+
+	var w io.Writer = os.Stdout
+	var f *os.File
+	if *out != "-" {
+		var err error
+		if f, err = os.Create(*out); err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	exporter := services.NewUserExporter(userStore)
+	exporter.IncludePasswordHashes = *withHashes
+	n, err := exporter.Export(ctx, w, *format, q)
+	if err != nil {
+		return err
+	}
+	if f != nil {
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	log.Printf("exported %d users", n)
+	return nil
+}
+
+// formatFromExtension returns the format for files ending in .csv, and jsonl for all other files
+func formatFromExtension(path string) string {
+	if strings.HasSuffix(strings.ToLower(path), ".csv") {
+		return services.FormatCSV
+	}
+	return services.FormatJSONL
+}
+
+// migrate applies pending migrations if -auto-migrate is set, otherwise it fails if migrations are pending
+func migrate(ctx context.Context, m *migrations.Migrator) error {
+	if !*autoMigrate {
+		pending, err := m.Pending(ctx)
+		if err != nil {
+			return fmt.Errorf("Could not check schema. Error: %v", err)
+		}
+		if pending > 0 {
+			return fmt.Errorf("The database has %d pending migrations, run 'migrate up' or start with -auto-migrate", pending)
+		}
+		return nil
+	}
+	n, err := m.Up(ctx)
+	if err != nil {
+		return fmt.Errorf("Could not migrate database. Error: %v", err)
+	}
+	if n > 0 {
+		log.Printf("applied %d migrations", n)
+	}
+	return nil
+}
+
+// runMigrate shows, applies or reverts schema migrations
+func runMigrate(args []string, m *migrations.Migrator) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	steps := fs.Int("steps", 1, "amount of migrations reverted by down")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: simpleApi [flags] migrate [migrate flags] status|up|down")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("Expected exactly one of status, up or down")
+	}
+	switch fs.Arg(0) {
+	case "status":
+		status, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		return writeMigrationStatus(os.Stdout, status)
+	case "up":
+		n, err := m.Up(ctx)
+		if err != nil {
+			return err
+		}
+		log.Printf("applied %d migrations", n)
+		return nil
+	case "down":
+		if *steps < 1 {
+			return fmt.Errorf("-steps must be at least 1")
+		}
+		n, err := m.Down(ctx, *steps)
+		if err != nil {
+			return err
+		}
+		log.Printf("reverted %d migrations", n)
+		return nil
+	}
+	return fmt.Errorf("Unknown migrate command '%s', expected 'status', 'up' or 'down'", fs.Arg(0))
+}
+
+func writeMigrationStatus(w io.Writer, status []migrations.Status) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+	for _, s := range status {
+		state, appliedAt := "pending", ""
+		if s.Applied {
+			state, appliedAt = "applied", s.AppliedAt.Format(time.RFC3339)
+		}
+		switch {
+		case s.Modified:
+			state = "modified"
+		case s.Unknown:
+			state = "unknown"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", s.Version, s.Name, state, appliedAt)
+	}
+	return tw.Flush()
+}
@@ -2,14 +2,16 @@ package controllers
 
 import (
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
-	"regexp"
 
+	"github.com/Kirides/simpleApi/dtos"
 	"github.com/Kirides/simpleApi/models"
+	"github.com/Kirides/simpleApi/services"
 	"github.com/Kirides/simpleApi/stores"
 
 	"github.com/gorilla/mux"
-	"golang.org/x/crypto/bcrypt"
 )
 
 const authCookie = "auth"
@@ -27,51 +29,86 @@ type userRegister struct {
 
 // AccountController ...
 type AccountController struct {
-	userStore  stores.UserStore
-	rxUsername *regexp.Regexp
-	rxEmail    *regexp.Regexp
+	userStore stores.UserStore
+	// RegistrationEnabled allows everybody to create an account, otherwise an invitation is required
+	RegistrationEnabled bool
+	PasswordPolicy      *services.PasswordPolicy
+	PasswordHasher      services.PasswordHasher
+	// Audit records registrations, if set
+	Audit *services.AuditLog
 }
 
 // NewAccountController ...
 func NewAccountController(us stores.UserStore) *AccountController {
 	return &AccountController{
-		userStore:  us,
-		rxUsername: regexp.MustCompile("^[A-Za-z0-9]+(?:[_-][A-Za-z0-9]+)*$"),
-		rxEmail:    regexp.MustCompile(`^(?:(?:[^<>()[\]\\.,;:\s@"]+(?:\.[^<>()[\]\\.,;:\s@"]+)*)|(?:".+"))@(?:(?:\[[0-9]{1,3}\.[0-9]{1,3}\.[0-9]{1,3}\.[0-9]{1,3}])|(?:(?:[a-zA-Z\-0-9]+\.)+[a-zA-Z]{2,}))$`),
+		userStore:           us,
+		RegistrationEnabled: true,
+		PasswordPolicy:      services.NewPasswordPolicy(),
+		PasswordHasher:      services.DefaultPasswordHasher(),
 	}
 }
 
 // HandeAccountAPI ...
 func (ac *AccountController) HandeAccountAPI(r *mux.Router) {
 	r.Path("/register").Methods(http.MethodPost).HandlerFunc(ac.handleRegister)
+	r.Path("/password-policy").Methods(http.MethodGet).HandlerFunc(ac.handlePasswordPolicy)
+}
+
+// handlePasswordPolicy returns the password policy, so the frontend does not hard-code it
+func (ac *AccountController) handlePasswordPolicy(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, dtos.PasswordPolicy{
+		MinLength:        ac.PasswordPolicy.MinLength,
+		MaxLength:        ac.PasswordPolicy.MaxLength,
+		DisallowUsername: ac.PasswordPolicy.DisallowUsername,
+	})
 }
 
 func (ac *AccountController) handleRegister(w http.ResponseWriter, r *http.Request) {
+	if !ac.RegistrationEnabled {
+		audit(ac.Audit, r, models.AuditUserRegistered, models.AuditFailure, models.User{}, "registration is disabled")
+		http.Error(w, "Registration is disabled, an invitation is required", http.StatusForbidden)
+		return
+	}
 	registerRequest := userRegister{}
 
 	if err := json.NewDecoder(r.Body).Decode(&registerRequest); err != nil {
 		http.Error(w, "Invalid request", http.StatusBadRequest)
 		return
 	}
-	if !ac.rxUsername.MatchString(registerRequest.Username) {
+	if !services.ValidUsername(registerRequest.Username) {
 		http.Error(w, "Invalid username", http.StatusBadRequest)
 		return
 	}
-	if !ac.rxEmail.MatchString(registerRequest.Email) {
+	if !services.ValidEmail(registerRequest.Email) {
 		http.Error(w, "Invalid email", http.StatusBadRequest)
 		return
 	}
-	if _, err := ac.userStore.GetByName(registerRequest.Username); err == nil {
-		http.Error(w, "Username already exists", http.StatusBadRequest)
+	if err := ac.PasswordPolicy.Validate(registerRequest.Username, registerRequest.Password); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	passHash, err := bcrypt.GenerateFromPassword([]byte(registerRequest.Password), bcrypt.DefaultCost)
+	passHash, err := ac.PasswordHasher.Hash([]byte(registerRequest.Password))
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	ac.userStore.Insert(models.User{
-		Name: registerRequest.Username,
-		Hash: passHash,
+	user, err := ac.userStore.Insert(r.Context(), models.User{
+		Name:  registerRequest.Username,
+		Hash:  passHash,
+		Role:  models.RoleUser,
+		Email: registerRequest.Email,
 	})
+	// the store enforces unique usernames, checking them in advance could not prevent concurrent registrations
+	if errors.Is(err, stores.ErrConflict) {
+		audit(ac.Audit, r, models.AuditUserRegistered, models.AuditFailure, models.User{}, "username '"+registerRequest.Username+"' already exists")
+		http.Error(w, "Username already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Could not insert user '%s'. Error: %v", registerRequest.Username, err)
+		writeStoreError(w, err)
+		return
+	}
+	audit(ac.Audit, r, models.AuditUserRegistered, models.AuditSuccess, user, "")
+	writeJSON(w, http.StatusCreated, dtos.NewUser(user))
 }
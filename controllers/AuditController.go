@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/Kirides/simpleApi/dtos"
+	"github.com/Kirides/simpleApi/models"
+	"github.com/Kirides/simpleApi/services"
+	"github.com/Kirides/simpleApi/stores"
+	"github.com/gorilla/mux"
+)
+
+// AuditController lets admins query the audit log
+type AuditController struct {
+	log               *services.AuditLog
+	MaxEventsReturned int64
+}
+
+// NewAuditController ...
+func NewAuditController(l *services.AuditLog) *AuditController {
+	return &AuditController{
+		log:               l,
+		MaxEventsReturned: 500,
+	}
+}
+
+// HandleAuditAPI registers the /audit endpoint onto the provided router.
+// Org admins only see the events of their own organization.
+func (ac *AuditController) HandleAuditAPI(r *mux.Router) {
+	r.Path("/audit").Methods(http.MethodGet).Handler(requireUserManager(http.HandlerFunc(ac.handleAudit)))
+	r.Path("/audit/verify").Methods(http.MethodGet).Handler(requireRole(http.HandlerFunc(ac.handleVerify), models.RoleAdmin))
+	log.Println("registered audit-endpoint")
+}
+
+// getAuditQuery reads the filters of the audit log from the query string:
+// action, outcome, user (actor or target), org (only honoured for platform admins), ip, request_id,
+// from, until (RFC 3339), before (id of the last event of the previous page) and limit
+func (ac *AuditController) getAuditQuery(r *http.Request) (stores.AuditQuery, error) {
+	v := r.URL.Query()
+	q := stores.AuditQuery{
+		Action:    v.Get("action"),
+		Outcome:   v.Get("outcome"),
+		UserID:    v.Get("user"),
+		OrgID:     v.Get("org"),
+		IP:        v.Get("ip"),
+		RequestID: v.Get("request_id"),
+	}
+	if p, _ := models.PrincipalFromContext(r.Context()); p.Role != models.RoleAdmin {
+		q.OrgID = p.OrgID
+	}
+	var err error
+	if q.From, err = getTime(v.Get("from")); err != nil {
+		return q, fmt.Errorf("from must be a RFC 3339 timestamp")
+	}
+	if q.Until, err = getTime(v.Get("until")); err != nil {
+		return q, fmt.Errorf("until must be a RFC 3339 timestamp")
+	}
+	if before := v.Get("before"); before != "" {
+		if q.BeforeID, err = strconv.ParseInt(before, 10, 64); err != nil || q.BeforeID < 1 {
+			return q, fmt.Errorf("before must be the id of an event")
+		}
+	}
+	if q.Limit, err = getLimit(r); err != nil {
+		return q, err
+	}
+	if q.Limit == 0 || q.Limit > ac.MaxEventsReturned {
+		q.Limit = ac.MaxEventsReturned
+	}
+	return q, nil
+}
+
+// handleAudit lists the matching events, newest first.
+// The next page is linked by a RFC 8288 Link header.
+func (ac *AuditController) handleAudit(w http.ResponseWriter, r *http.Request) {
+	q, err := ac.getAuditQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	events, err := ac.log.Find(r.Context(), q)
+	if err != nil {
+		log.Printf("Could not retrieve audit events. Error: %v", err)
+		http.Error(w, "Could not retrieve result", storeErrorStatus(err))
+		return
+	}
+	if int64(len(events)) == q.Limit {
+		v := r.URL.Query()
+		v.Set("before", strconv.FormatInt(events[len(events)-1].ID, 10))
+		link := url.URL{Path: r.URL.Path, RawQuery: v.Encode()}
+		w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, link.String()))
+		w.Header().Set("Access-Control-Expose-Headers", "Link")
+	}
+	writeJSON(w, http.StatusOK, dtos.NewAuditEvents(events))
+}
+
+// handleVerify checks the hash chain of the audit log
+func (ac *AuditController) handleVerify(w http.ResponseWriter, r *http.Request) {
+	result, err := ac.log.Verify(r.Context())
+	if err != nil {
+		log.Printf("Could not verify audit log. Error: %v", err)
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
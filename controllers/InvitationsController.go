@@ -0,0 +1,371 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Kirides/simpleApi/dtos"
+	"github.com/Kirides/simpleApi/models"
+	"github.com/Kirides/simpleApi/services"
+	"github.com/Kirides/simpleApi/stores"
+	"github.com/gorilla/mux"
+)
+
+// InvitationsController lets admins and org admins invite people by email.
+// Every invitation is turned into a signed link, that creates exactly one account
+// with the role and organization of the invitation until it expires or is revoked.
+type InvitationsController struct {
+	store     stores.InvitationStore
+	userStore stores.UserStore
+	links     *signer
+	// OrgStore is used to validate the org of invitations, if not set only models.DefaultOrgID is valid
+	OrgStore stores.OrgStore
+	// Lifetime is the time an invitation can be accepted
+	Lifetime time.Duration
+	// LinkBase is prefixed to the token to build the invite link, e.g. "https://example.com/#/invite/"
+	LinkBase       string
+	PasswordPolicy *services.PasswordPolicy
+	PasswordHasher services.PasswordHasher
+	// Audit records created, revoked and accepted invitations, if set
+	Audit *services.AuditLog
+}
+
+// invitationWrite is the representation of an invitation accepted by POST
+type invitationWrite struct {
+	Email string `json:"email"`
+	Role  string `json:"role,omitempty"`
+	Org   string `json:"org,omitempty"`
+}
+
+// invitationAccept is sent by the invited person to create the account
+type invitationAccept struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	profileWrite
+}
+
+// inviteLink is the signed payload of an invite link
+type inviteLink struct {
+	ID        string `json:"i"`
+	ExpiresAt int64  `json:"e"`
+}
+
+// NewInvitationsController ...
+func NewInvitationsController(store stores.InvitationStore, userStore stores.UserStore) *InvitationsController {
+	return &InvitationsController{
+		store:          store,
+		userStore:      userStore,
+		links:          newRandomSigner(),
+		Lifetime:       7 * 24 * time.Hour,
+		LinkBase:       "/account/invitations/",
+		PasswordPolicy: services.NewPasswordPolicy(),
+		PasswordHasher: services.DefaultPasswordHasher(),
+	}
+}
+
+// SetLinkSecret changes the key used for signing invite links.
+// By default a random key is used, which invalidates all links on restart
+func (ic *InvitationsController) SetLinkSecret(secret []byte) {
+	ic.links = &signer{secret: secret}
+}
+
+// HandleInvitationsAPI registers the authenticated /invitations endpoints onto the provided router
+func (ic *InvitationsController) HandleInvitationsAPI(r *mux.Router) {
+	r.Path("/invitations").Methods(http.MethodGet).Handler(requireUserManager(http.HandlerFunc(ic.handleInvitations)))
+	r.Path("/invitations").Methods(http.MethodPost).Handler(requireUserManager(http.HandlerFunc(ic.handleCreateInvitation)))
+	r.Path("/invitations/{id:[0-9]+}").Methods(http.MethodGet).Handler(requireUserManager(http.HandlerFunc(ic.handleInvitation)))
+	r.Path("/invitations/{id:[0-9]+}").Methods(http.MethodDelete).Handler(requireUserManager(http.HandlerFunc(ic.handleRevokeInvitation)))
+	log.Println("registered invitations-endpoint")
+}
+
+// HandleAcceptAPI registers the public endpoints of invite links onto the provided router
+func (ic *InvitationsController) HandleAcceptAPI(r *mux.Router) {
+	r.Path("/invitations/{token}").Methods(http.MethodGet).HandlerFunc(ic.handleInvitationDetails)
+	r.Path("/invitations/{token}/accept").Methods(http.MethodPost).HandlerFunc(ic.handleAcceptInvitation)
+}
+
+func (ic *InvitationsController) handleInvitations(w http.ResponseWriter, r *http.Request) {
+	p, _ := models.PrincipalFromContext(r.Context())
+	v := r.URL.Query()
+	orgID := p.OrgID
+	if p.Role == models.RoleAdmin {
+		orgID = v.Get("org")
+	}
+	status := v.Get("status")
+	if status == "" {
+		status = models.InvitationPending
+	}
+	switch status {
+	case "all", models.InvitationPending, models.InvitationAccepted, models.InvitationRevoked, models.InvitationExpired:
+	default:
+		http.Error(w, "status must be 'all', 'pending', 'accepted', 'revoked' or 'expired'", http.StatusBadRequest)
+		return
+	}
+	invitations, err := ic.store.FindInvitations(r.Context(), orgID)
+	if err != nil {
+		log.Printf("Could not retrieve invitations. Error: %v", err)
+		writeStoreError(w, err)
+		return
+	}
+	now := time.Now()
+	result := []dtos.Invitation{}
+	for _, inv := range invitations {
+		if status == "all" || inv.Status(now) == status {
+			result = append(result, dtos.NewInvitation(inv, now))
+		}
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// validateInvitation checks req against the permissions of the caller and applies the defaults
+func (ic *InvitationsController) validateInvitation(ctx context.Context, p models.Principal, req *invitationWrite) (int, error) {
+	req.Email = strings.TrimSpace(req.Email)
+	if !services.ValidEmail(req.Email) {
+		return http.StatusBadRequest, fmt.Errorf("Invalid email")
+	}
+	if req.Role == "" {
+		req.Role = models.RoleUser
+	}
+	if !services.ValidRole(req.Role) {
+		return http.StatusBadRequest, fmt.Errorf("Invalid role")
+	}
+	if req.Org == "" {
+		req.Org = p.OrgID
+	}
+	if !p.CanManageOrg(req.Org) {
+		return http.StatusForbidden, fmt.Errorf("Only admins can invite into other organizations")
+	}
+	if p.Role != models.RoleAdmin && req.Role == models.RoleAdmin {
+		return http.StatusForbidden, fmt.Errorf("Only admins can invite admins")
+	}
+	if ic.OrgStore == nil {
+		if req.Org != models.DefaultOrgID {
+			return http.StatusBadRequest, fmt.Errorf("Invalid org")
+		}
+		return 0, nil
+	}
+	if _, err := ic.OrgStore.GetOrg(ctx, req.Org); err != nil {
+		if errors.Is(err, stores.ErrNotFound) {
+			return http.StatusBadRequest, fmt.Errorf("Invalid org")
+		}
+		return storeErrorStatus(err), fmt.Errorf("Could not check org")
+	}
+	return 0, nil
+}
+
+// handleCreateInvitation creates an invitation and answers with its link.
+// Inviting an email address that already has a pending invitation in the organization fails with 409.
+func (ic *InvitationsController) handleCreateInvitation(w http.ResponseWriter, r *http.Request) {
+	p, _ := models.PrincipalFromContext(r.Context())
+	var req invitationWrite
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if status, err := ic.validateInvitation(r.Context(), p, &req); err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	existing, err := ic.store.FindInvitations(r.Context(), req.Org)
+	if err != nil {
+		log.Printf("Could not retrieve invitations. Error: %v", err)
+		writeStoreError(w, err)
+		return
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, inv := range existing {
+		if strings.EqualFold(inv.Email, req.Email) && inv.Status(now) == models.InvitationPending {
+			http.Error(w, "The email address already has a pending invitation", http.StatusConflict)
+			return
+		}
+	}
+	inv, err := ic.store.InsertInvitation(r.Context(), models.Invitation{
+		Email:     req.Email,
+		Role:      req.Role,
+		OrgID:     req.Org,
+		InvitedBy: p.ID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ic.Lifetime),
+	})
+	if err != nil {
+		log.Printf("Could not insert invitation. Error: %v", err)
+		writeStoreError(w, err)
+		return
+	}
+	token, err := ic.linkToken(inv)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	log.Printf("user '%s' invited '%s' into organization '%s'", p.ID, inv.Email, inv.OrgID)
+	ic.auditInvitation(r, models.AuditInviteCreated, inv)
+	result := dtos.NewInvitation(inv, now)
+	result.URL = ic.LinkBase + token
+	w.Header().Set("Location", r.URL.Path+"/"+inv.ID)
+	writeJSON(w, http.StatusCreated, result)
+}
+
+// managedInvitation loads the invitation of the request, if the caller is allowed to manage it.
+// Invitations of other organizations are reported as not found.
+func (ic *InvitationsController) managedInvitation(w http.ResponseWriter, r *http.Request) (models.Invitation, bool) {
+	inv, err := ic.store.GetInvitation(r.Context(), mux.Vars(r)["id"])
+	if p, _ := models.PrincipalFromContext(r.Context()); errors.Is(err, stores.ErrNotFound) || err == nil && !p.CanManageOrg(inv.OrgID) {
+		w.WriteHeader(http.StatusNotFound)
+		return inv, false
+	}
+	if err != nil {
+		log.Printf("Could not retrieve invitation. Error: %v", err)
+		writeStoreError(w, err)
+		return inv, false
+	}
+	return inv, true
+}
+
+func (ic *InvitationsController) handleInvitation(w http.ResponseWriter, r *http.Request) {
+	if inv, ok := ic.managedInvitation(w, r); ok {
+		writeJSON(w, http.StatusOK, dtos.NewInvitation(inv, time.Now()))
+	}
+}
+
+// handleRevokeInvitation invalidates the link of an invitation that has not been accepted yet
+func (ic *InvitationsController) handleRevokeInvitation(w http.ResponseWriter, r *http.Request) {
+	inv, ok := ic.managedInvitation(w, r)
+	if !ok {
+		return
+	}
+	if err := ic.store.RevokeInvitation(r.Context(), inv.ID, time.Now()); err != nil {
+		switch {
+		case errors.Is(err, stores.ErrNotFound):
+			w.WriteHeader(http.StatusNotFound)
+		case errors.Is(err, stores.ErrConflict):
+			http.Error(w, "The invitation has already been "+inv.Status(time.Now()), http.StatusConflict)
+		default:
+			log.Printf("Could not revoke invitation '%s'. Error: %v", inv.ID, err)
+			writeStoreError(w, err)
+		}
+		return
+	}
+	ic.auditInvitation(r, models.AuditInviteRevoked, inv)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// auditInvitation records a successful action on the invitation
+func (ic *InvitationsController) auditInvitation(r *http.Request, action string, inv models.Invitation) {
+	if ic.Audit == nil {
+		return
+	}
+	e := newAuditEvent(r, action, models.AuditSuccess)
+	e.OrgID = inv.OrgID
+	e.Details = "invitation " + inv.ID + " of " + inv.Email + " as " + inv.Role
+	ic.Audit.Record(r.Context(), e)
+}
+
+func (ic *InvitationsController) linkToken(inv models.Invitation) (string, error) {
+	payload, err := json.Marshal(inviteLink{ID: inv.ID, ExpiresAt: inv.ExpiresAt.Unix()})
+	if err != nil {
+		return "", err
+	}
+	return ic.links.seal(payload), nil
+}
+
+// pendingInvitation loads the invitation of the link in the request.
+// Forged links are reported as not found, links that can no longer be used as gone.
+func (ic *InvitationsController) pendingInvitation(w http.ResponseWriter, r *http.Request) (models.Invitation, bool) {
+	var link inviteLink
+	payload, ok := ic.links.open(mux.Vars(r)["token"])
+	if !ok || json.Unmarshal(payload, &link) != nil {
+		http.Error(w, "Invalid invitation", http.StatusNotFound)
+		return models.Invitation{}, false
+	}
+	inv, err := ic.store.GetInvitation(r.Context(), link.ID)
+	if err != nil {
+		if errors.Is(err, stores.ErrNotFound) {
+			http.Error(w, "Invalid invitation", http.StatusNotFound)
+			return inv, false
+		}
+		log.Printf("Could not retrieve invitation. Error: %v", err)
+		writeStoreError(w, err)
+		return inv, false
+	}
+	if status := inv.Status(time.Now()); status != models.InvitationPending {
+		http.Error(w, "The invitation has been "+status, http.StatusGone)
+		return inv, false
+	}
+	return inv, true
+}
+
+func (ic *InvitationsController) handleInvitationDetails(w http.ResponseWriter, r *http.Request) {
+	if inv, ok := ic.pendingInvitation(w, r); ok {
+		writeJSON(w, http.StatusOK, dtos.NewInvitationDetails(inv))
+	}
+}
+
+// handleAcceptInvitation creates the account of the invitation with the chosen username and password
+func (ic *InvitationsController) handleAcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	inv, ok := ic.pendingInvitation(w, r)
+	if !ok {
+		return
+	}
+	var req invitationAccept
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if !services.ValidUsername(req.Username) {
+		http.Error(w, "Invalid username", http.StatusBadRequest)
+		return
+	}
+	req.Email = inv.Email
+	if err := validateProfile(req.profileWrite); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := ic.PasswordPolicy.Validate(req.Username, req.Password); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if existing, err := ic.userStore.GetByName(r.Context(), req.Username); err == nil && existing.ID != "" {
+		http.Error(w, "Username already exists", http.StatusConflict)
+		return
+	}
+	hash, err := ic.PasswordHasher.Hash([]byte(req.Password))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	user := models.User{
+		Name:  req.Username,
+		Hash:  hash,
+		Role:  inv.Role,
+		OrgID: inv.OrgID,
+	}
+	applyProfile(&user, req.profileWrite)
+	user, err = ic.userStore.Insert(r.Context(), user)
+	if err != nil {
+		log.Printf("Could not insert user of invitation '%s'. Error: %v", inv.ID, err)
+		writeStoreConflict(w, err, "Username already exists")
+		return
+	}
+	if err := ic.store.AcceptInvitation(r.Context(), inv.ID, user.ID, time.Now()); err != nil {
+		// the invitation was used or revoked concurrently, the account must not survive
+		if err := ic.userStore.Delete(r.Context(), user.ID, user.Version); err != nil {
+			log.Printf("Could not remove user '%s' of an invitation that was already used. Error: %v", user.ID, err)
+		}
+		if errors.Is(err, stores.ErrConflict) {
+			http.Error(w, "The invitation has already been used", http.StatusGone)
+			return
+		}
+		log.Printf("Could not accept invitation '%s'. Error: %v", inv.ID, err)
+		writeStoreError(w, err)
+		return
+	}
+	log.Printf("invitation '%s' accepted by new user '%s'", inv.ID, user.ID)
+	audit(ic.Audit, r, models.AuditUserRegistered, models.AuditSuccess, user, "invitation "+inv.ID)
+	writeJSON(w, http.StatusCreated, dtos.NewUser(user))
+}
@@ -0,0 +1,28 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/Kirides/simpleApi/models"
+	"github.com/Kirides/simpleApi/stores"
+)
+
+func TestValidateInvitationMapsOrgStoreErrors(t *testing.T) {
+	ic := NewInvitationsController(stores.NewMemoryInvitationStore(), stores.NewMemoryUserStore())
+	ic.OrgStore = stores.NewMemoryOrgStore()
+	admin := models.Principal{ID: "1", Name: "admin", Role: models.RoleAdmin, OrgID: models.DefaultOrgID}
+
+	req := invitationWrite{Email: "new@example.com", Org: "unknown"}
+	if status, _ := ic.validateInvitation(context.Background(), admin, &req); status != http.StatusBadRequest {
+		t.Errorf("inviting into an unknown organization returned %d, expected %d", status, http.StatusBadRequest)
+	}
+	// the memory stores report a done context like an unreachable database
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req = invitationWrite{Email: "new@example.com", Org: "unknown"}
+	if status, _ := ic.validateInvitation(ctx, admin, &req); status != http.StatusServiceUnavailable {
+		t.Errorf("inviting while the organizations are unavailable returned %d, expected %d", status, http.StatusServiceUnavailable)
+	}
+}
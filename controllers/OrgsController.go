@@ -0,0 +1,434 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Kirides/simpleApi/dtos"
+	"github.com/Kirides/simpleApi/models"
+	"github.com/Kirides/simpleApi/stores"
+	"github.com/gorilla/mux"
+)
+
+// OrgIDPattern is the pattern organization ids (slugs) are validated against
+const OrgIDPattern = "^[a-z0-9]+(?:-[a-z0-9]+)*$"
+
+// maxOrgIDLength, maxNameLength and maxDescriptionLength limit the fields of organizations and groups
+const (
+	maxOrgIDLength       = 64
+	maxNameLength        = 100
+	maxDescriptionLength = 500
+)
+
+var rxOrgID = regexp.MustCompile(OrgIDPattern)
+
+// OrgsController manages organizations, their groups and the group memberships.
+// Platform admins manage every organization, org admins only their own.
+// Members of an organization are allowed to read it and its groups.
+type OrgsController struct {
+	store     stores.OrgStore
+	userStore stores.UserStore
+}
+
+// orgWrite is the representation of an organization accepted by POST and PATCH
+type orgWrite struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// groupWrite is the representation of a group accepted by POST and PATCH
+type groupWrite struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// NewOrgsController ...
+func NewOrgsController(store stores.OrgStore, userStore stores.UserStore) *OrgsController {
+	return &OrgsController{
+		store:     store,
+		userStore: userStore,
+	}
+}
+
+// HandleOrgsAPI registers the /orgs endpoints onto the provided router
+func (oc *OrgsController) HandleOrgsAPI(r *mux.Router) {
+	r.Path("/orgs").Methods(http.MethodGet).HandlerFunc(oc.handleOrgs)
+	r.Path("/orgs").Methods(http.MethodPost).Handler(requireRole(http.HandlerFunc(oc.handleCreateOrg), models.RoleAdmin))
+	r.Path("/orgs/{org}").Methods(http.MethodGet).Handler(oc.requireMember(oc.handleOrg))
+	r.Path("/orgs/{org}").Methods(http.MethodPatch).Handler(oc.requireManager(oc.handlePatchOrg))
+	r.Path("/orgs/{org}").Methods(http.MethodDelete).Handler(requireRole(http.HandlerFunc(oc.handleDeleteOrg), models.RoleAdmin))
+	r.Path("/orgs/{org}/groups").Methods(http.MethodGet).Handler(oc.requireMember(oc.handleGroups))
+	r.Path("/orgs/{org}/groups").Methods(http.MethodPost).Handler(oc.requireManager(oc.handleCreateGroup))
+	r.Path("/orgs/{org}/groups/{id:[0-9]+}").Methods(http.MethodGet).Handler(oc.requireMember(oc.handleGroup))
+	r.Path("/orgs/{org}/groups/{id:[0-9]+}").Methods(http.MethodPatch).Handler(oc.requireManager(oc.handlePatchGroup))
+	r.Path("/orgs/{org}/groups/{id:[0-9]+}").Methods(http.MethodDelete).Handler(oc.requireManager(oc.handleDeleteGroup))
+	r.Path("/orgs/{org}/groups/{id:[0-9]+}/members").Methods(http.MethodGet).Handler(oc.requireManager(oc.handleMembers))
+	r.Path("/orgs/{org}/groups/{id:[0-9]+}/members/{userId:[0-9]+}").Methods(http.MethodPut).Handler(oc.requireManager(oc.handleAddMember))
+	r.Path("/orgs/{org}/groups/{id:[0-9]+}/members/{userId:[0-9]+}").Methods(http.MethodDelete).Handler(oc.requireManager(oc.handleRemoveMember))
+	r.Path("/users/me/groups").Methods(http.MethodGet).HandlerFunc(oc.handleMyGroups)
+	log.Println("registered orgs-endpoint")
+}
+
+// requireMember only passes requests on, whose caller belongs to the organization or is a platform admin.
+// Other organizations are reported as not found.
+func (oc *OrgsController) requireMember(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, _ := models.PrincipalFromContext(r.Context())
+		if p.Role != models.RoleAdmin && p.OrgID != mux.Vars(r)["org"] {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		next(w, r)
+	})
+}
+
+// requireManager only passes requests on, whose caller is allowed to manage the organization
+func (oc *OrgsController) requireManager(next http.HandlerFunc) http.Handler {
+	return oc.requireMember(func(w http.ResponseWriter, r *http.Request) {
+		if p, _ := models.PrincipalFromContext(r.Context()); !p.CanManageOrg(mux.Vars(r)["org"]) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	})
+}
+
+// validateName checks the name of an organization or group
+func validateName(name string) error {
+	if name == "" {
+		return fmt.Errorf("Name is required")
+	}
+	if utf8.RuneCountInString(name) > maxNameLength {
+		return fmt.Errorf("Name must not be longer than %d characters", maxNameLength)
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) {
+			return fmt.Errorf("Invalid name")
+		}
+	}
+	return nil
+}
+
+// readPatch applies the JSON Merge Patch of the request body onto current and decodes the result into target.
+// It returns false if the request has already been answered.
+func readPatch(w http.ResponseWriter, r *http.Request, current, target interface{}) bool {
+	if ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); ct != mergePatchContentType && ct != "application/json" {
+		w.Header().Set("Accept-Patch", mergePatchContentType)
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return false
+	}
+	patch, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return false
+	}
+	doc, err := json.Marshal(current)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return false
+	}
+	patched, err := applyMergePatch(doc, patch)
+	if err != nil {
+		http.Error(w, "Invalid merge patch", http.StatusBadRequest)
+		return false
+	}
+	if err := json.Unmarshal(patched, target); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// writeOrgStoreError answers with the status matching an error of the OrgStore
+func writeOrgStoreError(w http.ResponseWriter, err error, action string) {
+	switch {
+	case errors.Is(err, stores.ErrNotFound):
+		w.WriteHeader(http.StatusNotFound)
+	case errors.Is(err, stores.ErrConflict):
+		http.Error(w, "Name already exists", http.StatusConflict)
+	default:
+		log.Printf("Could not %s. Error: %v", action, err)
+		writeStoreError(w, err)
+	}
+}
+
+func (oc *OrgsController) handleOrgs(w http.ResponseWriter, r *http.Request) {
+	p, _ := models.PrincipalFromContext(r.Context())
+	if p.Role != models.RoleAdmin {
+		org, err := oc.store.GetOrg(r.Context(), p.OrgID)
+		if err != nil {
+			writeOrgStoreError(w, err, "retrieve organization")
+			return
+		}
+		writeJSON(w, http.StatusOK, []dtos.Organization{dtos.NewOrganization(org)})
+		return
+	}
+	orgs, err := oc.store.ListOrgs(r.Context())
+	if err != nil {
+		writeOrgStoreError(w, err, "retrieve organizations")
+		return
+	}
+	writeJSON(w, http.StatusOK, dtos.NewOrganizations(orgs))
+}
+
+func (oc *OrgsController) handleCreateOrg(w http.ResponseWriter, r *http.Request) {
+	var req orgWrite
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if len(req.ID) > maxOrgIDLength || !rxOrgID.MatchString(req.ID) {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if err := validateName(req.Name); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	org, err := oc.store.InsertOrg(r.Context(), models.Organization{ID: req.ID, Name: req.Name})
+	if err != nil {
+		if errors.Is(err, stores.ErrConflict) {
+			http.Error(w, "Organization already exists", http.StatusConflict)
+			return
+		}
+		writeOrgStoreError(w, err, "insert organization")
+		return
+	}
+	w.Header().Set("Location", r.URL.Path+"/"+org.ID)
+	writeJSON(w, http.StatusCreated, dtos.NewOrganization(org))
+}
+
+func (oc *OrgsController) handleOrg(w http.ResponseWriter, r *http.Request) {
+	org, err := oc.store.GetOrg(r.Context(), mux.Vars(r)["org"])
+	if err != nil {
+		writeOrgStoreError(w, err, "retrieve organization")
+		return
+	}
+	writeJSON(w, http.StatusOK, dtos.NewOrganization(org))
+}
+
+func (oc *OrgsController) handlePatchOrg(w http.ResponseWriter, r *http.Request) {
+	org, err := oc.store.GetOrg(r.Context(), mux.Vars(r)["org"])
+	if err != nil {
+		writeOrgStoreError(w, err, "retrieve organization")
+		return
+	}
+	var req orgWrite
+	if !readPatch(w, r, orgWrite{ID: org.ID, Name: org.Name}, &req) {
+		return
+	}
+	if req.ID != org.ID {
+		http.Error(w, "The id of an organization can not be changed", http.StatusBadRequest)
+		return
+	}
+	org.Name = strings.TrimSpace(req.Name)
+	if err := validateName(org.Name); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := oc.store.UpdateOrg(r.Context(), org); err != nil {
+		writeOrgStoreError(w, err, "update organization")
+		return
+	}
+	writeJSON(w, http.StatusOK, dtos.NewOrganization(org))
+}
+
+// handleDeleteOrg removes an organization without users, including deleted ones that have not been purged yet
+func (oc *OrgsController) handleDeleteOrg(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["org"]
+	if id == models.DefaultOrgID {
+		http.Error(w, "The default organization can not be deleted", http.StatusConflict)
+		return
+	}
+	if _, err := oc.store.GetOrg(r.Context(), id); err != nil {
+		writeOrgStoreError(w, err, "retrieve organization")
+		return
+	}
+	users, err := oc.userStore.Count(r.Context(), stores.UserQuery{OrgID: id})
+	if err != nil {
+		log.Printf("Could not count users of organization '%s'. Error: %v", id, err)
+		writeStoreError(w, err)
+		return
+	}
+	if users > 0 {
+		http.Error(w, "The organization still has users", http.StatusConflict)
+		return
+	}
+	if err := oc.store.DeleteOrg(r.Context(), id); err != nil {
+		writeOrgStoreError(w, err, "delete organization")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (oc *OrgsController) handleGroups(w http.ResponseWriter, r *http.Request) {
+	orgID := mux.Vars(r)["org"]
+	if _, err := oc.store.GetOrg(r.Context(), orgID); err != nil {
+		writeOrgStoreError(w, err, "retrieve organization")
+		return
+	}
+	groups, err := oc.store.ListGroups(r.Context(), orgID)
+	if err != nil {
+		writeOrgStoreError(w, err, "retrieve groups")
+		return
+	}
+	writeJSON(w, http.StatusOK, dtos.NewGroups(groups))
+}
+
+// applyGroupWrite validates req and applies it onto g
+func applyGroupWrite(g *models.Group, req groupWrite) error {
+	req.Name = strings.TrimSpace(req.Name)
+	if err := validateName(req.Name); err != nil {
+		return err
+	}
+	if utf8.RuneCountInString(req.Description) > maxDescriptionLength {
+		return fmt.Errorf("Description must not be longer than %d characters", maxDescriptionLength)
+	}
+	g.Name = req.Name
+	g.Description = req.Description
+	return nil
+}
+
+func (oc *OrgsController) handleCreateGroup(w http.ResponseWriter, r *http.Request) {
+	orgID := mux.Vars(r)["org"]
+	if _, err := oc.store.GetOrg(r.Context(), orgID); err != nil {
+		writeOrgStoreError(w, err, "retrieve organization")
+		return
+	}
+	var req groupWrite
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	group := models.Group{OrgID: orgID}
+	if err := applyGroupWrite(&group, req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	group, err := oc.store.InsertGroup(r.Context(), group)
+	if err != nil {
+		writeOrgStoreError(w, err, "insert group")
+		return
+	}
+	w.Header().Set("Location", r.URL.Path+"/"+group.ID)
+	writeJSON(w, http.StatusCreated, dtos.NewGroup(group))
+}
+
+func (oc *OrgsController) handleGroup(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	group, err := oc.store.GetGroup(r.Context(), vars["org"], vars["id"])
+	if err != nil {
+		writeOrgStoreError(w, err, "retrieve group")
+		return
+	}
+	writeJSON(w, http.StatusOK, dtos.NewGroup(group))
+}
+
+func (oc *OrgsController) handlePatchGroup(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	group, err := oc.store.GetGroup(r.Context(), vars["org"], vars["id"])
+	if err != nil {
+		writeOrgStoreError(w, err, "retrieve group")
+		return
+	}
+	var req groupWrite
+	if !readPatch(w, r, groupWrite{Name: group.Name, Description: group.Description}, &req) {
+		return
+	}
+	if err := applyGroupWrite(&group, req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := oc.store.UpdateGroup(r.Context(), group); err != nil {
+		writeOrgStoreError(w, err, "update group")
+		return
+	}
+	writeJSON(w, http.StatusOK, dtos.NewGroup(group))
+}
+
+func (oc *OrgsController) handleDeleteGroup(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if err := oc.store.DeleteGroup(r.Context(), vars["org"], vars["id"]); err != nil {
+		writeOrgStoreError(w, err, "delete group")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleMembers lists the members of a group, leaving out users that have been purged.
+// Like the users list it contains personal data, so it is limited to managers of the organization.
+func (oc *OrgsController) handleMembers(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	ids, err := oc.store.GroupMembers(r.Context(), vars["org"], vars["id"])
+	if err != nil {
+		writeOrgStoreError(w, err, "retrieve group members")
+		return
+	}
+	users := stores.NewTenantUserStore(oc.userStore, vars["org"])
+	members := make([]models.User, 0, len(ids))
+	for _, id := range ids {
+		u, err := users.Get(r.Context(), id)
+		if errors.Is(err, stores.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			log.Printf("Could not retrieve group member '%s'. Error: %v", id, err)
+			writeStoreError(w, err)
+			return
+		}
+		members = append(members, u)
+	}
+	writeJSON(w, http.StatusOK, dtos.NewUsers(members))
+}
+
+// handleAddMember adds a user of the organization to the group
+func (oc *OrgsController) handleAddMember(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if _, err := stores.NewTenantUserStore(oc.userStore, vars["org"]).Get(r.Context(), vars["userId"]); err != nil {
+		if errors.Is(err, stores.ErrNotFound) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		writeOrgStoreError(w, err, "retrieve user")
+		return
+	}
+	if err := oc.store.AddGroupMember(r.Context(), vars["org"], vars["id"], vars["userId"]); err != nil {
+		writeOrgStoreError(w, err, "add group member")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (oc *OrgsController) handleRemoveMember(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if err := oc.store.RemoveGroupMember(r.Context(), vars["org"], vars["id"], vars["userId"]); err != nil {
+		writeOrgStoreError(w, err, "remove group member")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleMyGroups lists the groups the caller is a member of
+func (oc *OrgsController) handleMyGroups(w http.ResponseWriter, r *http.Request) {
+	p, ok := models.PrincipalFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	groups, err := oc.store.UserGroups(r.Context(), p.ID)
+	if err != nil {
+		writeOrgStoreError(w, err, "retrieve groups")
+		return
+	}
+	writeJSON(w, http.StatusOK, dtos.NewGroups(groups))
+}
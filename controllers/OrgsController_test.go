@@ -0,0 +1,49 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/Kirides/simpleApi/models"
+	"github.com/Kirides/simpleApi/stores"
+	"github.com/gorilla/mux"
+)
+
+func TestOrgGroupMembersAreOnlyListedForManagers(t *testing.T) {
+	ctx := context.Background()
+	us := stores.NewMemoryUserStore()
+	orgs := stores.NewMemoryOrgStore()
+	if _, err := orgs.InsertOrg(ctx, models.Organization{ID: "acme", Name: "ACME"}); err != nil {
+		t.Fatal(err)
+	}
+	group, err := orgs.InsertGroup(ctx, models.Group{OrgID: "acme", Name: "staff"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	member := insertUser(t, us, "member", models.RoleUser, "acme")
+	manager := insertUser(t, us, "manager", models.RoleOrgAdmin, "acme")
+	outsider := insertUser(t, us, "outsider", models.RoleOrgAdmin, models.DefaultOrgID)
+	admin := insertUser(t, us, "admin", models.RoleAdmin, models.DefaultOrgID)
+	if err := orgs.AddGroupMember(ctx, "acme", group.ID, member.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	r := mux.NewRouter()
+	NewOrgsController(orgs, us).HandleOrgsAPI(r)
+	for _, c := range []struct {
+		caller models.User
+		path   string
+		want   int
+	}{
+		{member, "/orgs/acme/groups/" + group.ID, http.StatusOK},
+		{member, "/orgs/acme/groups/" + group.ID + "/members", http.StatusForbidden},
+		{outsider, "/orgs/acme/groups/" + group.ID + "/members", http.StatusNotFound},
+		{manager, "/orgs/acme/groups/" + group.ID + "/members", http.StatusOK},
+		{admin, "/orgs/acme/groups/" + group.ID + "/members", http.StatusOK},
+	} {
+		if w := serveAs(r, principalOf(c.caller), http.MethodGet, c.path, ""); w.Code != c.want {
+			t.Errorf("GET %s as %s returned %d, expected %d", c.path, c.caller.Name, w.Code, c.want)
+		}
+	}
+}
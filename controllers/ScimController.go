@@ -0,0 +1,993 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Kirides/simpleApi/dtos"
+	"github.com/Kirides/simpleApi/models"
+	"github.com/Kirides/simpleApi/services"
+	"github.com/Kirides/simpleApi/stores"
+	"github.com/gorilla/mux"
+)
+
+const scimContentType = "application/scim+json"
+
+// ScimController provisions users through SCIM 2.0 (RFC 7643, RFC 7644).
+// Roles are exposed as groups, the membership of a user is its role.
+// Deleted users are invisible to SCIM clients.
+type ScimController struct {
+	store stores.UserStore
+	// tokenHash is the SHA-256 of the bearer token SCIM clients authenticate with
+	tokenHash []byte
+	// BasePath is the path the SCIM endpoints are registered at, used for resource locations
+	BasePath       string
+	MaxResults     int64
+	PasswordPolicy *services.PasswordPolicy
+	PasswordHasher services.PasswordHasher
+	// Audit records all changes SCIM clients make, if set
+	Audit *services.AuditLog
+	// AdminRoleAllowed exposes the admin group, which grants access to all organizations.
+	// Without it the group is hidden and users with the role can not be changed,
+	// clients scoped to an organization must not be able to create or demote platform admins.
+	AdminRoleAllowed bool
+}
+
+// NewScimController creates a ScimController that only accepts requests carrying the bearer token
+func NewScimController(store stores.UserStore, token string) *ScimController {
+	h := sha256.Sum256([]byte(token))
+	return &ScimController{
+		store:            store,
+		tokenHash:        h[:],
+		BasePath:         "/scim/v2",
+		MaxResults:       200,
+		PasswordPolicy:   services.NewPasswordPolicy(),
+		PasswordHasher:   services.DefaultPasswordHasher(),
+		AdminRoleAllowed: true,
+	}
+}
+
+// scimUserWrite is the representation of a user accepted by POST and PUT
+type scimUserWrite struct {
+	UserName    string           `json:"userName"`
+	DisplayName string           `json:"displayName"`
+	Emails      []dtos.ScimEmail `json:"emails"`
+	Locale      string           `json:"locale"`
+	Active      *bool            `json:"active"`
+	Password    *string          `json:"password"`
+}
+
+// scimUserState contains the attributes of a user that SCIM clients are able to change
+type scimUserState struct {
+	UserName    string
+	DisplayName string
+	Email       string
+	Locale      string
+	Active      bool
+	Password    *string
+}
+
+type scimPatchRequest struct {
+	Schemas    []string             `json:"schemas"`
+	Operations []scimPatchOperation `json:"Operations"`
+}
+
+type scimPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// scimError is a failed request, answered with a dtos.ScimError
+type scimError struct {
+	status   int
+	scimType string
+	detail   string
+}
+
+func (e *scimError) Error() string {
+	return e.detail
+}
+
+func newScimError(status int, scimType, format string, args ...interface{}) *scimError {
+	return &scimError{status: status, scimType: scimType, detail: fmt.Sprintf(format, args...)}
+}
+
+// scimUserAttrs are the filterable user attributes and whether they are case exact
+var scimUserAttrs = map[string]bool{
+	"id": true, "username": false, "displayname": false, "emails": false, "emails.value": false,
+	"locale": false, "active": false, "groups": true, "groups.value": true, "groups.display": true,
+	"meta.created": false, "meta.lastmodified": false,
+}
+
+// scimGroupAttrs are the filterable group attributes and whether they are case exact
+var scimGroupAttrs = map[string]bool{
+	"id": true, "displayname": false,
+}
+
+// scimRoles are the groups, in the order they are listed
+var scimRoles = []string{models.RoleAdmin, models.RoleOrgAdmin, models.RoleUser}
+
+// roles returns the groups visible to SCIM clients
+func (sc *ScimController) roles() []string {
+	if sc.AdminRoleAllowed {
+		return scimRoles
+	}
+	return scimRoles[1:]
+}
+
+// HandleScimAPI registers the SCIM endpoints onto the provided router, which should be mounted at BasePath
+func (sc *ScimController) HandleScimAPI(r *mux.Router) {
+	r.Use(sc.authenticate)
+	r.Path("/ServiceProviderConfig").Methods(http.MethodGet).HandlerFunc(sc.handleServiceProviderConfig)
+	r.Path("/ResourceTypes").Methods(http.MethodGet).HandlerFunc(sc.handleResourceTypes)
+	r.Path("/ResourceTypes/{name}").Methods(http.MethodGet).HandlerFunc(sc.handleResourceTypes)
+	r.Path("/Schemas").Methods(http.MethodGet).HandlerFunc(sc.handleSchemas)
+	r.Path("/Schemas/{id}").Methods(http.MethodGet).HandlerFunc(sc.handleSchemas)
+
+	r.Path("/Users").Methods(http.MethodGet).HandlerFunc(sc.handleListUsers)
+	r.Path("/Users").Methods(http.MethodPost).HandlerFunc(sc.handleCreateUser)
+	r.Path("/Users/{id}").Methods(http.MethodGet).HandlerFunc(sc.handleGetUser)
+	r.Path("/Users/{id}").Methods(http.MethodPut).HandlerFunc(sc.handleReplaceUser)
+	r.Path("/Users/{id}").Methods(http.MethodPatch).HandlerFunc(sc.handlePatchUser)
+	r.Path("/Users/{id}").Methods(http.MethodDelete).HandlerFunc(sc.handleDeleteUser)
+
+	r.Path("/Groups").Methods(http.MethodGet).HandlerFunc(sc.handleListGroups)
+	r.Path("/Groups/{id}").Methods(http.MethodGet).HandlerFunc(sc.handleGetGroup)
+	r.Path("/Groups/{id}").Methods(http.MethodPatch).HandlerFunc(sc.handlePatchGroup)
+	// groups are the fixed set of roles
+	r.Path("/Groups").Methods(http.MethodPost).HandlerFunc(sc.handleGroupsNotImplemented)
+	r.Path("/Groups/{id}").Methods(http.MethodPut, http.MethodDelete).HandlerFunc(sc.handleGroupsNotImplemented)
+	log.Println("registered scim-endpoint")
+}
+
+// authenticate only passes requests on, that carry the SCIM bearer token
+func (sc *ScimController) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		const authScheme = "Bearer "
+		header := r.Header.Get("Authorization")
+		h := sha256.Sum256([]byte(strings.TrimPrefix(header, authScheme)))
+		if !strings.HasPrefix(header, authScheme) || subtle.ConstantTimeCompare(h[:], sc.tokenHash) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="scim"`)
+			writeScimError(w, newScimError(http.StatusUnauthorized, "", "Authentication failed"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeScim sends v, which should be a SCIM type of the dtos-package
+func writeScim(w http.ResponseWriter, status int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		writeScimError(w, newScimError(http.StatusInternalServerError, "", "Could not format result"))
+		return
+	}
+	w.Header().Set("Content-Type", scimContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+func writeScimError(w http.ResponseWriter, err *scimError) {
+	b, _ := json.Marshal(dtos.ScimError{
+		Schemas:  []string{dtos.ScimSchemaError},
+		Status:   strconv.Itoa(err.status),
+		ScimType: err.scimType,
+		Detail:   err.detail,
+	})
+	w.Header().Set("Content-Type", scimContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+	if err.status == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", retryAfterSeconds)
+	}
+	w.WriteHeader(err.status)
+	w.Write(b)
+}
+
+// baseURL returns the absolute URL of the SCIM endpoints
+func (sc *ScimController) baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + sc.BasePath
+}
+
+// getUser loads a user that is visible to SCIM clients
+func (sc *ScimController) getUser(ctx context.Context, id string) (models.User, *scimError) {
+	user, err := sc.store.Get(ctx, id)
+	if err != nil && !errors.Is(err, stores.ErrNotFound) {
+		log.Printf("Could not retrieve user '%s'. Error: %v", id, err)
+		return models.User{}, newScimError(storeErrorStatus(err), "", "Could not retrieve user")
+	}
+	if err != nil || user.ID != id || user.Status == models.StatusDeleted {
+		return models.User{}, newScimError(http.StatusNotFound, "", "User '%s' not found", id)
+	}
+	return user, nil
+}
+
+func (sc *ScimController) writeUser(w http.ResponseWriter, r *http.Request, status int, user models.User) {
+	etag := userETag(user)
+	w.Header().Set("ETag", "W/"+etag)
+	writeScim(w, status, dtos.NewScimUser(user, sc.baseURL(r), etag))
+}
+
+// getListParams reads startIndex (1-based) and count of list requests
+func (sc *ScimController) getListParams(r *http.Request) (int64, int64, *scimError) {
+	v := r.URL.Query()
+	startIndex, count := int64(1), sc.MaxResults
+	var err error
+	if s := v.Get("startIndex"); s != "" {
+		if startIndex, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return 0, 0, newScimError(http.StatusBadRequest, "invalidValue", "startIndex must be a number")
+		}
+		if startIndex < 1 {
+			startIndex = 1
+		}
+	}
+	if s := v.Get("count"); s != "" {
+		if count, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return 0, 0, newScimError(http.StatusBadRequest, "invalidValue", "count must be a number")
+		}
+		if count < 0 {
+			count = 0
+		}
+		if count > sc.MaxResults {
+			count = sc.MaxResults
+		}
+	}
+	return startIndex, count, nil
+}
+
+func (sc *ScimController) handleListUsers(w http.ResponseWriter, r *http.Request) {
+	startIndex, count, serr := sc.getListParams(r)
+	if serr != nil {
+		writeScimError(w, serr)
+		return
+	}
+	var filter scimFilter
+	if f := r.URL.Query().Get("filter"); f != "" {
+		var err error
+		if filter, err = parseScimFilter(f, scimUserAttrs); err != nil {
+			writeScimError(w, newScimError(http.StatusBadRequest, "invalidFilter", "%v", err))
+			return
+		}
+	}
+	total, users, err := sc.findUsers(r.Context(), filter, startIndex, count)
+	if err != nil {
+		log.Printf("Could not list users. Error: %v", err)
+		writeScimError(w, newScimError(storeErrorStatus(err), "", "Could not retrieve result"))
+		return
+	}
+	base := sc.baseURL(r)
+	resources := make([]dtos.ScimUser, len(users))
+	for i, u := range users {
+		resources[i] = dtos.NewScimUser(u, base, userETag(u))
+	}
+	writeScim(w, http.StatusOK, dtos.ScimListResponse{
+		Schemas:      []string{dtos.ScimSchemaListResponse},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+// findUsers returns the amount of users matching the filter and the page of them
+// starting at startIndex (1-based). The store only narrows down the candidates,
+// filters it can not express are evaluated on every candidate.
+func (sc *ScimController) findUsers(ctx context.Context, filter scimFilter, startIndex, count int64) (int64, []models.User, error) {
+	q := scimUserQuery(filter)
+	if filter == nil {
+		total, err := sc.store.Count(ctx, q)
+		if err != nil || count == 0 {
+			return total, []models.User{}, err
+		}
+		q.Offset, q.Limit = startIndex-1, count
+		users, err := sc.store.Find(ctx, q)
+		return total, users, err
+	}
+	var total int64
+	users := []models.User{}
+	err := forEachUser(ctx, sc.store, q, func(u models.User) error {
+		if !filter.matches(scimUserAttr(u)) {
+			return nil
+		}
+		total++
+		if total >= startIndex && int64(len(users)) < count {
+			users = append(users, u)
+		}
+		return nil
+	})
+	return total, users, err
+}
+
+// forEachUser calls fn for all users matching q, reading them from the store page by page
+func forEachUser(ctx context.Context, store stores.UserStore, q stores.UserQuery, fn func(u models.User) error) error {
+	const pageSize = 500
+	q.After, q.Before, q.Offset, q.Limit = nil, nil, 0, pageSize
+	for {
+		users, err := store.Find(ctx, q)
+		if err != nil {
+			return err
+		}
+		for _, u := range users {
+			if err := fn(u); err != nil {
+				return err
+			}
+		}
+		if len(users) < pageSize {
+			return nil
+		}
+		q.After = stores.NewUserCursor(q.SortBy, users[len(users)-1])
+	}
+}
+
+// scimUserQuery creates a query returning all users that might match the filter.
+// Only the terms every match has to satisfy (joined by 'and') are used.
+func scimUserQuery(filter scimFilter) stores.UserQuery {
+	q := stores.UserQuery{Statuses: []string{models.StatusActive, models.StatusDisabled}}
+	var narrow func(f scimFilter)
+	narrow = func(f scimFilter) {
+		switch f := f.(type) {
+		case scimLogicalFilter:
+			if f.and {
+				narrow(f.left)
+				narrow(f.right)
+			}
+		case scimCompareFilter:
+			s, isString := f.Value.(string)
+			switch {
+			case f.Attr == "username" && (f.Op == "eq" || f.Op == "sw") && isString:
+				q.NamePrefix = s
+			case (f.Attr == "emails" || f.Attr == "emails.value") && f.Op == "eq" && isString:
+				q.Email = s
+			case f.Attr == "active" && f.Op == "eq":
+				if active, ok := f.Value.(bool); ok && active {
+					q.Statuses = []string{models.StatusActive}
+				} else if ok {
+					q.Statuses = []string{models.StatusDisabled}
+				}
+			case f.Attr == "meta.created" && (f.Op == "ge" || f.Op == "gt") && isString:
+				if t, err := time.Parse(time.RFC3339, s); err == nil {
+					q.CreatedFrom = t.Truncate(time.Second)
+				}
+			case f.Attr == "meta.created" && f.Op == "lt" && isString:
+				if t, err := time.Parse(time.RFC3339, s); err == nil {
+					q.CreatedUntil = t
+				}
+			}
+		}
+	}
+	if filter != nil {
+		narrow(filter)
+	}
+	return q
+}
+
+func scimUserAttr(u models.User) scimAttrGetter {
+	return func(attr string) interface{} {
+		switch attr {
+		case "id":
+			return u.ID
+		case "username":
+			return u.Name
+		case "displayname":
+			return u.DisplayName
+		case "emails", "emails.value":
+			return u.Email
+		case "locale":
+			return u.Locale
+		case "active":
+			return u.IsActive()
+		case "groups", "groups.value", "groups.display":
+			return u.Role
+		case "meta.created":
+			return u.CreatedAt
+		case "meta.lastmodified":
+			return u.UpdatedAt
+		}
+		return nil
+	}
+}
+
+func (sc *ScimController) handleGetUser(w http.ResponseWriter, r *http.Request) {
+	user, serr := sc.getUser(r.Context(), mux.Vars(r)["id"])
+	if serr != nil {
+		writeScimError(w, serr)
+		return
+	}
+	if notModified(w, r, userETag(user)) {
+		return
+	}
+	sc.writeUser(w, r, http.StatusOK, user)
+}
+
+func (sc *ScimController) handleCreateUser(w http.ResponseWriter, r *http.Request) {
+	var req scimUserWrite
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeScimError(w, newScimError(http.StatusBadRequest, "invalidSyntax", "Invalid request"))
+		return
+	}
+	user := models.User{Role: models.RoleUser}
+	if serr := sc.applyUserState(r.Context(), &user, req.state()); serr != nil {
+		writeScimError(w, serr)
+		return
+	}
+	user, err := sc.store.Insert(r.Context(), user)
+	if err != nil {
+		if errors.Is(err, stores.ErrConflict) {
+			writeScimError(w, newScimError(http.StatusConflict, "uniqueness", "userName already exists"))
+			return
+		}
+		log.Printf("Could not insert user. Error: %v", err)
+		writeScimError(w, newScimError(storeErrorStatus(err), "", "Could not create user"))
+		return
+	}
+	sc.audit(r, models.AuditUserCreated, user, "role "+user.Role)
+	w.Header().Set("Location", sc.baseURL(r)+"/Users/"+user.ID)
+	sc.writeUser(w, r, http.StatusCreated, user)
+}
+
+// audit records a successful change of SCIM clients, which act under the name "scim"
+func (sc *ScimController) audit(r *http.Request, action string, target models.User, details string) {
+	if sc.Audit == nil {
+		return
+	}
+	e := newAuditEvent(r, action, models.AuditSuccess)
+	e.ActorName = "scim"
+	e.TargetID, e.OrgID = target.ID, target.OrgID
+	e.Details = details
+	sc.Audit.Record(r.Context(), e)
+}
+
+func (req scimUserWrite) state() scimUserState {
+	s := scimUserState{
+		UserName:    req.UserName,
+		DisplayName: req.DisplayName,
+		Email:       primaryEmail(req.Emails),
+		Locale:      req.Locale,
+		Active:      req.Active == nil || *req.Active,
+		Password:    req.Password,
+	}
+	return s
+}
+
+// primaryEmail returns the email marked as primary, or the first one
+func primaryEmail(emails []dtos.ScimEmail) string {
+	for _, e := range emails {
+		if e.Primary {
+			return e.Value
+		}
+	}
+	if len(emails) > 0 {
+		return emails[0].Value
+	}
+	return ""
+}
+
+func scimStateFromUser(u models.User) scimUserState {
+	return scimUserState{
+		UserName:    u.Name,
+		DisplayName: u.DisplayName,
+		Email:       u.Email,
+		Locale:      u.Locale,
+		Active:      u.IsActive(),
+	}
+}
+
+// applyUserState validates s and applies it onto user
+func (sc *ScimController) applyUserState(ctx context.Context, user *models.User, s scimUserState) *scimError {
+	if !services.ValidUsername(s.UserName) {
+		return newScimError(http.StatusBadRequest, "invalidValue", "Invalid userName")
+	}
+	if s.UserName != user.Name {
+		if existing, err := sc.store.GetByName(ctx, s.UserName); err == nil && existing.ID != "" && existing.ID != user.ID {
+			return newScimError(http.StatusConflict, "uniqueness", "userName already exists")
+		}
+	}
+	if err := services.ValidateProfile(s.DisplayName, s.Email, s.Locale); err != nil {
+		return newScimError(http.StatusBadRequest, "invalidValue", "%v", err)
+	}
+	if s.Password != nil {
+		if err := sc.PasswordPolicy.Validate(s.UserName, *s.Password); err != nil {
+			return newScimError(http.StatusBadRequest, "invalidValue", "%v", err)
+		}
+		hash, err := sc.PasswordHasher.Hash([]byte(*s.Password))
+		if err != nil {
+			return newScimError(http.StatusInternalServerError, "", "Could not hash password")
+		}
+		user.Hash = hash
+	}
+	user.Name = s.UserName
+	user.DisplayName = strings.TrimSpace(s.DisplayName)
+	user.Email = s.Email
+	user.Locale = s.Locale
+	user.Status = models.StatusDisabled
+	if s.Active {
+		user.Status = models.StatusActive
+	}
+	return nil
+}
+
+// loadForUpdate loads the user of the request and applies the version of the optional If-Match header
+func (sc *ScimController) loadForUpdate(r *http.Request) (models.User, *scimError) {
+	user, serr := sc.getUser(r.Context(), mux.Vars(r)["id"])
+	if serr != nil {
+		return user, serr
+	}
+	if serr := sc.checkModifiable(user); serr != nil {
+		return user, serr
+	}
+	version, err := ifMatchVersion(r, user, false)
+	if err != nil {
+		return user, newScimError(http.StatusBadRequest, "invalidValue", "%v", err)
+	}
+	if version != user.Version {
+		return user, newScimError(http.StatusPreconditionFailed, "", "User was modified")
+	}
+	return user, nil
+}
+
+// checkModifiable rejects changes of platform admins, unless the admin role is allowed
+func (sc *ScimController) checkModifiable(user models.User) *scimError {
+	if user.Role == models.RoleAdmin && !sc.AdminRoleAllowed {
+		return newScimError(http.StatusForbidden, "", "User '%s' is an admin and can not be changed", user.ID)
+	}
+	return nil
+}
+
+// saveUser stores the modified user and answers with its new representation
+func (sc *ScimController) saveUser(w http.ResponseWriter, r *http.Request, before, user models.User) {
+	revokeTokensOnChange(before, &user)
+	if err := sc.store.Update(r.Context(), user); err != nil {
+		switch {
+		case errors.Is(err, stores.ErrNotFound):
+			writeScimError(w, newScimError(http.StatusNotFound, "", "User '%s' not found", user.ID))
+		case errors.Is(err, stores.ErrVersionConflict):
+			writeScimError(w, newScimError(http.StatusPreconditionFailed, "", "User was modified"))
+		case errors.Is(err, stores.ErrConflict):
+			writeScimError(w, newScimError(http.StatusConflict, "uniqueness", "userName already exists"))
+		default:
+			log.Printf("Could not update user '%s'. Error: %v", user.ID, err)
+			writeScimError(w, newScimError(storeErrorStatus(err), "", "Could not update user"))
+		}
+		return
+	}
+	sc.audit(r, models.AuditUserUpdated, user, changedFields(before, user))
+	user, err := sc.store.Get(r.Context(), user.ID)
+	if err != nil {
+		writeScimError(w, newScimError(storeErrorStatus(err), "", "Could not retrieve user"))
+		return
+	}
+	sc.writeUser(w, r, http.StatusOK, user)
+}
+
+func (sc *ScimController) handleReplaceUser(w http.ResponseWriter, r *http.Request) {
+	user, serr := sc.loadForUpdate(r)
+	if serr != nil {
+		writeScimError(w, serr)
+		return
+	}
+	before := user
+	var req scimUserWrite
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeScimError(w, newScimError(http.StatusBadRequest, "invalidSyntax", "Invalid request"))
+		return
+	}
+	if serr := sc.applyUserState(r.Context(), &user, req.state()); serr != nil {
+		writeScimError(w, serr)
+		return
+	}
+	sc.saveUser(w, r, before, user)
+}
+
+func (sc *ScimController) handlePatchUser(w http.ResponseWriter, r *http.Request) {
+	user, serr := sc.loadForUpdate(r)
+	if serr != nil {
+		writeScimError(w, serr)
+		return
+	}
+	before := user
+	req, serr := decodeScimPatch(r)
+	if serr != nil {
+		writeScimError(w, serr)
+		return
+	}
+	state := scimStateFromUser(user)
+	for _, op := range req.Operations {
+		if serr := patchUserState(&state, strings.ToLower(op.Op), op.Path, op.Value); serr != nil {
+			writeScimError(w, serr)
+			return
+		}
+	}
+	if serr := sc.applyUserState(r.Context(), &user, state); serr != nil {
+		writeScimError(w, serr)
+		return
+	}
+	sc.saveUser(w, r, before, user)
+}
+
+func decodeScimPatch(r *http.Request) (scimPatchRequest, *scimError) {
+	var req scimPatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return req, newScimError(http.StatusBadRequest, "invalidSyntax", "Invalid request")
+	}
+	for _, s := range req.Schemas {
+		if s == dtos.ScimSchemaPatchOp {
+			return req, nil
+		}
+	}
+	return req, newScimError(http.StatusBadRequest, "invalidSyntax", "Request must use the schema '%s'", dtos.ScimSchemaPatchOp)
+}
+
+// patchUserState applies a single PATCH operation. Attributes that are not stored are ignored.
+func patchUserState(s *scimUserState, op, path string, value json.RawMessage) *scimError {
+	if op != "add" && op != "replace" && op != "remove" {
+		return newScimError(http.StatusBadRequest, "invalidSyntax", "Unsupported operation '%s'", op)
+	}
+	if path == "" {
+		if op == "remove" {
+			return newScimError(http.StatusBadRequest, "noTarget", "remove requires a path")
+		}
+		var attrs map[string]json.RawMessage
+		if err := json.Unmarshal(value, &attrs); err != nil {
+			return newScimError(http.StatusBadRequest, "invalidValue", "Value must be an object if path is missing")
+		}
+		for attr, v := range attrs {
+			if serr := patchUserState(s, op, attr, v); serr != nil {
+				return serr
+			}
+		}
+		return nil
+	}
+	attr := scimAttrName(path)
+	// emails[type eq "work"].value, the single email is the one of every type
+	if strings.HasPrefix(attr, "emails[") {
+		attr = "emails.value"
+		if !strings.HasSuffix(path, "].value") {
+			attr = "emails"
+		}
+	}
+	if op == "remove" {
+		switch attr {
+		case "displayname":
+			s.DisplayName = ""
+		case "locale":
+			s.Locale = ""
+		case "emails", "emails.value":
+			s.Email = ""
+		case "username", "active", "password":
+			return newScimError(http.StatusBadRequest, "mutability", "%s can not be removed", path)
+		}
+		return nil
+	}
+	var err error
+	switch attr {
+	case "username":
+		err = json.Unmarshal(value, &s.UserName)
+	case "displayname":
+		err = json.Unmarshal(value, &s.DisplayName)
+	case "locale":
+		err = json.Unmarshal(value, &s.Locale)
+	case "emails.value":
+		err = json.Unmarshal(value, &s.Email)
+	case "emails":
+		var emails []dtos.ScimEmail
+		if err = json.Unmarshal(value, &emails); err == nil {
+			s.Email = primaryEmail(emails)
+		}
+	case "active":
+		s.Active, err = scimBool(value)
+	case "password":
+		var password string
+		if err = json.Unmarshal(value, &password); err == nil {
+			s.Password = &password
+		}
+	case "id", "meta", "groups":
+		return newScimError(http.StatusBadRequest, "mutability", "%s is read-only", path)
+	}
+	if err != nil {
+		return newScimError(http.StatusBadRequest, "invalidValue", "Invalid value for %s", path)
+	}
+	return nil
+}
+
+// scimBool accepts JSON booleans and, as some clients send them, strings of booleans
+func scimBool(value json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(value, &b); err == nil {
+		return b, nil
+	}
+	var s string
+	if err := json.Unmarshal(value, &s); err != nil {
+		return false, err
+	}
+	return strconv.ParseBool(s)
+}
+
+// handleDeleteUser marks the user as deleted, it is purged after the retention period
+func (sc *ScimController) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	user, serr := sc.loadForUpdate(r)
+	if serr != nil {
+		writeScimError(w, serr)
+		return
+	}
+	user.Status = models.StatusDeleted
+	user.DeletedAt = time.Now().UTC()
+	if err := sc.store.Update(r.Context(), user); err != nil {
+		switch {
+		case errors.Is(err, stores.ErrNotFound):
+			writeScimError(w, newScimError(http.StatusNotFound, "", "User '%s' not found", user.ID))
+		case errors.Is(err, stores.ErrVersionConflict):
+			writeScimError(w, newScimError(http.StatusPreconditionFailed, "", "User was modified"))
+		default:
+			log.Printf("Could not delete user '%s'. Error: %v", user.ID, err)
+			writeScimError(w, newScimError(storeErrorStatus(err), "", "Could not delete user"))
+		}
+		return
+	}
+	sc.audit(r, models.AuditUserDeleted, user, "")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (sc *ScimController) isRole(id string) bool {
+	for _, role := range sc.roles() {
+		if role == id {
+			return true
+		}
+	}
+	return false
+}
+
+// roleMembers returns all users with the role that are visible to SCIM clients
+func (sc *ScimController) roleMembers(ctx context.Context, role string) ([]models.User, error) {
+	members := []models.User{}
+	err := forEachUser(ctx, sc.store, stores.UserQuery{
+		Role:     role,
+		Statuses: []string{models.StatusActive, models.StatusDisabled},
+	}, func(u models.User) error {
+		members = append(members, u)
+		return nil
+	})
+	return members, err
+}
+
+// scimGroup creates the representation of a role, the members are left out if they are excluded by the request
+func (sc *ScimController) scimGroup(r *http.Request, role string) (dtos.ScimGroup, error) {
+	var members []models.User
+	excluded := strings.ToLower(r.URL.Query().Get("excludedAttributes"))
+	if !strings.Contains(excluded, "members") {
+		var err error
+		if members, err = sc.roleMembers(r.Context(), role); err != nil {
+			return dtos.ScimGroup{}, err
+		}
+	}
+	return dtos.NewScimGroup(role, members, sc.baseURL(r)), nil
+}
+
+func (sc *ScimController) handleListGroups(w http.ResponseWriter, r *http.Request) {
+	startIndex, count, serr := sc.getListParams(r)
+	if serr != nil {
+		writeScimError(w, serr)
+		return
+	}
+	var filter scimFilter
+	if f := r.URL.Query().Get("filter"); f != "" {
+		var err error
+		if filter, err = parseScimFilter(f, scimGroupAttrs); err != nil {
+			writeScimError(w, newScimError(http.StatusBadRequest, "invalidFilter", "%v", err))
+			return
+		}
+	}
+	var (
+		total  int64
+		groups = []dtos.ScimGroup{}
+	)
+	for _, role := range sc.roles() {
+		if filter != nil && !filter.matches(scimGroupAttr(role)) {
+			continue
+		}
+		total++
+		if total < startIndex || int64(len(groups)) >= count {
+			continue
+		}
+		g, err := sc.scimGroup(r, role)
+		if err != nil {
+			log.Printf("Could not list members of '%s'. Error: %v", role, err)
+			writeScimError(w, newScimError(storeErrorStatus(err), "", "Could not retrieve result"))
+			return
+		}
+		groups = append(groups, g)
+	}
+	writeScim(w, http.StatusOK, dtos.ScimListResponse{
+		Schemas:      []string{dtos.ScimSchemaListResponse},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(groups),
+		Resources:    groups,
+	})
+}
+
+func scimGroupAttr(role string) scimAttrGetter {
+	return func(attr string) interface{} {
+		switch attr {
+		case "id", "displayname":
+			return role
+		}
+		return nil
+	}
+}
+
+func (sc *ScimController) handleGetGroup(w http.ResponseWriter, r *http.Request) {
+	role := mux.Vars(r)["id"]
+	if !sc.isRole(role) {
+		writeScimError(w, newScimError(http.StatusNotFound, "", "Group '%s' not found", role))
+		return
+	}
+	g, err := sc.scimGroup(r, role)
+	if err != nil {
+		log.Printf("Could not list members of '%s'. Error: %v", role, err)
+		writeScimError(w, newScimError(storeErrorStatus(err), "", "Could not retrieve result"))
+		return
+	}
+	writeScim(w, http.StatusOK, g)
+}
+
+// handlePatchGroup changes the members of a role. Every user has exactly one role,
+// so adding a user to a group removes it from the other one.
+// Users removed from the admin group become users, nobody can be removed from the user group.
+func (sc *ScimController) handlePatchGroup(w http.ResponseWriter, r *http.Request) {
+	role := mux.Vars(r)["id"]
+	if role == models.RoleAdmin && !sc.AdminRoleAllowed {
+		writeScimError(w, newScimError(http.StatusForbidden, "", "Group '%s' can not be changed", role))
+		return
+	}
+	if !sc.isRole(role) {
+		writeScimError(w, newScimError(http.StatusNotFound, "", "Group '%s' not found", role))
+		return
+	}
+	req, serr := decodeScimPatch(r)
+	if serr != nil {
+		writeScimError(w, serr)
+		return
+	}
+	for _, op := range req.Operations {
+		if serr := sc.patchGroup(r, role, strings.ToLower(op.Op), op.Path, op.Value); serr != nil {
+			writeScimError(w, serr)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (sc *ScimController) patchGroup(r *http.Request, role, op, path string, value json.RawMessage) *scimError {
+	attr := scimAttrName(path)
+	if path == "" {
+		var attrs struct {
+			Members json.RawMessage `json:"members"`
+		}
+		if err := json.Unmarshal(value, &attrs); err != nil || attrs.Members == nil {
+			return newScimError(http.StatusBadRequest, "invalidValue", "Only members can be changed")
+		}
+		attr, value = "members", attrs.Members
+	}
+	var (
+		ids    []string
+		filter scimFilter
+	)
+	if strings.HasPrefix(attr, "members[") && strings.HasSuffix(attr, "]") {
+		// members[value eq "1"]
+		var err error
+		if filter, err = parseScimFilter(path[len("members["):len(path)-1], map[string]bool{"value": true}); err != nil {
+			return newScimError(http.StatusBadRequest, "invalidPath", "%v", err)
+		}
+		attr = "members"
+	}
+	if attr != "members" {
+		return newScimError(http.StatusBadRequest, "mutability", "Only members can be changed")
+	}
+	if value != nil && op != "remove" || filter == nil && op == "remove" {
+		var members []dtos.ScimGroupRef
+		if err := json.Unmarshal(value, &members); err != nil {
+			return newScimError(http.StatusBadRequest, "invalidValue", "members must be a list of references")
+		}
+		for _, m := range members {
+			ids = append(ids, m.Value)
+		}
+	}
+
+	switch op {
+	case "add":
+		return sc.setRoles(r, ids, role)
+	case "replace":
+		if role == models.RoleUser {
+			return sc.setRoles(r, ids, role)
+		}
+		current, err := sc.roleMembers(r.Context(), role)
+		if err != nil {
+			return newScimError(storeErrorStatus(err), "", "Could not retrieve members")
+		}
+		var removed []string
+		for _, u := range current {
+			if !containsID(ids, u.ID) {
+				removed = append(removed, u.ID)
+			}
+		}
+		if serr := sc.setRoles(r, removed, models.RoleUser); serr != nil {
+			return serr
+		}
+		return sc.setRoles(r, ids, role)
+	case "remove":
+		if role == models.RoleUser {
+			return newScimError(http.StatusBadRequest, "mutability", "Members can not be removed from '%s'", role)
+		}
+		if filter != nil {
+			current, err := sc.roleMembers(r.Context(), role)
+			if err != nil {
+				return newScimError(storeErrorStatus(err), "", "Could not retrieve members")
+			}
+			for _, u := range current {
+				id := u.ID
+				if filter.matches(func(string) interface{} { return id }) {
+					ids = append(ids, id)
+				}
+			}
+		}
+		return sc.setRoles(r, ids, models.RoleUser)
+	}
+	return newScimError(http.StatusBadRequest, "invalidSyntax", "Unsupported operation '%s'", op)
+}
+
+// setRoles changes the role of all specified users
+func (sc *ScimController) setRoles(r *http.Request, ids []string, role string) *scimError {
+	for _, id := range ids {
+		user, serr := sc.getUser(r.Context(), id)
+		if serr != nil && serr.status != http.StatusNotFound {
+			return serr
+		}
+		if serr != nil {
+			return newScimError(http.StatusBadRequest, "invalidValue", "Member '%s' not found", id)
+		}
+		if user.Role == role {
+			continue
+		}
+		if serr := sc.checkModifiable(user); serr != nil {
+			return serr
+		}
+		before := user
+		user.Role = role
+		if err := sc.store.Update(r.Context(), user); err != nil {
+			if errors.Is(err, stores.ErrVersionConflict) {
+				return newScimError(http.StatusConflict, "", "Member '%s' was modified concurrently", id)
+			}
+			log.Printf("Could not change role of user '%s'. Error: %v", id, err)
+			return newScimError(storeErrorStatus(err), "", "Could not update member '%s'", id)
+		}
+		sc.audit(r, models.AuditUserUpdated, user, changedFields(before, user))
+	}
+	return nil
+}
+
+func containsID(ids []string, id string) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (sc *ScimController) handleGroupsNotImplemented(w http.ResponseWriter, r *http.Request) {
+	writeScimError(w, newScimError(http.StatusNotImplemented, "", "Groups are the fixed set of roles '%s'", strings.Join(sc.roles(), "', '")))
+}
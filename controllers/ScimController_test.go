@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Kirides/simpleApi/dtos"
+	"github.com/Kirides/simpleApi/models"
+	"github.com/Kirides/simpleApi/stores"
+	"github.com/gorilla/mux"
+)
+
+func TestScimOrgClientCanNotGrantOrRevokeAdmin(t *testing.T) {
+	ctx := context.Background()
+	const token = "scim-token"
+	us := stores.NewMemoryUserStore()
+	insert := func(name, role, org string) models.User {
+		u, err := us.Insert(ctx, models.User{Name: name, Role: role, OrgID: org})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+	member := insert("member", models.RoleUser, "acme")
+	admin := insert("platformadmin", models.RoleAdmin, "acme")
+
+	sc := NewScimController(stores.NewTenantUserStore(us, "acme"), token)
+	sc.AdminRoleAllowed = false
+	r := mux.NewRouter()
+	sc.HandleScimAPI(r.PathPrefix(sc.BasePath).Subrouter())
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, sc.BasePath+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	addMember := func(id string) string {
+		return `{"schemas":["` + dtos.ScimSchemaPatchOp + `"],"Operations":[{"op":"add","path":"members","value":[{"value":"` + id + `"}]}]}`
+	}
+	role := func(id string) string {
+		u, err := us.Get(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u.Role
+	}
+
+	w := do(http.MethodGet, "/Groups", "")
+	var list struct {
+		Resources []dtos.ScimGroup `json:"Resources"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("listing groups returned %d %s", w.Code, w.Body)
+	}
+	for _, g := range list.Resources {
+		if g.ID == models.RoleAdmin {
+			t.Errorf("the admin group is listed")
+		}
+	}
+	if w := do(http.MethodGet, "/Groups/"+models.RoleAdmin, ""); w.Code != http.StatusNotFound {
+		t.Errorf("reading the admin group returned %d, expected %d", w.Code, http.StatusNotFound)
+	}
+
+	for _, op := range []string{"add", "replace"} {
+		body := strings.Replace(addMember(member.ID), `"add"`, `"`+op+`"`, 1)
+		if w := do(http.MethodPatch, "/Groups/"+models.RoleAdmin, body); w.Code != http.StatusForbidden {
+			t.Errorf("%s to the admin group returned %d, expected %d", op, w.Code, http.StatusForbidden)
+		}
+		if got := role(member.ID); got != models.RoleUser {
+			t.Fatalf("%s to the admin group changed the role to '%s'", op, got)
+		}
+	}
+
+	if w := do(http.MethodPatch, "/Groups/"+models.RoleOrgAdmin, addMember(admin.ID)); w.Code != http.StatusForbidden {
+		t.Errorf("demoting an admin returned %d, expected %d", w.Code, http.StatusForbidden)
+	}
+	if got := role(admin.ID); got != models.RoleAdmin {
+		t.Fatalf("demoting an admin changed the role to '%s'", got)
+	}
+	if w := do(http.MethodDelete, "/Users/"+admin.ID, ""); w.Code != http.StatusForbidden {
+		t.Errorf("deleting an admin returned %d, expected %d", w.Code, http.StatusForbidden)
+	}
+
+	if w := do(http.MethodPatch, "/Groups/"+models.RoleOrgAdmin, addMember(member.ID)); w.Code != http.StatusNoContent {
+		t.Fatalf("adding a member to '%s' returned %d %s", models.RoleOrgAdmin, w.Code, w.Body)
+	}
+	if got := role(member.ID); got != models.RoleOrgAdmin {
+		t.Errorf("role is '%s' after adding the member to '%s'", got, models.RoleOrgAdmin)
+	}
+}
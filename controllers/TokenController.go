@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,10 +10,9 @@ import (
 	"net/url"
 	"time"
 
-	"golang.org/x/crypto/bcrypt"
-
 	"github.com/Kirides/simpleApi/helpers"
 	"github.com/Kirides/simpleApi/models"
+	"github.com/Kirides/simpleApi/services"
 	"github.com/Kirides/simpleApi/stores"
 
 	jwt "github.com/dgrijalva/jwt-go"
@@ -24,6 +24,11 @@ type ApplicationClaims struct {
 	*jwt.StandardClaims
 	Scope    string `json:"scope,omitempty"`
 	Username string `json:"username,omitempty"`
+	Role     string `json:"role,omitempty"`
+	// Org is the organization (tenant) of the user
+	Org string `json:"org,omitempty"`
+	// Generation is the models.User.TokenGeneration at issuance, tokens of older generations are rejected
+	Generation int64 `json:"gen,omitempty"`
 }
 
 // TokenController ...
@@ -31,6 +36,11 @@ type TokenController struct {
 	jwtTokenSecret       []byte
 	DefaultTokenLifetime time.Duration
 	UserStore            stores.UserStore
+	PasswordHasher       services.PasswordHasher
+	// Audit records issued tokens and failed logins, if set
+	Audit *services.AuditLog
+	// Sessions records every issued token as session of its user, if set
+	Sessions stores.SessionStore
 }
 
 // ErrInvalidCredentials ...
@@ -42,6 +52,7 @@ func NewTokenController(secret []byte, userStore stores.UserStore) *TokenControl
 		jwtTokenSecret:       secret,
 		DefaultTokenLifetime: time.Minute * 10,
 		UserStore:            userStore,
+		PasswordHasher:       services.DefaultPasswordHasher(),
 	}
 	return tc
 }
@@ -67,8 +78,19 @@ func (tc *TokenController) jwtTokenHandler(w http.ResponseWriter, r *http.Reques
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	usr, err := tc.validateTokenRequest(r.Form)
+	usr, err := tc.validateTokenRequest(r.Context(), r.Form)
+	if errors.Is(err, stores.ErrUnavailable) {
+		log.Printf("Could not validate token request. Error: %v", err)
+		writeStoreError(w, err)
+		return
+	}
 	if err != nil {
+		if tc.Audit != nil {
+			e := newAuditEvent(r, models.AuditLoginFailed, models.AuditFailure)
+			e.ActorName = r.Form.Get("username")
+			e.Details = err.Error()
+			tc.Audit.Record(r.Context(), e)
+		}
 		http.Error(w, err.Error(), http.StatusForbidden)
 		return
 	}
@@ -87,7 +109,10 @@ func (tc *TokenController) jwtTokenHandler(w http.ResponseWriter, r *http.Reques
 			Subject:   usr.ID,
 			Id:        tokenID,
 		},
-		Username: usr.Name,
+		Username:   usr.Name,
+		Role:       usr.Role,
+		Org:        usr.OrgID,
+		Generation: usr.TokenGeneration,
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	tokenString, err := token.SignedString(tc.jwtTokenSecret)
@@ -95,6 +120,20 @@ func (tc *TokenController) jwtTokenHandler(w http.ResponseWriter, r *http.Reques
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	if tc.Sessions != nil {
+		if err := tc.Sessions.InsertSession(r.Context(), newSession(r, usr, tokenID, tokenTime, tc.DefaultTokenLifetime)); err != nil {
+			log.Printf("Could not store session of user '%s'. Error: %v", usr.ID, err)
+			writeStoreError(w, err)
+			return
+		}
+	}
+	if tc.Audit != nil {
+		e := newAuditEvent(r, models.AuditTokenIssued, models.AuditSuccess)
+		e.ActorID, e.ActorName = usr.ID, usr.Name
+		e.TargetID, e.OrgID = usr.ID, usr.OrgID
+		e.Details = "token " + tokenID
+		tc.Audit.Record(r.Context(), e)
+	}
 	tokenResponse, err := json.Marshal(map[string]interface{}{
 		"token_type":   "Bearer",
 		"access_token": tokenString,
@@ -108,23 +147,57 @@ func (tc *TokenController) jwtTokenHandler(w http.ResponseWriter, r *http.Reques
 	w.Write(tokenResponse)
 }
 
-func (tc *TokenController) validateTokenRequest(v url.Values) (models.User, error) {
+// newSession describes the device a token is issued to.
+// Clients can name it by the optional device field, otherwise it is derived from the User-Agent.
+func newSession(r *http.Request, usr models.User, tokenID string, issuedAt time.Time, lifetime time.Duration) models.Session {
+	device := services.TruncateDeviceName(r.Form.Get("device"))
+	if device == "" {
+		device = services.DeviceName(r.UserAgent())
+	}
+	issuedAt = issuedAt.UTC().Truncate(time.Second)
+	return models.Session{
+		ID:         tokenID,
+		UserID:     usr.ID,
+		Device:     device,
+		IP:         clientIP(r),
+		UserAgent:  r.UserAgent(),
+		CreatedAt:  issuedAt,
+		LastSeenAt: issuedAt,
+		ExpiresAt:  issuedAt.Add(lifetime),
+	}
+}
+
+func (tc *TokenController) validateTokenRequest(ctx context.Context, v url.Values) (models.User, error) {
 	switch v.Get("grant_type") {
 	case "password":
-		return tc.validateResourceTokenRequest(v)
+		return tc.validateResourceTokenRequest(ctx, v)
 	}
 	return models.User{}, fmt.Errorf("Invalid validation type '%s'", v.Get("grant_type"))
 }
 
-func (tc *TokenController) validateResourceTokenRequest(v url.Values) (models.User, error) {
-	usr, err := tc.UserStore.GetByName(v.Get("username"))
+func (tc *TokenController) validateResourceTokenRequest(ctx context.Context, v url.Values) (models.User, error) {
+	usr, err := tc.UserStore.GetByName(ctx, v.Get("username"))
+	if errors.Is(err, stores.ErrUnavailable) {
+		return models.User{}, err
+	}
+	pass := []byte(v.Get("password"))
 	if err != nil {
+		// unknown users take as long as wrong passwords
+		services.VerifyDummy(tc.PasswordHasher, pass)
 		return models.User{}, ErrInvalidCredentials
 	}
-	pass := v.Get("password")
 
-	if bcrypt.CompareHashAndPassword(usr.Hash, []byte(pass)) == nil {
-		return usr, nil
+	needsRehash, err := tc.PasswordHasher.Verify(usr.Hash, pass)
+	if err != nil {
+		return models.User{}, ErrInvalidCredentials
+	}
+	if !usr.IsActive() {
+		return models.User{}, services.ErrAccountDisabled
+	}
+	if needsRehash {
+		if usr, err = services.RehashPassword(ctx, tc.UserStore, tc.PasswordHasher, usr, pass); err != nil {
+			log.Printf("Could not upgrade password hash of user '%s'. Error: %v", usr.ID, err)
+		}
 	}
-	return models.User{}, ErrInvalidCredentials
+	return usr, nil
 }
@@ -1,12 +1,22 @@
 package controllers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"mime"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/Kirides/simpleApi/dtos"
+	"github.com/Kirides/simpleApi/models"
+	"github.com/Kirides/simpleApi/services"
 	"github.com/Kirides/simpleApi/stores"
 	"github.com/gorilla/mux"
 )
@@ -14,75 +24,729 @@ import (
 // UsersController ...
 type UsersController struct {
 	store            stores.UserStore
+	cursors          *signer
 	MaxUsersReturned int64
+	PasswordPolicy   *services.PasswordPolicy
+	PasswordHasher   services.PasswordHasher
+	// OrgStore is used to validate the org of users, if not set only models.DefaultOrgID is valid
+	OrgStore stores.OrgStore
+	// Avatars enables the profile pictures of users, if set
+	Avatars *services.AvatarService
+	// Invitations is used to export and remove the invitations of users, if set
+	Invitations stores.InvitationStore
+	// Audit records all changes of users, if set
+	Audit *services.AuditLog
+	// Sessions enables listing and revoking the sessions of the current user, if set
+	Sessions stores.SessionStore
+}
+
+// userWrite is the representation of a user accepted by POST, PUT and PATCH
+type userWrite struct {
+	Username string `json:"username"`
+	Role     string `json:"role,omitempty"`
+	// Org can only be changed by platform admins
+	Org      string  `json:"org,omitempty"`
+	Password *string `json:"password,omitempty"`
+	profileWrite
+}
+
+// profileWrite contains the fields users are allowed to change on their own
+type profileWrite struct {
+	DisplayName string `json:"display_name,omitempty"`
+	Email       string `json:"email,omitempty"`
+	Locale      string `json:"locale,omitempty"`
+}
+
+type passwordChange struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
 }
 
 // NewUsersController ...
 func NewUsersController(store stores.UserStore) *UsersController {
 	return &UsersController{
 		store:            store,
+		cursors:          newRandomSigner(),
 		MaxUsersReturned: 100,
+		PasswordPolicy:   services.NewPasswordPolicy(),
+		PasswordHasher:   services.DefaultPasswordHasher(),
 	}
 }
 
+// SetCursorSecret changes the key used for signing pagination cursors.
+// By default a random key is used, which invalidates all cursors on restart
+func (uc *UsersController) SetCursorSecret(secret []byte) {
+	uc.cursors = &signer{secret: secret}
+}
+
 // HandleUsersAPI registers the /users endpoint onto the provided router
 func (uc *UsersController) HandleUsersAPI(r *mux.Router) {
-	r.Path("/users").Methods(http.MethodGet).Handler(uc.handleUsers())
-	r.Path("/users/{id:[0-9]+}").Methods(http.MethodGet).Handler(uc.handleUserByID())
+	// listing and reading other users reveals their email and profile, everybody else only gets /users/me
+	r.Path("/users").Methods(http.MethodGet).Handler(requireUserManager(uc.handleUsers()))
+	r.Path("/users").Methods(http.MethodPost).Handler(requireUserManager(uc.handleCreateUser()))
+	r.Path("/users/import").Methods(http.MethodPost).Handler(requireUserManager(uc.handleImport()))
+	r.Path("/users/export").Methods(http.MethodGet).Handler(requireUserManager(uc.handleExport()))
+	r.Path("/users/me").Methods(http.MethodGet).Handler(uc.handleMe())
+	r.Path("/users/me").Methods(http.MethodPatch).Handler(uc.handlePatchMe())
+	r.Path("/users/me").Methods(http.MethodDelete).Handler(uc.handleDeleteMe())
+	r.Path("/users/me/export").Methods(http.MethodGet).Handler(uc.handleExportMe())
+	r.Path("/users/me/password").Methods(http.MethodPut).Handler(uc.handleChangePassword())
+	if uc.Avatars != nil {
+		r.Path("/users/me/avatar").Methods(http.MethodPut).Handler(uc.handlePutAvatar())
+		r.Path("/users/me/avatar").Methods(http.MethodDelete).Handler(uc.handleDeleteAvatar())
+	}
+	if uc.Sessions != nil {
+		r.Path("/users/me/sessions").Methods(http.MethodGet).Handler(uc.handleSessions())
+		r.Path("/users/me/sessions").Methods(http.MethodDelete).Handler(uc.handleRevokeOtherSessions())
+		r.Path("/users/me/sessions/{id}").Methods(http.MethodDelete).Handler(uc.handleRevokeSession())
+	}
+	r.Path("/users/{id:[0-9]+}").Methods(http.MethodGet).Handler(requireUserManager(uc.handleUserByID()))
+	r.Path("/users/{id:[0-9]+}").Methods(http.MethodPut).Handler(requireUserManager(uc.handleReplaceUser()))
+	r.Path("/users/{id:[0-9]+}").Methods(http.MethodPatch).Handler(requireUserManager(uc.handlePatchUser()))
+	r.Path("/users/{id:[0-9]+}").Methods(http.MethodDelete).Handler(requireUserManager(uc.handleSetStatus(models.StatusDeleted)))
+	r.Path("/users/{id:[0-9]+}/disable").Methods(http.MethodPost).Handler(requireUserManager(uc.handleSetStatus(models.StatusDisabled)))
+	r.Path("/users/{id:[0-9]+}/restore").Methods(http.MethodPost).Handler(requireUserManager(uc.handleSetStatus(models.StatusActive)))
+	r.Path("/users/{id:[0-9]+}/revoke-tokens").Methods(http.MethodPost).Handler(requireUserManager(uc.handleRevokeTokens()))
 	log.Println("registered users-endpoint")
 }
 
+// requireRole only passes requests on, whose token carries one of the specified roles
+func requireRole(next http.Handler, roles ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := models.PrincipalFromContext(r.Context())
+		if ok {
+			for _, role := range roles {
+				if p.Role == role {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+		}
+		w.WriteHeader(http.StatusForbidden)
+	})
+}
+
+// requireUserManager only passes requests on, whose caller is allowed to manage users
+func requireUserManager(next http.Handler) http.Handler {
+	return requireRole(next, models.RoleAdmin, models.RoleOrgAdmin)
+}
+
+// storeFor returns the users visible to the caller of the request.
+// Platform admins see all organizations, everybody else only their own.
+func (uc *UsersController) storeFor(r *http.Request) stores.UserStore {
+	p, _ := models.PrincipalFromContext(r.Context())
+	if p.Role == models.RoleAdmin {
+		return uc.store
+	}
+	return stores.NewTenantUserStore(uc.store, p.OrgID)
+}
+
+// canModify reports whether the caller of the request may change user.
+// Org admins can not change platform admins.
+func canModify(r *http.Request, user models.User) bool {
+	p, _ := models.PrincipalFromContext(r.Context())
+	return p.Role == models.RoleAdmin || user.Role != models.RoleAdmin
+}
+
 func (uc *UsersController) handleUserByID() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
-		user, err := uc.store.Get(vars["id"])
+		user, err := uc.storeFor(r).Get(r.Context(), vars["id"])
 		if err != nil {
-			w.WriteHeader(http.StatusNotFound)
+			writeStoreError(w, err)
 			return
 		}
-		b, err := json.Marshal(user)
-		if err != nil {
-			http.Error(w, "Could not format result", http.StatusInternalServerError)
+		if notModified(w, r, userETag(user)) {
 			return
 		}
-		w.Header().Set("Content-Type", "application/json")
-		w.Header().Set("Content-Length", strconv.Itoa(len(b)))
-		w.Write(b)
+		writeJSON(w, http.StatusOK, dtos.NewUser(user))
 	})
 }
 
 func (uc *UsersController) handleUsers() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		offset, err := getOffset(r)
+		query, err := uc.getUserQuery(r)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		limit, err := getLimit(r)
+		if query.Limit > uc.MaxUsersReturned {
+			query.Limit = uc.MaxUsersReturned
+		}
+		limit := query.Limit
+		// one more than requested tells us if there is another page
+		query.Limit++
+		store := uc.storeFor(r)
+		users, err := store.Find(r.Context(), query)
+		if err != nil {
+			log.Printf("Could not retrieve users. Error: %v", err)
+			writeStoreError(w, err)
+			return
+		}
+		hasMore := int64(len(users)) > limit
+		if hasMore {
+			if query.Before != nil {
+				users = users[1:]
+			} else {
+				users = users[:limit]
+			}
+		}
+		hasNext, hasPrev := hasMore, query.After != nil || query.Offset > 0
+		if query.Before != nil {
+			hasNext, hasPrev = true, hasMore
+		}
+		if len(users) > 0 {
+			var links []string
+			if hasPrev {
+				link, err := uc.pageLink(r, "before", "prev", query, users[0])
+				if err != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				links = append(links, link)
+			}
+			if hasNext {
+				link, err := uc.pageLink(r, "after", "next", query, users[len(users)-1])
+				if err != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				links = append(links, link)
+			}
+			if len(links) > 0 {
+				w.Header().Set("Link", strings.Join(links, ", "))
+			}
+		}
+		if countRequested, _ := strconv.ParseBool(r.URL.Query().Get("count")); countRequested {
+			total, err := store.Count(r.Context(), query)
+			if err != nil {
+				log.Printf("Could not count users. Error: %v", err)
+				writeStoreError(w, err)
+				return
+			}
+			w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+		}
+		w.Header().Set("Access-Control-Expose-Headers", "Link, X-Total-Count")
+		writeJSON(w, http.StatusOK, dtos.NewUsers(users))
+	})
+}
+
+// pageLink creates a RFC 8288 link to the page before or after the user
+func (uc *UsersController) pageLink(r *http.Request, param, rel string, q stores.UserQuery, u models.User) (string, error) {
+	c := stores.NewUserCursor(q.SortBy, u)
+	cursor, err := uc.cursors.encode(userCursor{
+		SortBy:   q.SortBy,
+		SortDesc: q.SortDesc,
+		Value:    c.Value,
+		ID:       c.ID,
+	})
+	if err != nil {
+		return "", err
+	}
+	v := r.URL.Query()
+	v.Del("offset")
+	v.Del("after")
+	v.Del("before")
+	v.Set(param, cursor)
+	link := url.URL{Path: r.URL.Path, RawQuery: v.Encode()}
+	return fmt.Sprintf(`<%s>; rel="%s"`, link.String(), rel), nil
+}
+
+// getUserQuery reads the filters of the users list from the query string:
+// name (prefix), email, role, org (only honoured for platform admins), status (comma separated, deleted users are excluded by default), created_from, created_until (RFC 3339), q (free-text search),
+// sort (one of stores.UserSortFields, prefixed by '-' for descending order),
+// after and before (cursors of the Link header), offset and limit
+func (uc *UsersController) getUserQuery(r *http.Request) (stores.UserQuery, error) {
+	v := r.URL.Query()
+	q := stores.UserQuery{
+		NamePrefix: v.Get("name"),
+		Email:      v.Get("email"),
+		Role:       v.Get("role"),
+		OrgID:      v.Get("org"),
+		Search:     strings.TrimSpace(v.Get("q")),
+		Statuses:   []string{models.StatusActive, models.StatusDisabled},
+	}
+	if status := v.Get("status"); status == "all" {
+		q.Statuses = nil
+	} else if status != "" {
+		q.Statuses = strings.Split(status, ",")
+		for _, s := range q.Statuses {
+			if s != models.StatusActive && s != models.StatusDisabled && s != models.StatusDeleted {
+				return q, fmt.Errorf("status must be 'all' or a list of '%s', '%s' and '%s'",
+					models.StatusActive, models.StatusDisabled, models.StatusDeleted)
+			}
+		}
+	}
+	var err error
+	if q.Offset, err = getOffset(r); err != nil {
+		return q, err
+	}
+	if q.Limit, err = getLimit(r); err != nil {
+		return q, err
+	}
+	if q.CreatedFrom, err = getTime(v.Get("created_from")); err != nil {
+		return q, fmt.Errorf("created_from must be a RFC 3339 timestamp")
+	}
+	if q.CreatedUntil, err = getTime(v.Get("created_until")); err != nil {
+		return q, fmt.Errorf("created_until must be a RFC 3339 timestamp")
+	}
+	if sort := v.Get("sort"); sort != "" {
+		if strings.HasPrefix(sort, "-") {
+			q.SortDesc = true
+			sort = sort[1:]
+		}
+		if !stores.IsUserSortField(sort) {
+			return q, fmt.Errorf("sort must be one of '%s'", strings.Join(stores.UserSortFields, "', '"))
+		}
+		q.SortBy = sort
+	}
+	for param, target := range map[string]**stores.UserCursor{"after": &q.After, "before": &q.Before} {
+		if v.Get(param) == "" {
+			continue
+		}
+		c, err := uc.cursors.decode(v.Get(param))
 		if err != nil {
+			return q, err
+		}
+		if c.SortBy != q.SortBy || c.SortDesc != q.SortDesc {
+			return q, fmt.Errorf("%s does not match the requested sort order", param)
+		}
+		*target = c.storeCursor()
+	}
+	if q.After != nil && q.Before != nil {
+		return q, fmt.Errorf("after and before can not be combined")
+	}
+	return q, nil
+}
+
+func getTime(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+func (uc *UsersController) handleCreateUser() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req userWrite
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		if req.Password == nil {
+			http.Error(w, "Password is required", http.StatusBadRequest)
+			return
+		}
+		user := models.User{}
+		if status, err := uc.applyUserWrite(r, &user, req); err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		user, err := uc.storeFor(r).Insert(r.Context(), user)
+		if err != nil {
+			log.Printf("Could not insert user. Error: %v", err)
+			writeStoreConflict(w, err, "Username already exists")
+			return
+		}
+		audit(uc.Audit, r, models.AuditUserCreated, models.AuditSuccess, user, "role "+user.Role)
+		w.Header().Set("Location", r.URL.Path+"/"+user.ID)
+		writeJSON(w, http.StatusCreated, dtos.NewUser(user))
+	})
+}
+
+func (uc *UsersController) handleReplaceUser() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := uc.storeFor(r).Get(r.Context(), mux.Vars(r)["id"])
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		if !checkIfMatch(w, r, &user, true) {
+			return
+		}
+		var req userWrite
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		uc.updateUser(w, r, user, req)
+	})
+}
+
+func (uc *UsersController) handlePatchUser() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); ct != mergePatchContentType && ct != "application/json" {
+			w.Header().Set("Accept-Patch", mergePatchContentType)
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		user, err := uc.storeFor(r).Get(r.Context(), mux.Vars(r)["id"])
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		if !checkIfMatch(w, r, &user, true) {
+			return
+		}
+		patch, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		current, err := json.Marshal(userWrite{
+			Username:     user.Name,
+			Role:         user.Role,
+			Org:          user.OrgID,
+			profileWrite: profileWriteFromUser(user),
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		patched, err := applyMergePatch(current, patch)
+		if err != nil {
+			http.Error(w, "Invalid merge patch", http.StatusBadRequest)
+			return
+		}
+		var req userWrite
+		if err := json.Unmarshal(patched, &req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		uc.updateUser(w, r, user, req)
+	})
+}
+
+func (uc *UsersController) updateUser(w http.ResponseWriter, r *http.Request, user models.User, req userWrite) {
+	before := user
+	if status, err := uc.applyUserWrite(r, &user, req); err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	revokeTokensOnChange(before, &user)
+	if err := uc.storeFor(r).Update(r.Context(), user); err != nil {
+		log.Printf("Could not update user '%s'. Error: %v", user.ID, err)
+		writeStoreConflict(w, err, "Username already exists")
+		return
+	}
+	// groups belong to an organization, users moved to another one leave them
+	if user.OrgID != before.OrgID && uc.OrgStore != nil {
+		if err := uc.OrgStore.RemoveUserMemberships(r.Context(), user.ID); err != nil {
+			log.Printf("Could not remove group memberships of user '%s'. Error: %v", user.ID, err)
+		}
+	}
+	audit(uc.Audit, r, models.AuditUserUpdated, models.AuditSuccess, user, changedFields(before, user))
+	user.Version++
+	w.Header().Set("ETag", userETag(user))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// revokeTokensOnChange invalidates all tokens of user if its password, role, organization or status
+// differs from before, so no token keeps privileges or credentials the user lost.
+func revokeTokensOnChange(before models.User, user *models.User) {
+	if string(before.Hash) != string(user.Hash) || before.Role != user.Role ||
+		before.OrgID != user.OrgID || before.Status != user.Status {
+		user.RevokeTokens()
+	}
+}
+
+// checkIfMatch applies the version of the If-Match header onto user,
+// so the store only updates the version the client has seen.
+// It returns false if the request has already been answered.
+func checkIfMatch(w http.ResponseWriter, r *http.Request, user *models.User, required bool) bool {
+	version, err := ifMatchVersion(r, *user, required)
+	if err != nil {
+		writeIfMatchError(w, err)
+		return false
+	}
+	if version != user.Version {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return false
+	}
+	user.Version = version
+	return true
+}
+
+// applyUserWrite validates req and applies it onto user.
+// On failure the HTTP status code that should be sent is returned.
+func (uc *UsersController) applyUserWrite(r *http.Request, user *models.User, req userWrite) (int, error) {
+	if !services.ValidUsername(req.Username) {
+		return http.StatusBadRequest, fmt.Errorf("Invalid username")
+	}
+	if req.Role == "" {
+		req.Role = models.RoleUser
+	}
+	if !services.ValidRole(req.Role) {
+		return http.StatusBadRequest, fmt.Errorf("Invalid role")
+	}
+	p, _ := models.PrincipalFromContext(r.Context())
+	if !canModify(r, *user) || p.Role != models.RoleAdmin && req.Role == models.RoleAdmin {
+		return http.StatusForbidden, fmt.Errorf("Only admins can manage admins")
+	}
+	if req.Org == "" {
+		req.Org = user.OrgID
+	}
+	if p.Role != models.RoleAdmin {
+		if req.Org != "" && req.Org != p.OrgID {
+			return http.StatusForbidden, fmt.Errorf("Only admins can assign other organizations")
+		}
+	} else if req.Org != "" && req.Org != user.OrgID {
+		if status, err := uc.checkOrg(r.Context(), req.Org); err != nil {
+			return status, err
+		}
+	}
+	// usernames are unique across all organizations
+	if req.Username != user.Name {
+		if existing, err := uc.store.GetByName(r.Context(), req.Username); err == nil && existing.ID != user.ID {
+			return http.StatusConflict, fmt.Errorf("Username already exists")
+		}
+	}
+	if err := validateProfile(req.profileWrite); err != nil {
+		return http.StatusBadRequest, err
+	}
+	if req.Password != nil {
+		if err := uc.PasswordPolicy.Validate(req.Username, *req.Password); err != nil {
+			return http.StatusBadRequest, err
+		}
+		hash, err := uc.PasswordHasher.Hash([]byte(*req.Password))
+		if err != nil {
+			return http.StatusInternalServerError, fmt.Errorf("Could not hash password")
+		}
+		user.Hash = hash
+	}
+	user.Name = req.Username
+	user.Role = req.Role
+	user.OrgID = req.Org
+	applyProfile(user, req.profileWrite)
+	return 0, nil
+}
+
+// checkOrg validates that the organization exists
+func (uc *UsersController) checkOrg(ctx context.Context, orgID string) (int, error) {
+	if uc.OrgStore == nil {
+		if orgID != models.DefaultOrgID {
+			return http.StatusBadRequest, fmt.Errorf("Invalid org")
+		}
+		return 0, nil
+	}
+	if _, err := uc.OrgStore.GetOrg(ctx, orgID); err != nil {
+		if errors.Is(err, stores.ErrNotFound) {
+			return http.StatusBadRequest, fmt.Errorf("Invalid org")
+		}
+		return storeErrorStatus(err), fmt.Errorf("Could not check org")
+	}
+	return 0, nil
+}
+
+func validateProfile(p profileWrite) error {
+	return services.ValidateProfile(p.DisplayName, p.Email, p.Locale)
+}
+
+func profileWriteFromUser(u models.User) profileWrite {
+	return profileWrite{
+		DisplayName: u.DisplayName,
+		Email:       u.Email,
+		Locale:      u.Locale,
+	}
+}
+
+func applyProfile(u *models.User, p profileWrite) {
+	u.DisplayName = strings.TrimSpace(p.DisplayName)
+	u.Email = p.Email
+	u.Locale = p.Locale
+}
+
+// currentUser loads the user the request was authenticated for
+func (uc *UsersController) currentUser(r *http.Request) (models.User, error) {
+	p, ok := models.PrincipalFromContext(r.Context())
+	if !ok {
+		return models.User{}, stores.ErrNotFound
+	}
+	return uc.store.Get(r.Context(), p.ID)
+}
+
+func (uc *UsersController) handleMe() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := uc.currentUser(r)
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		if notModified(w, r, userETag(user)) {
+			return
+		}
+		writeJSON(w, http.StatusOK, dtos.NewUser(user))
+	})
+}
+
+func (uc *UsersController) handlePatchMe() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); ct != mergePatchContentType && ct != "application/json" {
+			w.Header().Set("Accept-Patch", mergePatchContentType)
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		user, err := uc.currentUser(r)
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		if !checkIfMatch(w, r, &user, false) {
+			return
+		}
+		patch, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		current, err := json.Marshal(profileWriteFromUser(user))
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		patched, err := applyMergePatch(current, patch)
+		if err != nil {
+			http.Error(w, "Invalid merge patch", http.StatusBadRequest)
+			return
+		}
+		var req profileWrite
+		if err := json.Unmarshal(patched, &req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		if err := validateProfile(req); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		if limit > uc.MaxUsersReturned {
-			limit = uc.MaxUsersReturned
+		before := user
+		applyProfile(&user, req)
+		if err := uc.store.Update(r.Context(), user); err != nil {
+			log.Printf("Could not update user '%s'. Error: %v", user.ID, err)
+			writeStoreError(w, err)
+			return
 		}
-		users, err := uc.store.GetPage(offset, limit)
+		audit(uc.Audit, r, models.AuditUserUpdated, models.AuditSuccess, user, changedFields(before, user))
+		uc.writeMe(w, r, user.ID)
+	})
+}
+
+func (uc *UsersController) handleChangePassword() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := uc.currentUser(r)
 		if err != nil {
-			http.Error(w, "Could not retrieve result", http.StatusBadRequest)
+			writeStoreError(w, err)
+			return
+		}
+		var req passwordChange
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
 			return
 		}
-		if len(users) == 0 {
-			w.WriteHeader(http.StatusNotFound)
+		if _, err := uc.PasswordHasher.Verify(user.Hash, []byte(req.CurrentPassword)); err != nil {
+			audit(uc.Audit, r, models.AuditPasswordChanged, models.AuditFailure, user, "invalid current password")
+			http.Error(w, "Invalid current password", http.StatusForbidden)
 			return
 		}
-		b, err := json.Marshal(users)
+		if err := uc.PasswordPolicy.Validate(user.Name, req.NewPassword); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		hash, err := uc.PasswordHasher.Hash([]byte(req.NewPassword))
 		if err != nil {
-			http.Error(w, "Could not format result", http.StatusNotFound)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		user.Hash = hash
+		// the token of the request is revoked as well, the client has to sign in again
+		user.RevokeTokens()
+		if err := uc.store.Update(r.Context(), user); err != nil {
+			log.Printf("Could not update password of user '%s'. Error: %v", user.ID, err)
+			writeStoreError(w, err)
+			return
+		}
+		audit(uc.Audit, r, models.AuditPasswordChanged, models.AuditSuccess, user, "")
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// statusAuditActions are the audit actions of the status changes
+var statusAuditActions = map[string]string{
+	models.StatusActive:   models.AuditUserRestored,
+	models.StatusDisabled: models.AuditUserDisabled,
+	models.StatusDeleted:  models.AuditUserDeleted,
+}
+
+// handleSetStatus changes the status of a user. Deleting a user only marks it as deleted,
+// it is removed permanently by the services.UserPurger after the retention period.
+func (uc *UsersController) handleSetStatus(status string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+		store := uc.storeFor(r)
+		user, err := store.Get(r.Context(), id)
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		if !canModify(r, user) {
+			http.Error(w, "Only admins can manage admins", http.StatusForbidden)
+			return
+		}
+		// DELETE requires If-Match, the other transitions only honour it
+		if !checkIfMatch(w, r, &user, status == models.StatusDeleted) {
+			return
+		}
+		if p, _ := models.PrincipalFromContext(r.Context()); p.ID == user.ID && status != models.StatusActive {
+			http.Error(w, "You can not disable your own account", http.StatusConflict)
+			return
+		}
+		if user.Status != status {
+			user.Status = status
+			user.DeletedAt = time.Time{}
+			if status == models.StatusDeleted {
+				user.DeletedAt = time.Now().UTC()
+			}
+			// restoring a user must not revive the tokens issued before
+			user.RevokeTokens()
+			if err := store.Update(r.Context(), user); err != nil {
+				log.Printf("Could not change status of user '%s'. Error: %v", id, err)
+				writeStoreError(w, err)
+				return
+			}
+			audit(uc.Audit, r, statusAuditActions[status], models.AuditSuccess, user, "")
+			user.Version++
+		}
+		w.Header().Set("ETag", userETag(user))
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// handleRevokeTokens invalidates all tokens issued to a user so far, e.g. when the account is compromised
+func (uc *UsersController) handleRevokeTokens() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+		store := uc.storeFor(r)
+		user, err := store.Get(r.Context(), id)
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		if !canModify(r, user) {
+			http.Error(w, "Only admins can manage admins", http.StatusForbidden)
+			return
+		}
+		if !checkIfMatch(w, r, &user, false) {
+			return
+		}
+		user.RevokeTokens()
+		if err := store.Update(r.Context(), user); err != nil {
+			log.Printf("Could not revoke tokens of user '%s'. Error: %v", id, err)
+			writeStoreError(w, err)
 			return
 		}
-		w.Header().Set("Content-Type", "application/json")
-		w.Header().Set("Content-Length", strconv.Itoa(len(b)))
-		w.Write(b)
+		audit(uc.Audit, r, models.AuditTokensRevoked, models.AuditSuccess, user, "")
+		user.Version++
+		w.Header().Set("ETag", userETag(user))
+		w.WriteHeader(http.StatusNoContent)
 	})
 }
 
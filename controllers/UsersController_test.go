@@ -0,0 +1,120 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/Kirides/simpleApi/dtos"
+	"github.com/Kirides/simpleApi/models"
+	"github.com/Kirides/simpleApi/stores"
+	"github.com/gorilla/mux"
+)
+
+func TestUsersAreOnlyReadByUserManagers(t *testing.T) {
+	us := stores.NewMemoryUserStore()
+	member := insertUser(t, us, "member", models.RoleUser, "acme")
+	manager := insertUser(t, us, "manager", models.RoleOrgAdmin, "acme")
+	outsider := insertUser(t, us, "outsider", models.RoleUser, models.DefaultOrgID)
+	admin := insertUser(t, us, "admin", models.RoleAdmin, models.DefaultOrgID)
+
+	r := mux.NewRouter()
+	NewUsersController(us).HandleUsersAPI(r)
+	for _, c := range []struct {
+		caller models.User
+		path   string
+		want   int
+	}{
+		{member, "/users", http.StatusForbidden},
+		{member, "/users/" + manager.ID, http.StatusForbidden},
+		{member, "/users/me", http.StatusOK},
+		{manager, "/users/" + member.ID, http.StatusOK},
+		{manager, "/users/" + outsider.ID, http.StatusNotFound},
+		{admin, "/users/" + member.ID, http.StatusOK},
+	} {
+		if w := serveAs(r, principalOf(c.caller), http.MethodGet, c.path, ""); w.Code != c.want {
+			t.Errorf("GET %s as %s returned %d, expected %d", c.path, c.caller.Name, w.Code, c.want)
+		}
+	}
+
+	// org admins only see the users of their organization
+	for _, c := range []struct {
+		caller models.User
+		want   string
+	}{
+		{manager, "manager member"},
+		{admin, "admin manager member outsider"},
+	} {
+		w := serveAs(r, principalOf(c.caller), http.MethodGet, "/users", "")
+		var users []dtos.User
+		if err := json.Unmarshal(w.Body.Bytes(), &users); err != nil {
+			t.Fatalf("listing users as %s returned %d %s", c.caller.Name, w.Code, w.Body)
+		}
+		var names []string
+		for _, u := range users {
+			names = append(names, u.Username)
+		}
+		sort.Strings(names)
+		if got := strings.Join(names, " "); got != c.want {
+			t.Errorf("listing users as %s returned %s, expected %s", c.caller.Name, got, c.want)
+		}
+	}
+}
+
+// conflictingUserStore fails every update as if the user was modified concurrently
+type conflictingUserStore struct {
+	stores.UserStore
+}
+
+func (conflictingUserStore) Update(ctx context.Context, u models.User) error {
+	return stores.ErrVersionConflict
+}
+
+func TestUserUpdatesCheckIfMatch(t *testing.T) {
+	us := stores.NewMemoryUserStore()
+	member := insertUser(t, us, "member", models.RoleUser, "acme")
+	manager := insertUser(t, us, "manager", models.RoleOrgAdmin, "acme")
+	current, stale := userETag(member), `"0"`
+	replace := `{"username":"member","role":"user","org":"acme"}`
+
+	r := mux.NewRouter()
+	NewUsersController(us).HandleUsersAPI(r)
+	as := principalOf(manager)
+	for _, c := range []struct {
+		method, path, body string
+		headers            []string
+		want               int
+	}{
+		{http.MethodPut, "/users/" + member.ID, replace, nil, http.StatusPreconditionRequired},
+		{http.MethodPut, "/users/" + member.ID, replace, []string{"If-Match", stale}, http.StatusPreconditionFailed},
+		{http.MethodPatch, "/users/" + member.ID, `{"display_name":"M"}`, []string{"If-Match", stale, "Content-Type", mergePatchContentType}, http.StatusPreconditionFailed},
+		{http.MethodDelete, "/users/" + member.ID, "", nil, http.StatusPreconditionRequired},
+		{http.MethodPost, "/users/" + member.ID + "/disable", "", []string{"If-Match", stale}, http.StatusPreconditionFailed},
+		{http.MethodPost, "/users/" + member.ID + "/revoke-tokens", "", []string{"If-Match", stale}, http.StatusPreconditionFailed},
+		{http.MethodPut, "/users/" + member.ID, replace, []string{"If-Match", current}, http.StatusNoContent},
+		// the ETag of the first update is outdated afterwards
+		{http.MethodPut, "/users/" + member.ID, replace, []string{"If-Match", current}, http.StatusPreconditionFailed},
+	} {
+		if w := serveAs(r, as, c.method, c.path, c.body, c.headers...); w.Code != c.want {
+			t.Errorf("%s %s with %v returned %d, expected %d", c.method, c.path, c.headers, w.Code, c.want)
+		}
+	}
+
+	// the user may change between reading and updating it
+	r = mux.NewRouter()
+	NewUsersController(conflictingUserStore{us}).HandleUsersAPI(r)
+	for _, c := range []struct {
+		method, path, body string
+		headers            []string
+	}{
+		{http.MethodPatch, "/users/me", `{"display_name":"M"}`, []string{"Content-Type", mergePatchContentType}},
+		{http.MethodPost, "/users/" + member.ID + "/revoke-tokens", "", nil},
+	} {
+		if w := serveAs(r, as, c.method, c.path, c.body, c.headers...); w.Code != http.StatusPreconditionFailed {
+			t.Errorf("%s %s of a concurrently modified user returned %d, expected %d", c.method, c.path, w.Code, http.StatusPreconditionFailed)
+		}
+	}
+}
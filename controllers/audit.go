@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Kirides/simpleApi/models"
+	"github.com/Kirides/simpleApi/services"
+)
+
+// clientIP returns the address of the client without its port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// newAuditEvent creates an event of the request with the principal, if any, as actor
+func newAuditEvent(r *http.Request, action, outcome string) models.AuditEvent {
+	e := models.AuditEvent{
+		Action:    action,
+		Outcome:   outcome,
+		IP:        clientIP(r),
+		UserAgent: r.UserAgent(),
+		RequestID: models.RequestIDFromContext(r.Context()),
+	}
+	if p, ok := models.PrincipalFromContext(r.Context()); ok {
+		e.ActorID = p.ID
+		e.ActorName = p.Name
+		e.OrgID = p.OrgID
+	}
+	return e
+}
+
+// audit records an event of the request that affected target.
+// Pass a zero models.User for events without a target.
+func audit(l *services.AuditLog, r *http.Request, action, outcome string, target models.User, details string) {
+	if l == nil {
+		return
+	}
+	e := newAuditEvent(r, action, outcome)
+	if target.ID != "" {
+		e.TargetID = target.ID
+		e.OrgID = target.OrgID
+	}
+	e.Details = details
+	l.Record(r.Context(), e)
+}
+
+// changedFields lists the names of the fields that differ between before and after, for audit details
+func changedFields(before, after models.User) string {
+	var changed []string
+	for _, f := range []struct {
+		name          string
+		before, after string
+	}{
+		{"username", before.Name, after.Name},
+		{"password", string(before.Hash), string(after.Hash)},
+		{"role", before.Role, after.Role},
+		{"org", before.OrgID, after.OrgID},
+		{"display_name", before.DisplayName, after.DisplayName},
+		{"email", before.Email, after.Email},
+		{"locale", before.Locale, after.Locale},
+		{"avatar", before.Avatar, after.Avatar},
+		{"status", before.Status, after.Status},
+		{"tokens", strconv.FormatInt(before.TokenGeneration, 10), strconv.FormatInt(after.TokenGeneration, 10)},
+	} {
+		if f.before != f.after {
+			changed = append(changed, f.name)
+		}
+	}
+	if len(changed) == 0 {
+		return "nothing changed"
+	}
+	return "changed " + strings.Join(changed, ", ")
+}
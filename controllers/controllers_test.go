@@ -0,0 +1,39 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Kirides/simpleApi/models"
+	"github.com/Kirides/simpleApi/stores"
+)
+
+// serveAs sends a request authenticated as p to h, headers are given as name/value pairs
+func serveAs(h http.Handler, p models.Principal, method, path, body string, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req = req.WithContext(context.WithValue(req.Context(), models.KeyPrincipal, p))
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+// principalOf returns the principal of a token issued to u
+func principalOf(u models.User) models.Principal {
+	return models.Principal{ID: u.ID, Name: u.Name, Role: u.Role, OrgID: u.OrgID, TokenID: "token-" + u.ID}
+}
+
+// insertUser inserts a user with the role into the organization
+func insertUser(t *testing.T, us stores.UserStore, name, role, org string) models.User {
+	t.Helper()
+	u, err := us.Insert(context.Background(), models.User{Name: name, Role: role, OrgID: org, Email: name + "@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/Kirides/simpleApi/stores"
+)
+
+// ErrInvalidCursor is returned for cursors that were modified or not issued by us
+var ErrInvalidCursor = errors.New("Invalid cursor")
+
+// userCursor is the payload of the opaque cursors handed out to clients
+type userCursor struct {
+	SortBy   string `json:"s,omitempty"`
+	SortDesc bool   `json:"d,omitempty"`
+	Value    string `json:"v"`
+	ID       string `json:"i"`
+}
+
+// signer signs opaque values handed out to clients, e.g. cursors and invitation links,
+// so clients can not forge them
+type signer struct {
+	secret []byte
+}
+
+func newRandomSigner() *signer {
+	secret := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, secret); err != nil {
+		panic(err)
+	}
+	return &signer{secret: secret}
+}
+
+func (s *signer) mac(payload []byte) []byte {
+	m := hmac.New(sha256.New, s.secret)
+	m.Write(payload)
+	return m.Sum(nil)
+}
+
+// seal returns the URL-safe, signed representation of payload
+func (s *signer) seal(payload []byte) string {
+	return base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(s.mac(payload))
+}
+
+// open verifies a value created by seal and returns its payload
+func (s *signer) open(sealed string) ([]byte, bool) {
+	i := strings.IndexByte(sealed, '.')
+	if i < 0 {
+		return nil, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(sealed[:i])
+	if err != nil {
+		return nil, false
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(sealed[i+1:])
+	if err != nil || !hmac.Equal(signature, s.mac(payload)) {
+		return nil, false
+	}
+	return payload, true
+}
+
+// encode returns the opaque, signed representation of c
+func (s *signer) encode(c userCursor) (string, error) {
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return s.seal(payload), nil
+}
+
+// decode verifies and decodes a cursor created by encode
+func (s *signer) decode(sealed string) (userCursor, error) {
+	var c userCursor
+	payload, ok := s.open(sealed)
+	if !ok {
+		return c, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+func (c userCursor) storeCursor() *stores.UserCursor {
+	return &stores.UserCursor{Value: c.Value, ID: c.ID}
+}
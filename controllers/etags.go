@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Kirides/simpleApi/models"
+)
+
+var (
+	errPreconditionRequired = errors.New("If-Match header is required")
+	errInvalidETag          = errors.New("Invalid If-Match header")
+)
+
+// userETag returns the strong entity-tag of the current version of a user
+func userETag(u models.User) string {
+	return `"` + strconv.FormatInt(u.Version, 10) + `"`
+}
+
+// etagListContains reports whether a If-Match or If-None-Match header contains etag.
+// Weak entity-tags (W/"...") are compared like strong ones.
+func etagListContains(header, etag string) bool {
+	for _, e := range strings.Split(header, ",") {
+		e = strings.TrimPrefix(strings.TrimSpace(e), "W/")
+		if e == "*" || e == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified answers with 304 Not Modified if the client already has the current version
+func notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+	if inm := r.Header.Get("If-None-Match"); inm != "" && etagListContains(inm, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// ifMatchVersion returns the user version the client expects to modify.
+// A '*' matches the current version of the user. If the header is missing
+// and not required, current is returned as well.
+func ifMatchVersion(r *http.Request, current models.User, required bool) (int64, error) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		if required {
+			return 0, errPreconditionRequired
+		}
+		return current.Version, nil
+	}
+	if header == "*" {
+		return current.Version, nil
+	}
+	if strings.Contains(header, ",") {
+		// a list of entity-tags can only match if it contains the current one
+		if etagListContains(header, userETag(current)) {
+			return current.Version, nil
+		}
+		return 0, nil
+	}
+	tag := strings.TrimPrefix(header, "W/")
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, errInvalidETag
+	}
+	version, err := strconv.ParseInt(tag[1:len(tag)-1], 10, 64)
+	if err != nil {
+		// not one of ours, so it can never match
+		return 0, nil
+	}
+	return version, nil
+}
+
+// writeIfMatchError sends the status for errors of ifMatchVersion
+func writeIfMatchError(w http.ResponseWriter, err error) {
+	if err == errPreconditionRequired {
+		http.Error(w, err.Error(), http.StatusPreconditionRequired)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
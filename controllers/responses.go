@@ -0,0 +1,63 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Kirides/simpleApi/dtos"
+	"github.com/Kirides/simpleApi/stores"
+)
+
+// writeJSON sends v, which should be a type of the dtos-package, as JSON
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, "Could not format result", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+	w.Header().Set(dtos.APIVersionHeader, dtos.APIVersion)
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+// retryAfterSeconds is suggested to clients whose request failed because a store was unavailable
+const retryAfterSeconds = "5"
+
+// storeErrorStatus maps the errors of the stores package to HTTP status codes,
+// unknown errors are internal server errors
+func storeErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, stores.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, stores.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, stores.ErrVersionConflict):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, stores.ErrUnavailable):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// writeStoreError answers a request that failed because of a store, see storeErrorStatus.
+// Clients are asked to retry requests that failed because the store was unavailable.
+func writeStoreError(w http.ResponseWriter, err error) {
+	status := storeErrorStatus(err)
+	if status == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", retryAfterSeconds)
+	}
+	w.WriteHeader(status)
+}
+
+// writeStoreConflict is writeStoreError, which explains a conflict by message
+func writeStoreConflict(w http.ResponseWriter, err error, message string) {
+	if storeErrorStatus(err) == http.StatusConflict {
+		http.Error(w, message, http.StatusConflict)
+		return
+	}
+	writeStoreError(w, err)
+}
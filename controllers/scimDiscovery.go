@@ -0,0 +1,172 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/Kirides/simpleApi/dtos"
+	"github.com/gorilla/mux"
+)
+
+func (sc *ScimController) handleServiceProviderConfig(w http.ResponseWriter, r *http.Request) {
+	writeScim(w, http.StatusOK, dtos.ScimServiceProviderConfig{
+		Schemas:        []string{dtos.ScimSchemaServiceProviderConfig},
+		Patch:          dtos.ScimSupported{Supported: true},
+		Bulk:           dtos.ScimBulkSupport{Supported: false},
+		Filter:         dtos.ScimFilterSupport{Supported: true, MaxResults: int(sc.MaxResults)},
+		ChangePassword: dtos.ScimSupported{Supported: true},
+		Sort:           dtos.ScimSupported{Supported: false},
+		ETag:           dtos.ScimSupported{Supported: true},
+		AuthenticationSchemes: []dtos.ScimAuthentication{{
+			Type:        "oauthbearertoken",
+			Name:        "Bearer Token",
+			Description: "Authentication using the token configured by -scim-token",
+			Primary:     true,
+		}},
+		Meta: dtos.ScimMeta{
+			ResourceType: "ServiceProviderConfig",
+			Location:     sc.baseURL(r) + "/ServiceProviderConfig",
+		},
+	})
+}
+
+func (sc *ScimController) scimResourceTypes(r *http.Request) []dtos.ScimResourceType {
+	base := sc.baseURL(r)
+	return []dtos.ScimResourceType{
+		{
+			Schemas:     []string{dtos.ScimSchemaResourceType},
+			ID:          "User",
+			Name:        "User",
+			Endpoint:    "/Users",
+			Description: "User Account",
+			Schema:      dtos.ScimSchemaUser,
+			Meta:        dtos.ScimMeta{ResourceType: "ResourceType", Location: base + "/ResourceTypes/User"},
+		},
+		{
+			Schemas:     []string{dtos.ScimSchemaResourceType},
+			ID:          "Group",
+			Name:        "Group",
+			Endpoint:    "/Groups",
+			Description: "Role of users",
+			Schema:      dtos.ScimSchemaGroup,
+			Meta:        dtos.ScimMeta{ResourceType: "ResourceType", Location: base + "/ResourceTypes/Group"},
+		},
+	}
+}
+
+func (sc *ScimController) handleResourceTypes(w http.ResponseWriter, r *http.Request) {
+	types := sc.scimResourceTypes(r)
+	name, single := mux.Vars(r)["name"]
+	if !single {
+		writeScim(w, http.StatusOK, dtos.ScimListResponse{
+			Schemas:      []string{dtos.ScimSchemaListResponse},
+			TotalResults: int64(len(types)),
+			StartIndex:   1,
+			ItemsPerPage: len(types),
+			Resources:    types,
+		})
+		return
+	}
+	for _, t := range types {
+		if t.ID == name {
+			writeScim(w, http.StatusOK, t)
+			return
+		}
+	}
+	writeScimError(w, newScimError(http.StatusNotFound, "", "Resource type '%s' not found", name))
+}
+
+// scimAttr creates the definition of a single-valued attribute that is returned by default
+func scimAttr(name, typ, mutability string, required bool) dtos.ScimAttribute {
+	return dtos.ScimAttribute{
+		Name:       name,
+		Type:       typ,
+		Required:   required,
+		Mutability: mutability,
+		Returned:   "default",
+		Uniqueness: "none",
+	}
+}
+
+func (sc *ScimController) scimSchemas(r *http.Request) []dtos.ScimSchema {
+	base := sc.baseURL(r)
+
+	userName := scimAttr("userName", "string", "readWrite", true)
+	userName.Uniqueness = "server"
+	password := scimAttr("password", "string", "writeOnly", false)
+	password.Returned = "never"
+	emails := scimAttr("emails", "complex", "readWrite", false)
+	emails.MultiValued = true
+	emails.Description = "Only a single email is stored, the primary one"
+	emails.SubAttributes = []dtos.ScimAttribute{
+		scimAttr("value", "string", "readWrite", false),
+		scimAttr("type", "string", "readWrite", false),
+		scimAttr("primary", "boolean", "readWrite", false),
+	}
+	groups := scimAttr("groups", "complex", "readOnly", false)
+	groups.MultiValued = true
+	groups.Description = "The role of the user"
+	groups.SubAttributes = []dtos.ScimAttribute{
+		scimAttr("value", "string", "readOnly", false),
+		scimAttr("$ref", "reference", "readOnly", false),
+		scimAttr("display", "string", "readOnly", false),
+	}
+	members := scimAttr("members", "complex", "readWrite", false)
+	members.MultiValued = true
+	members.SubAttributes = []dtos.ScimAttribute{
+		scimAttr("value", "string", "immutable", false),
+		scimAttr("$ref", "reference", "immutable", false),
+		scimAttr("display", "string", "readOnly", false),
+	}
+
+	return []dtos.ScimSchema{
+		{
+			Schemas:     []string{dtos.ScimSchemaSchema},
+			ID:          dtos.ScimSchemaUser,
+			Name:        "User",
+			Description: "User Account",
+			Attributes: []dtos.ScimAttribute{
+				userName,
+				scimAttr("displayName", "string", "readWrite", false),
+				emails,
+				scimAttr("locale", "string", "readWrite", false),
+				scimAttr("active", "boolean", "readWrite", false),
+				password,
+				groups,
+			},
+			Meta: dtos.ScimMeta{ResourceType: "Schema", Location: base + "/Schemas/" + dtos.ScimSchemaUser},
+		},
+		{
+			Schemas:     []string{dtos.ScimSchemaSchema},
+			ID:          dtos.ScimSchemaGroup,
+			Name:        "Group",
+			Description: "Role of users",
+			Attributes: []dtos.ScimAttribute{
+				scimAttr("displayName", "string", "readOnly", true),
+				members,
+			},
+			Meta: dtos.ScimMeta{ResourceType: "Schema", Location: base + "/Schemas/" + dtos.ScimSchemaGroup},
+		},
+	}
+}
+
+func (sc *ScimController) handleSchemas(w http.ResponseWriter, r *http.Request) {
+	schemas := sc.scimSchemas(r)
+	id, single := mux.Vars(r)["id"]
+	if !single {
+		writeScim(w, http.StatusOK, dtos.ScimListResponse{
+			Schemas:      []string{dtos.ScimSchemaListResponse},
+			TotalResults: int64(len(schemas)),
+			StartIndex:   1,
+			ItemsPerPage: len(schemas),
+			Resources:    schemas,
+		})
+		return
+	}
+	for _, s := range schemas {
+		if s.ID == id {
+			writeScim(w, http.StatusOK, s)
+			return
+		}
+	}
+	writeScimError(w, newScimError(http.StatusNotFound, "", "Schema '%s' not found", id))
+}
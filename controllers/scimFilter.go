@@ -0,0 +1,299 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// scimFilter is a parsed SCIM filter expression (RFC 7644, section 3.4.2.2)
+type scimFilter interface {
+	// matches evaluates the filter using the attribute values returned by get
+	matches(get scimAttrGetter) bool
+}
+
+// scimAttrGetter returns the value of an attribute, which is a string, bool or time.Time.
+// Attribute names are passed in lower case, sub-attributes separated by '.'
+type scimAttrGetter func(attr string) interface{}
+
+type scimLogicalFilter struct {
+	and         bool
+	left, right scimFilter
+}
+
+func (f scimLogicalFilter) matches(get scimAttrGetter) bool {
+	if f.and {
+		return f.left.matches(get) && f.right.matches(get)
+	}
+	return f.left.matches(get) || f.right.matches(get)
+}
+
+type scimNotFilter struct {
+	f scimFilter
+}
+
+func (f scimNotFilter) matches(get scimAttrGetter) bool {
+	return !f.f.matches(get)
+}
+
+// scimCompareFilter compares an attribute with a value, Value is nil for the 'pr' operator
+type scimCompareFilter struct {
+	Attr      string
+	Op        string
+	Value     interface{}
+	caseExact bool
+}
+
+func (f scimCompareFilter) matches(get scimAttrGetter) bool {
+	actual := get(f.Attr)
+	if f.Op == "pr" {
+		switch v := actual.(type) {
+		case string:
+			return v != ""
+		case time.Time:
+			return !v.IsZero()
+		}
+		return actual != nil
+	}
+	switch a := actual.(type) {
+	case string:
+		v, ok := f.Value.(string)
+		if !ok {
+			return f.Op == "ne"
+		}
+		if !f.caseExact {
+			a, v = strings.ToLower(a), strings.ToLower(v)
+		}
+		switch f.Op {
+		case "co":
+			return strings.Contains(a, v)
+		case "sw":
+			return strings.HasPrefix(a, v)
+		case "ew":
+			return strings.HasSuffix(a, v)
+		}
+		return compareResult(f.Op, strings.Compare(a, v))
+	case bool:
+		v, ok := f.Value.(bool)
+		switch f.Op {
+		case "eq":
+			return ok && a == v
+		case "ne":
+			return !ok || a != v
+		}
+		return false
+	case time.Time:
+		s, ok := f.Value.(string)
+		if !ok {
+			return f.Op == "ne"
+		}
+		v, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return f.Op == "ne"
+		}
+		c := 0
+		if a.Before(v) {
+			c = -1
+		} else if a.After(v) {
+			c = 1
+		}
+		return compareResult(f.Op, c)
+	}
+	return f.Op == "ne" && f.Value != nil
+}
+
+func compareResult(op string, c int) bool {
+	switch op {
+	case "eq":
+		return c == 0
+	case "ne":
+		return c != 0
+	case "gt":
+		return c > 0
+	case "ge":
+		return c >= 0
+	case "lt":
+		return c < 0
+	case "le":
+		return c <= 0
+	}
+	return false
+}
+
+var scimCompareOps = map[string]bool{
+	"eq": true, "ne": true, "co": true, "sw": true, "ew": true,
+	"gt": true, "ge": true, "lt": true, "le": true,
+}
+
+// scimFilterParser parses filters, only accepting the specified attributes
+type scimFilterParser struct {
+	tokens []string
+	pos    int
+	// attrs maps the supported lower case attribute names to whether they are case exact
+	attrs map[string]bool
+}
+
+// parseScimFilter parses a filter on the attributes of attrs
+func parseScimFilter(filter string, attrs map[string]bool) (scimFilter, error) {
+	tokens, err := tokenizeScimFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	p := &scimFilterParser{tokens: tokens, attrs: attrs}
+	f, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.tokens) {
+		return nil, fmt.Errorf("Unexpected '%s'", p.tokens[p.pos])
+	}
+	return f, nil
+}
+
+func tokenizeScimFilter(s string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, string(c))
+			i++
+		case c == '"':
+			j := i + 1
+			for ; j < len(s) && s[j] != '"'; j++ {
+				if s[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(s) {
+				return nil, fmt.Errorf("Unterminated string")
+			}
+			tokens = append(tokens, s[i:j+1])
+			i = j + 1
+		default:
+			j := i
+			for ; j < len(s) && s[j] != ' ' && s[j] != '\t' && s[j] != '(' && s[j] != ')'; j++ {
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+func (p *scimFilterParser) next() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+	return t
+}
+
+func (p *scimFilterParser) peekKeyword(keyword string) bool {
+	return p.pos < len(p.tokens) && strings.EqualFold(p.tokens[p.pos], keyword)
+}
+
+func (p *scimFilterParser) parseOr() (scimFilter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekKeyword("or") {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = scimLogicalFilter{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *scimFilterParser) parseAnd() (scimFilter, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekKeyword("and") {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = scimLogicalFilter{and: true, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *scimFilterParser) parseUnary() (scimFilter, error) {
+	not := false
+	if p.peekKeyword("not") {
+		p.pos++
+		not = true
+		if p.pos >= len(p.tokens) || p.tokens[p.pos] != "(" {
+			return nil, fmt.Errorf("Expected '(' after 'not'")
+		}
+	}
+	var (
+		f   scimFilter
+		err error
+	)
+	if p.pos < len(p.tokens) && p.tokens[p.pos] == "(" {
+		p.pos++
+		if f, err = p.parseOr(); err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("Expected ')'")
+		}
+	} else if f, err = p.parseCompare(); err != nil {
+		return nil, err
+	}
+	if not {
+		return scimNotFilter{f: f}, nil
+	}
+	return f, nil
+}
+
+func (p *scimFilterParser) parseCompare() (scimFilter, error) {
+	attr := p.next()
+	if attr == "" {
+		return nil, fmt.Errorf("Expected attribute")
+	}
+	name := scimAttrName(attr)
+	caseExact, ok := p.attrs[name]
+	if !ok {
+		return nil, fmt.Errorf("Unsupported attribute '%s'", attr)
+	}
+	op := strings.ToLower(p.next())
+	if op == "pr" {
+		return scimCompareFilter{Attr: name, Op: op}, nil
+	}
+	if !scimCompareOps[op] {
+		return nil, fmt.Errorf("Unsupported operator '%s'", op)
+	}
+	raw := p.next()
+	if raw == "" {
+		return nil, fmt.Errorf("Expected value after '%s %s'", attr, op)
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(raw), &value); err != nil {
+		return nil, fmt.Errorf("Invalid value %s", raw)
+	}
+	return scimCompareFilter{Attr: name, Op: op, Value: value, caseExact: caseExact}, nil
+}
+
+// scimAttrName normalizes an attribute path: the schema URN is removed and the name lower cased
+func scimAttrName(attr string) string {
+	attr = strings.ToLower(attr)
+	if strings.HasPrefix(attr, "urn:") {
+		// urn:ietf:params:scim:schemas:core:2.0:User:userName
+		if i := strings.LastIndex(attr, ":"); i >= 0 {
+			attr = attr[i+1:]
+		}
+	}
+	return attr
+}
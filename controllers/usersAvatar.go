@@ -0,0 +1,180 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/Kirides/simpleApi/dtos"
+	"github.com/Kirides/simpleApi/models"
+	"github.com/Kirides/simpleApi/services"
+	"github.com/Kirides/simpleApi/stores"
+	"github.com/gorilla/mux"
+)
+
+// avatarFormOverhead is the space allowed for the multipart headers around the uploaded file
+const avatarFormOverhead = 64 << 10
+
+// HandleAvatarFiles registers the public, cacheable avatar files onto the provided router.
+// Avatars are addressed by their random key, which is only known from the avatar_url of users.
+func (uc *UsersController) HandleAvatarFiles(r *mux.Router) {
+	if uc.Avatars == nil {
+		return
+	}
+	r.Path("/{key:[0-9a-f]{32}}").Methods(http.MethodGet, http.MethodHead).Handler(uc.handleAvatar())
+}
+
+// handlePutAvatar replaces the profile picture of the current user
+// by the file of the 'avatar' field of a multipart/form-data body
+func (uc *UsersController) handlePutAvatar() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := uc.currentUser(r)
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		if !checkIfMatch(w, r, &user, false) {
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, uc.Avatars.MaxBytes+avatarFormOverhead)
+		mr, err := r.MultipartReader()
+		if err != nil {
+			http.Error(w, "A multipart/form-data body is required", http.StatusUnsupportedMediaType)
+			return
+		}
+		var file io.Reader
+		for file == nil {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				http.Error(w, "The field 'avatar' is missing", http.StatusBadRequest)
+				return
+			}
+			if err != nil {
+				writeAvatarError(w, err)
+				return
+			}
+			if part.FormName() == "avatar" {
+				file = part
+			}
+		}
+		key, err := uc.Avatars.Save(r.Context(), user.ID, file)
+		if err != nil {
+			writeAvatarError(w, err)
+			return
+		}
+		previous := user.Avatar
+		user.Avatar = key
+		if err := uc.store.Update(r.Context(), user); err != nil {
+			if key != previous {
+				uc.deleteAvatar(r.Context(), key)
+			}
+			log.Printf("Could not update user '%s'. Error: %v", user.ID, err)
+			writeStoreError(w, err)
+			return
+		}
+		if previous != "" && previous != key {
+			uc.deleteAvatar(r.Context(), previous)
+		}
+		audit(uc.Audit, r, models.AuditAvatarChanged, models.AuditSuccess, user, "uploaded")
+		uc.writeMe(w, r, user.ID)
+	})
+}
+
+// handleDeleteAvatar removes the profile picture of the current user
+func (uc *UsersController) handleDeleteAvatar() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := uc.currentUser(r)
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		if !checkIfMatch(w, r, &user, false) {
+			return
+		}
+		if user.Avatar == "" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		previous := user.Avatar
+		user.Avatar = ""
+		if err := uc.store.Update(r.Context(), user); err != nil {
+			log.Printf("Could not update user '%s'. Error: %v", user.ID, err)
+			writeStoreError(w, err)
+			return
+		}
+		uc.deleteAvatar(r.Context(), previous)
+		audit(uc.Audit, r, models.AuditAvatarChanged, models.AuditSuccess, user, "removed")
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// handleAvatar serves an avatar in the size of the size parameter.
+// The content of a key never changes, so clients may cache it forever.
+func (uc *UsersController) handleAvatar() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := mux.Vars(r)["key"]
+		size := uc.Avatars.DefaultSize
+		if v := r.URL.Query().Get("size"); v != "" {
+			var err error
+			if size, err = strconv.Atoi(v); err != nil || !uc.Avatars.ValidSize(size) {
+				http.Error(w, "Unsupported size", http.StatusBadRequest)
+				return
+			}
+		}
+		f, info, err := uc.Avatars.Open(r.Context(), key, size)
+		if err != nil {
+			if !errors.Is(err, stores.ErrNotFound) {
+				log.Printf("Could not open avatar '%s'. Error: %v", key, err)
+				writeStoreError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		defer f.Close()
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		if notModified(w, r, `"`+key+"-"+strconv.Itoa(size)+`"`) {
+			return
+		}
+		w.Header().Set("Content-Type", services.AvatarContentType)
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		if _, err := io.Copy(w, f); err != nil {
+			log.Printf("Could not send avatar '%s'. Error: %v", key, err)
+		}
+	})
+}
+
+// writeMe sends the current state of the user with the id
+func (uc *UsersController) writeMe(w http.ResponseWriter, r *http.Request, id string) {
+	user, err := uc.store.Get(r.Context(), id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.Header().Set("ETag", userETag(user))
+	writeJSON(w, http.StatusOK, dtos.NewUser(user))
+}
+
+func (uc *UsersController) deleteAvatar(ctx context.Context, key string) {
+	if err := uc.Avatars.Delete(ctx, key); err != nil {
+		log.Printf("Could not delete avatar '%s'. Error: %v", key, err)
+	}
+}
+
+// writeAvatarError sends the status for errors of reading and storing uploaded avatars
+func writeAvatarError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case err == services.ErrImageTooLarge, errors.As(err, &tooLarge):
+		http.Error(w, services.ErrImageTooLarge.Error(), http.StatusRequestEntityTooLarge)
+	case err == services.ErrUnsupportedImage:
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+	default:
+		log.Printf("Could not store avatar. Error: %v", err)
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+	}
+}
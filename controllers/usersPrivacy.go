@@ -0,0 +1,188 @@
+package controllers
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Kirides/simpleApi/dtos"
+	"github.com/Kirides/simpleApi/models"
+	"github.com/Kirides/simpleApi/services"
+	"github.com/Kirides/simpleApi/stores"
+)
+
+// accountDeletion is the body of DELETE /users/me
+type accountDeletion struct {
+	Password string `json:"password"`
+}
+
+// eraser returns a services.UserEraser that cleans up all stores known to the controller
+func (uc *UsersController) eraser() *services.UserEraser {
+	e := services.NewUserEraser(uc.store)
+	e.Orgs = uc.OrgStore
+	e.Avatars = uc.Avatars
+	e.Invitations = uc.Invitations
+	e.Sessions = uc.Sessions
+	return e
+}
+
+// collectPersonalData gathers everything the stores of the controller keep about user
+func (uc *UsersController) collectPersonalData(ctx context.Context, user models.User) (dtos.PersonalData, error) {
+	now := time.Now().UTC().Truncate(time.Second)
+	data := dtos.PersonalData{
+		ExportedAt: now,
+		Profile:    dtos.NewUser(user),
+		Groups:     []dtos.Group{},
+	}
+	if uc.OrgStore != nil {
+		org, err := uc.OrgStore.GetOrg(ctx, user.OrgID)
+		if err != nil && !errors.Is(err, stores.ErrNotFound) {
+			return data, err
+		}
+		if err == nil {
+			o := dtos.NewOrganization(org)
+			data.Organization = &o
+		}
+		groups, err := uc.OrgStore.UserGroups(ctx, user.ID)
+		if err != nil {
+			return data, err
+		}
+		data.Groups = dtos.NewGroups(groups)
+	}
+	if uc.Invitations != nil {
+		invitations, err := uc.Invitations.FindInvitations(ctx, "")
+		if err != nil {
+			return data, err
+		}
+		for _, inv := range invitations {
+			if inv.UserID == user.ID {
+				i := dtos.NewInvitation(inv, now)
+				data.Invitation = &i
+				break
+			}
+		}
+	}
+	if uc.Sessions != nil {
+		sessions, err := uc.Sessions.UserSessions(ctx, user.ID, now)
+		if err != nil {
+			return data, err
+		}
+		data.Sessions = dtos.NewSessions(sessions, "")
+	}
+	return data, nil
+}
+
+// handleExportMe sends everything stored about the current user as a download.
+// By default it is a ZIP archive containing data.json and the profile picture,
+// format=json only sends data.json.
+func (uc *UsersController) handleExportMe() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		format := r.URL.Query().Get("format")
+		if format != "" && format != "zip" && format != "json" {
+			http.Error(w, "format must be 'zip' or 'json'", http.StatusBadRequest)
+			return
+		}
+		user, err := uc.currentUser(r)
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		data, err := uc.collectPersonalData(r.Context(), user)
+		if err != nil {
+			log.Printf("Could not collect data of user '%s'. Error: %v", user.ID, err)
+			writeStoreError(w, err)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		if format == "json" {
+			w.Header().Set("Content-Disposition", `attachment; filename="`+user.Name+`.json"`)
+			writeJSON(w, http.StatusOK, data)
+			return
+		}
+
+		var avatar io.ReadCloser
+		if uc.Avatars != nil && user.Avatar != "" {
+			size := uc.Avatars.Sizes[len(uc.Avatars.Sizes)-1]
+			if avatar, _, err = uc.Avatars.Open(r.Context(), user.Avatar, size); err != nil {
+				log.Printf("Could not open avatar of user '%s'. Error: %v", user.ID, err)
+				avatar = nil
+			} else {
+				defer avatar.Close()
+				data.Avatar = "avatar.png"
+			}
+		}
+		b, err := json.MarshalIndent(data, "", "\t")
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+user.Name+`.zip"`)
+		zw := zip.NewWriter(w)
+		f, err := zw.Create("data.json")
+		if err == nil {
+			_, err = f.Write(b)
+		}
+		if err == nil && avatar != nil {
+			if f, err = zw.Create(data.Avatar); err == nil {
+				_, err = io.Copy(f, avatar)
+			}
+		}
+		if err == nil {
+			err = zw.Close()
+		}
+		if err != nil {
+			// the status has already been sent, the client gets a truncated archive
+			log.Printf("Could not write export of user '%s'. Error: %v", user.ID, err)
+		}
+	})
+}
+
+// handleDeleteMe permanently removes the current user after confirming its password.
+// All previously issued tokens are rejected afterwards, because their subject no longer exists.
+func (uc *UsersController) handleDeleteMe() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := uc.currentUser(r)
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		var req accountDeletion
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		if _, err := uc.PasswordHasher.Verify(user.Hash, []byte(req.Password)); err != nil {
+			audit(uc.Audit, r, models.AuditUserErased, models.AuditFailure, user, "invalid password")
+			http.Error(w, "Invalid password", http.StatusForbidden)
+			return
+		}
+		if user.Role == models.RoleAdmin {
+			admins, err := uc.store.Count(r.Context(), stores.UserQuery{Role: models.RoleAdmin, Statuses: []string{models.StatusActive}})
+			if err != nil {
+				writeStoreError(w, err)
+				return
+			}
+			if admins <= 1 {
+				http.Error(w, "The last admin can not be deleted", http.StatusConflict)
+				return
+			}
+		}
+		if err := uc.eraser().Erase(r.Context(), user); err != nil {
+			if errors.Is(err, stores.ErrVersionConflict) {
+				http.Error(w, "User was modified concurrently", http.StatusConflict)
+				return
+			}
+			log.Printf("Could not delete user '%s'. Error: %v", user.ID, err)
+			writeStoreError(w, err)
+			return
+		}
+		audit(uc.Audit, r, models.AuditUserErased, models.AuditSuccess, user, "account deleted by its owner")
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
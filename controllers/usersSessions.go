@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Kirides/simpleApi/dtos"
+	"github.com/Kirides/simpleApi/models"
+	"github.com/Kirides/simpleApi/stores"
+	"github.com/gorilla/mux"
+)
+
+// handleSessions lists the devices the current user is signed in on, newest first
+func (uc *UsersController) handleSessions() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, _ := models.PrincipalFromContext(r.Context())
+		sessions, err := uc.Sessions.UserSessions(r.Context(), p.ID, time.Now())
+		if err != nil {
+			log.Printf("Could not retrieve sessions of user '%s'. Error: %v", p.ID, err)
+			writeStoreError(w, err)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		writeJSON(w, http.StatusOK, dtos.NewSessions(sessions, p.TokenID))
+	})
+}
+
+// handleRevokeSession signs the current user out of a single session, which may also be the current one
+func (uc *UsersController) handleRevokeSession() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, _ := models.PrincipalFromContext(r.Context())
+		now := time.Now()
+		session, err := uc.Sessions.GetSession(r.Context(), mux.Vars(r)["id"])
+		// sessions of other users are reported as missing, so their ids can not be probed
+		if errors.Is(err, stores.ErrNotFound) || (err == nil && (session.UserID != p.ID || !session.Active(now))) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err == nil {
+			err = uc.Sessions.RevokeSession(r.Context(), session.ID, now.UTC())
+		}
+		if errors.Is(err, stores.ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Could not revoke session of user '%s'. Error: %v", p.ID, err)
+			writeStoreError(w, err)
+			return
+		}
+		uc.auditSessions(r, "revoked session "+session.ID)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// handleRevokeOtherSessions signs the current user out everywhere except the current session
+func (uc *UsersController) handleRevokeOtherSessions() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, _ := models.PrincipalFromContext(r.Context())
+		n, err := uc.Sessions.RevokeUserSessions(r.Context(), p.ID, p.TokenID, time.Now().UTC())
+		if err != nil {
+			log.Printf("Could not revoke sessions of user '%s'. Error: %v", p.ID, err)
+			writeStoreError(w, err)
+			return
+		}
+		if n > 0 {
+			uc.auditSessions(r, fmt.Sprintf("revoked %d other sessions", n))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// auditSessions records that the current user revoked own sessions
+func (uc *UsersController) auditSessions(r *http.Request, details string) {
+	if uc.Audit == nil {
+		return
+	}
+	e := newAuditEvent(r, models.AuditSessionRevoked, models.AuditSuccess)
+	e.TargetID = e.ActorID
+	e.Details = details
+	uc.Audit.Record(r.Context(), e)
+}
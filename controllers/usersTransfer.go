@@ -0,0 +1,162 @@
+package controllers
+
+import (
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Kirides/simpleApi/dtos"
+	"github.com/Kirides/simpleApi/models"
+	"github.com/Kirides/simpleApi/services"
+)
+
+// content types of the formats supported by imports and exports
+var userFormatContentTypes = map[string]string{
+	"text/csv":              services.FormatCSV,
+	"application/x-ndjson":  services.FormatJSONL,
+	"application/jsonl":     services.FormatJSONL,
+	"application/jsonlines": services.FormatJSONL,
+}
+
+func userFormatContentType(format string) string {
+	if format == services.FormatCSV {
+		return "text/csv; charset=utf-8"
+	}
+	return "application/x-ndjson"
+}
+
+// disableDeadlines lifts the server timeouts for requests that stream large bodies
+func disableDeadlines(w http.ResponseWriter) {
+	rc := http.NewResponseController(w)
+	if err := rc.SetReadDeadline(time.Time{}); err != nil {
+		log.Printf("Could not lift read deadline. Error: %v", err)
+	}
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("Could not lift write deadline. Error: %v", err)
+	}
+}
+
+// handleImport creates users from a CSV or JSON Lines body.
+// The format is taken from the format parameter or the Content-Type.
+// dry_run=true only validates the records, report=csv answers with the errors as a CSV download.
+func (uc *UsersController) handleImport() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v := r.URL.Query()
+		format := v.Get("format")
+		if format == "" {
+			ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			format = userFormatContentTypes[ct]
+		}
+		if !services.ValidUserFormat(format) {
+			http.Error(w, "format must be 'csv' or 'jsonl'", http.StatusUnsupportedMediaType)
+			return
+		}
+		dryRun, _ := strconv.ParseBool(v.Get("dry_run"))
+		report := v.Get("report")
+		if report != "" && report != "csv" {
+			http.Error(w, "report must be 'csv'", http.StatusBadRequest)
+			return
+		}
+		disableDeadlines(w)
+
+		// the unscoped store is used, so usernames of other organizations are reported as taken
+		importer := services.NewUserImporter(uc.store)
+		importer.PasswordPolicy = uc.PasswordPolicy
+		importer.PasswordHasher = uc.PasswordHasher
+		importer.Orgs = uc.OrgStore
+		if uc.OrgStore == nil {
+			importer.OrgID = models.DefaultOrgID
+		}
+		if p, _ := models.PrincipalFromContext(r.Context()); p.Role != models.RoleAdmin {
+			importer.OrgID = p.OrgID
+			importer.AdminRoleAllowed = false
+		}
+		result, err := importer.Import(r.Context(), r.Body, format, dryRun)
+		if err != nil {
+			log.Printf("Import aborted. Error: %v", err)
+			if !dryRun {
+				audit(uc.Audit, r, models.AuditUsersImported, models.AuditFailure, models.User{},
+					"aborted after "+strconv.Itoa(result.Imported)+" imported users: "+err.Error())
+			}
+			http.Error(w, "Import aborted after "+strconv.Itoa(result.Imported)+" imported users. "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !dryRun {
+			audit(uc.Audit, r, models.AuditUsersImported, models.AuditSuccess, models.User{},
+				strconv.Itoa(result.Imported)+" of "+strconv.Itoa(result.Total)+" users imported")
+		}
+		if report == "" {
+			writeJSON(w, http.StatusOK, result)
+			return
+		}
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="import-errors.csv"`)
+		w.Header().Set("X-Import-Total", strconv.Itoa(result.Total))
+		w.Header().Set("X-Import-Imported", strconv.Itoa(result.Imported))
+		w.Header().Set("X-Import-Failed", strconv.Itoa(result.Failed))
+		w.Header().Set("Access-Control-Expose-Headers", "Content-Disposition, X-Import-Total, X-Import-Imported, X-Import-Failed")
+		if err := result.WriteErrorReport(w); err != nil {
+			log.Printf("Could not write import report. Error: %v", err)
+		}
+	})
+}
+
+// handleExport streams all users matching the filters of the users list as CSV or JSON Lines.
+// The format is taken from the format parameter or the Accept header.
+func (uc *UsersController) handleExport() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = services.FormatJSONL
+			if strings.Contains(r.Header.Get("Accept"), "text/csv") {
+				format = services.FormatCSV
+			}
+		}
+		if !services.ValidUserFormat(format) {
+			http.Error(w, "format must be 'csv' or 'jsonl'", http.StatusBadRequest)
+			return
+		}
+		query, err := uc.getUserQuery(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		disableDeadlines(w)
+
+		w.Header().Set("Content-Type", userFormatContentType(format))
+		w.Header().Set("Content-Disposition", `attachment; filename="users.`+format+`"`)
+		w.Header().Set(dtos.APIVersionHeader, dtos.APIVersion)
+		tw := &trackingWriter{ResponseWriter: w}
+		if _, err := services.NewUserExporter(uc.storeFor(r)).Export(r.Context(), tw, format, query); err != nil {
+			log.Printf("Export aborted. Error: %v", err)
+			if !tw.written {
+				w.Header().Del("Content-Disposition")
+				http.Error(w, "Could not export users", http.StatusInternalServerError)
+				return
+			}
+			// the status has already been sent, the client has to notice the truncated body
+			panic(http.ErrAbortHandler)
+		}
+	})
+}
+
+// trackingWriter records whether anything has been written to the response
+type trackingWriter struct {
+	http.ResponseWriter
+	written bool
+}
+
+func (w *trackingWriter) Write(b []byte) (int, error) {
+	w.written = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush sends buffered data to the client
+func (w *trackingWriter) Flush() {
+	if err := http.NewResponseController(w.ResponseWriter).Flush(); err != nil {
+		log.Printf("Could not flush response. Error: %v", err)
+	}
+}
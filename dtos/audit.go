@@ -0,0 +1,50 @@
+package dtos
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/Kirides/simpleApi/models"
+)
+
+// AuditEvent is the representation of a models.AuditEvent sent to admins
+type AuditEvent struct {
+	ID        string    `json:"id"`
+	Time      time.Time `json:"time"`
+	Action    string    `json:"action"`
+	Outcome   string    `json:"outcome"`
+	ActorID   string    `json:"actor_id,omitempty"`
+	ActorName string    `json:"actor_name,omitempty"`
+	TargetID  string    `json:"target_id,omitempty"`
+	Org       string    `json:"org,omitempty"`
+	IP        string    `json:"ip,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+	Details   string    `json:"details,omitempty"`
+	PrevHash  string    `json:"prev_hash,omitempty"`
+	Hash      string    `json:"hash,omitempty"`
+}
+
+// NewAuditEvents converts multiple models.AuditEvent into their representation
+func NewAuditEvents(events []models.AuditEvent) []AuditEvent {
+	result := make([]AuditEvent, len(events))
+	for i, e := range events {
+		result[i] = AuditEvent{
+			ID:        strconv.FormatInt(e.ID, 10),
+			Time:      e.Time,
+			Action:    e.Action,
+			Outcome:   e.Outcome,
+			ActorID:   e.ActorID,
+			ActorName: e.ActorName,
+			TargetID:  e.TargetID,
+			Org:       e.OrgID,
+			IP:        e.IP,
+			UserAgent: e.UserAgent,
+			RequestID: e.RequestID,
+			Details:   e.Details,
+			PrevHash:  e.PrevHash,
+			Hash:      e.Hash,
+		}
+	}
+	return result
+}
@@ -0,0 +1,59 @@
+package dtos
+
+import (
+	"time"
+
+	"github.com/Kirides/simpleApi/models"
+)
+
+// Invitation is the representation of a models.Invitation sent to admins
+type Invitation struct {
+	ID         string     `json:"id"`
+	Email      string     `json:"email"`
+	Role       string     `json:"role"`
+	Org        string     `json:"org"`
+	InvitedBy  string     `json:"invited_by,omitempty"`
+	Status     string     `json:"status"`
+	CreatedAt  *time.Time `json:"created_at,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	AcceptedAt *time.Time `json:"accepted_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	UserID     string     `json:"user_id,omitempty"`
+	// URL is the invite link, it is only sent once when the invitation is created
+	URL string `json:"url,omitempty"`
+}
+
+// NewInvitation converts a models.Invitation into its representation, with the status at the time now
+func NewInvitation(inv models.Invitation, now time.Time) Invitation {
+	return Invitation{
+		ID:         inv.ID,
+		Email:      inv.Email,
+		Role:       inv.Role,
+		Org:        inv.OrgID,
+		InvitedBy:  inv.InvitedBy,
+		Status:     inv.Status(now),
+		CreatedAt:  timeOrNil(inv.CreatedAt),
+		ExpiresAt:  timeOrNil(inv.ExpiresAt),
+		AcceptedAt: timeOrNil(inv.AcceptedAt),
+		RevokedAt:  timeOrNil(inv.RevokedAt),
+		UserID:     inv.UserID,
+	}
+}
+
+// InvitationDetails is what the holder of an invite link gets to see before accepting it
+type InvitationDetails struct {
+	Email     string     `json:"email"`
+	Role      string     `json:"role"`
+	Org       string     `json:"org"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// NewInvitationDetails converts a models.Invitation into the details of its invite link
+func NewInvitationDetails(inv models.Invitation) InvitationDetails {
+	return InvitationDetails{
+		Email:     inv.Email,
+		Role:      inv.Role,
+		Org:       inv.OrgID,
+		ExpiresAt: timeOrNil(inv.ExpiresAt),
+	}
+}
@@ -0,0 +1,61 @@
+package dtos
+
+import (
+	"time"
+
+	"github.com/Kirides/simpleApi/models"
+)
+
+// Organization is the public representation of a models.Organization
+type Organization struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+}
+
+// NewOrganization converts a models.Organization into its public representation
+func NewOrganization(o models.Organization) Organization {
+	return Organization{
+		ID:        o.ID,
+		Name:      o.Name,
+		CreatedAt: timeOrNil(o.CreatedAt),
+	}
+}
+
+// NewOrganizations converts multiple models.Organization into their public representation
+func NewOrganizations(orgs []models.Organization) []Organization {
+	result := make([]Organization, len(orgs))
+	for i, o := range orgs {
+		result[i] = NewOrganization(o)
+	}
+	return result
+}
+
+// Group is the public representation of a models.Group
+type Group struct {
+	ID          string     `json:"id"`
+	Org         string     `json:"org"`
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	CreatedAt   *time.Time `json:"created_at,omitempty"`
+}
+
+// NewGroup converts a models.Group into its public representation
+func NewGroup(g models.Group) Group {
+	return Group{
+		ID:          g.ID,
+		Org:         g.OrgID,
+		Name:        g.Name,
+		Description: g.Description,
+		CreatedAt:   timeOrNil(g.CreatedAt),
+	}
+}
+
+// NewGroups converts multiple models.Group into their public representation
+func NewGroups(groups []models.Group) []Group {
+	result := make([]Group, len(groups))
+	for i, g := range groups {
+		result[i] = NewGroup(g)
+	}
+	return result
+}
@@ -0,0 +1,12 @@
+package dtos
+
+// PasswordPolicy tells clients which passwords the server accepts,
+// so forms can validate them before submitting
+type PasswordPolicy struct {
+	// MinLength is the minimum amount of characters
+	MinLength int `json:"min_length"`
+	// MaxLength is the maximum amount of bytes (UTF-8), 0 if unlimited
+	MaxLength int `json:"max_length"`
+	// DisallowUsername rejects passwords that contain the username, ignoring case
+	DisallowUsername bool `json:"disallow_username"`
+}
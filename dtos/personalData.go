@@ -0,0 +1,19 @@
+package dtos
+
+import (
+	"time"
+)
+
+// PersonalData is everything stored about a user, as exported by GET /api/users/me/export
+type PersonalData struct {
+	ExportedAt   time.Time     `json:"exported_at"`
+	Profile      User          `json:"profile"`
+	Organization *Organization `json:"organization,omitempty"`
+	Groups       []Group       `json:"groups"`
+	// Invitation is the invitation the account was created by
+	Invitation *Invitation `json:"invitation,omitempty"`
+	// Sessions are the devices the user is currently signed in on
+	Sessions []Session `json:"sessions,omitempty"`
+	// Avatar is the name of the profile picture inside of the archive
+	Avatar string `json:"avatar,omitempty"`
+}
@@ -0,0 +1,209 @@
+package dtos
+
+import (
+	"time"
+
+	"github.com/Kirides/simpleApi/models"
+)
+
+// Schema URNs of SCIM 2.0 (RFC 7643, RFC 7644)
+const (
+	ScimSchemaUser                  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	ScimSchemaGroup                 = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	ScimSchemaServiceProviderConfig = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	ScimSchemaResourceType          = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+	ScimSchemaSchema                = "urn:ietf:params:scim:schemas:core:2.0:Schema"
+	ScimSchemaListResponse          = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	ScimSchemaPatchOp               = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	ScimSchemaError                 = "urn:ietf:params:scim:api:messages:2.0:Error"
+)
+
+// ScimMeta is the meta attribute of SCIM resources
+type ScimMeta struct {
+	ResourceType string     `json:"resourceType"`
+	Created      *time.Time `json:"created,omitempty"`
+	LastModified *time.Time `json:"lastModified,omitempty"`
+	Location     string     `json:"location"`
+	Version      string     `json:"version,omitempty"`
+}
+
+// ScimUser is the SCIM representation of a models.User
+type ScimUser struct {
+	Schemas     []string       `json:"schemas"`
+	ID          string         `json:"id"`
+	UserName    string         `json:"userName"`
+	DisplayName string         `json:"displayName,omitempty"`
+	Emails      []ScimEmail    `json:"emails,omitempty"`
+	Locale      string         `json:"locale,omitempty"`
+	Active      bool           `json:"active"`
+	Groups      []ScimGroupRef `json:"groups,omitempty"`
+	Meta        ScimMeta       `json:"meta"`
+}
+
+// ScimEmail ...
+type ScimEmail struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// ScimGroupRef references a group of a user or a member of a group
+type ScimGroupRef struct {
+	Value   string `json:"value"`
+	Ref     string `json:"$ref,omitempty"`
+	Display string `json:"display,omitempty"`
+}
+
+// NewScimUser converts a models.User into its SCIM representation.
+// baseURL is the absolute URL of the SCIM endpoints, etag the current entity-tag of the user
+func NewScimUser(u models.User, baseURL, etag string) ScimUser {
+	su := ScimUser{
+		Schemas:     []string{ScimSchemaUser},
+		ID:          u.ID,
+		UserName:    u.Name,
+		DisplayName: u.DisplayName,
+		Locale:      u.Locale,
+		Active:      u.IsActive(),
+		Groups: []ScimGroupRef{{
+			Value:   u.Role,
+			Ref:     baseURL + "/Groups/" + u.Role,
+			Display: u.Role,
+		}},
+		Meta: ScimMeta{
+			ResourceType: "User",
+			Created:      timeOrNil(u.CreatedAt),
+			LastModified: timeOrNil(u.UpdatedAt),
+			Location:     baseURL + "/Users/" + u.ID,
+			Version:      "W/" + etag,
+		},
+	}
+	if u.Email != "" {
+		su.Emails = []ScimEmail{{Value: u.Email, Type: "work", Primary: true}}
+	}
+	return su
+}
+
+// ScimGroup is the SCIM representation of a role
+type ScimGroup struct {
+	Schemas     []string       `json:"schemas"`
+	ID          string         `json:"id"`
+	DisplayName string         `json:"displayName"`
+	Members     []ScimGroupRef `json:"members,omitempty"`
+	Meta        ScimMeta       `json:"meta"`
+}
+
+// NewScimGroup creates the SCIM group of a role, listing its members if they are not nil
+func NewScimGroup(role string, members []models.User, baseURL string) ScimGroup {
+	g := ScimGroup{
+		Schemas:     []string{ScimSchemaGroup},
+		ID:          role,
+		DisplayName: role,
+		Meta: ScimMeta{
+			ResourceType: "Group",
+			Location:     baseURL + "/Groups/" + role,
+		},
+	}
+	if members != nil {
+		g.Members = make([]ScimGroupRef, len(members))
+		for i, m := range members {
+			g.Members[i] = ScimGroupRef{
+				Value:   m.ID,
+				Ref:     baseURL + "/Users/" + m.ID,
+				Display: m.Name,
+			}
+		}
+	}
+	return g
+}
+
+// ScimListResponse is a page of resources
+type ScimListResponse struct {
+	Schemas      []string    `json:"schemas"`
+	TotalResults int64       `json:"totalResults"`
+	StartIndex   int64       `json:"startIndex"`
+	ItemsPerPage int         `json:"itemsPerPage"`
+	Resources    interface{} `json:"Resources"`
+}
+
+// ScimError is the body of every SCIM error response
+type ScimError struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+}
+
+// ScimServiceProviderConfig describes the supported SCIM features
+type ScimServiceProviderConfig struct {
+	Schemas               []string             `json:"schemas"`
+	DocumentationURI      string               `json:"documentationUri,omitempty"`
+	Patch                 ScimSupported        `json:"patch"`
+	Bulk                  ScimBulkSupport      `json:"bulk"`
+	Filter                ScimFilterSupport    `json:"filter"`
+	ChangePassword        ScimSupported        `json:"changePassword"`
+	Sort                  ScimSupported        `json:"sort"`
+	ETag                  ScimSupported        `json:"etag"`
+	AuthenticationSchemes []ScimAuthentication `json:"authenticationSchemes"`
+	Meta                  ScimMeta             `json:"meta"`
+}
+
+// ScimSupported ...
+type ScimSupported struct {
+	Supported bool `json:"supported"`
+}
+
+// ScimBulkSupport ...
+type ScimBulkSupport struct {
+	Supported      bool `json:"supported"`
+	MaxOperations  int  `json:"maxOperations"`
+	MaxPayloadSize int  `json:"maxPayloadSize"`
+}
+
+// ScimFilterSupport ...
+type ScimFilterSupport struct {
+	Supported  bool `json:"supported"`
+	MaxResults int  `json:"maxResults"`
+}
+
+// ScimAuthentication ...
+type ScimAuthentication struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Primary     bool   `json:"primary,omitempty"`
+}
+
+// ScimResourceType describes an endpoint of resources
+type ScimResourceType struct {
+	Schemas     []string `json:"schemas"`
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Endpoint    string   `json:"endpoint"`
+	Description string   `json:"description"`
+	Schema      string   `json:"schema"`
+	Meta        ScimMeta `json:"meta"`
+}
+
+// ScimSchema describes the attributes of a resource
+type ScimSchema struct {
+	Schemas     []string        `json:"schemas"`
+	ID          string          `json:"id"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Attributes  []ScimAttribute `json:"attributes"`
+	Meta        ScimMeta        `json:"meta"`
+}
+
+// ScimAttribute describes a single attribute of a ScimSchema
+type ScimAttribute struct {
+	Name          string          `json:"name"`
+	Type          string          `json:"type"`
+	MultiValued   bool            `json:"multiValued"`
+	Description   string          `json:"description,omitempty"`
+	Required      bool            `json:"required"`
+	CaseExact     bool            `json:"caseExact"`
+	Mutability    string          `json:"mutability"`
+	Returned      string          `json:"returned"`
+	Uniqueness    string          `json:"uniqueness"`
+	SubAttributes []ScimAttribute `json:"subAttributes,omitempty"`
+}
@@ -0,0 +1,43 @@
+package dtos
+
+import (
+	"time"
+
+	"github.com/Kirides/simpleApi/models"
+)
+
+// Session is the representation of a models.Session sent to its user
+type Session struct {
+	ID         string     `json:"id"`
+	Device     string     `json:"device"`
+	IP         string     `json:"ip,omitempty"`
+	UserAgent  string     `json:"user_agent,omitempty"`
+	CreatedAt  *time.Time `json:"created_at,omitempty"`
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	// Current marks the session the request was made with
+	Current bool `json:"current"`
+}
+
+// NewSession converts a models.Session into its representation
+func NewSession(s models.Session, currentID string) Session {
+	return Session{
+		ID:         s.ID,
+		Device:     s.Device,
+		IP:         s.IP,
+		UserAgent:  s.UserAgent,
+		CreatedAt:  timeOrNil(s.CreatedAt),
+		LastSeenAt: timeOrNil(s.LastSeenAt),
+		ExpiresAt:  timeOrNil(s.ExpiresAt),
+		Current:    s.ID == currentID,
+	}
+}
+
+// NewSessions converts multiple models.Session into their representation
+func NewSessions(sessions []models.Session, currentID string) []Session {
+	result := make([]Session, len(sessions))
+	for i, s := range sessions {
+		result[i] = NewSession(s, currentID)
+	}
+	return result
+}
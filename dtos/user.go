@@ -0,0 +1,69 @@
+package dtos
+
+import (
+	"time"
+
+	"github.com/Kirides/simpleApi/models"
+)
+
+// User is the public representation of a models.User.
+// Only fields listed here are ever sent to clients, new fields
+// have to be added explicitly (see README.md for the documented shape).
+type User struct {
+	ID          string     `json:"id"`
+	Username    string     `json:"username"`
+	Role        string     `json:"role"`
+	Org         string     `json:"org"`
+	DisplayName string     `json:"display_name,omitempty"`
+	Email       string     `json:"email,omitempty"`
+	Locale      string     `json:"locale,omitempty"`
+	AvatarURL   string     `json:"avatar_url,omitempty"`
+	CreatedAt   *time.Time `json:"created_at,omitempty"`
+	UpdatedAt   *time.Time `json:"updated_at,omitempty"`
+	Status      string     `json:"status"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+	// Version is the same value that is sent as ETag
+	Version int64 `json:"version"`
+}
+
+// AvatarBasePath is the path avatars are served below
+var AvatarBasePath = "/avatars/"
+
+// NewUser converts a models.User into its public representation
+func NewUser(u models.User) User {
+	avatarURL := ""
+	if u.Avatar != "" {
+		avatarURL = AvatarBasePath + u.Avatar
+	}
+	return User{
+		ID:          u.ID,
+		Username:    u.Name,
+		Role:        u.Role,
+		Org:         u.OrgID,
+		DisplayName: u.DisplayName,
+		Email:       u.Email,
+		Locale:      u.Locale,
+		AvatarURL:   avatarURL,
+		CreatedAt:   timeOrNil(u.CreatedAt),
+		UpdatedAt:   timeOrNil(u.UpdatedAt),
+		Status:      u.Status,
+		DeletedAt:   timeOrNil(u.DeletedAt),
+		Version:     u.Version,
+	}
+}
+
+// NewUsers converts multiple models.User into their public representation
+func NewUsers(users []models.User) []User {
+	result := make([]User, len(users))
+	for i, u := range users {
+		result[i] = NewUser(u)
+	}
+	return result
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
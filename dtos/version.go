@@ -0,0 +1,9 @@
+package dtos
+
+// APIVersion is the version of all representations in this package.
+// It is increased for every breaking change of a representation and sent
+// to clients in the APIVersionHeader of every response
+const APIVersion = "1"
+
+// APIVersionHeader is the response header carrying the APIVersion
+const APIVersionHeader = "Api-Version"
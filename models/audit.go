@@ -0,0 +1,55 @@
+package models
+
+import "time"
+
+// Actions of audit events
+const (
+	AuditTokenIssued     = "token.issued"
+	AuditLoginFailed     = "login.failed"
+	AuditUserRegistered  = "user.registered"
+	AuditUserCreated     = "user.created"
+	AuditUserUpdated     = "user.updated"
+	AuditUserDeleted     = "user.deleted"
+	AuditUserDisabled    = "user.disabled"
+	AuditUserRestored    = "user.restored"
+	AuditUserErased      = "user.erased"
+	AuditUsersImported   = "users.imported"
+	AuditPasswordChanged = "password.changed"
+	AuditAvatarChanged   = "avatar.changed"
+	AuditInviteCreated   = "invitation.created"
+	AuditInviteRevoked   = "invitation.revoked"
+	AuditSessionRevoked  = "session.revoked"
+	AuditTokensRevoked   = "tokens.revoked"
+)
+
+const (
+	// AuditSuccess is the outcome of actions that were carried out
+	AuditSuccess = "success"
+	// AuditFailure is the outcome of rejected actions
+	AuditFailure = "failure"
+)
+
+// AuditEvent records who did what to whom. Events are never modified after they are appended.
+type AuditEvent struct {
+	// ID increases with every appended event
+	ID      int64
+	Time    time.Time
+	Action  string
+	Outcome string
+	// ActorID is the user that caused the event, empty for anonymous callers
+	ActorID string
+	// ActorName is the name of the actor, or the name that was tried on failed logins
+	ActorName string
+	// TargetID is the user affected by the event
+	TargetID string
+	// OrgID is the organization of the target, or of the actor if there is no target
+	OrgID     string
+	IP        string
+	UserAgent string
+	RequestID string
+	// Details is a short, human readable description
+	Details string
+	// Hash chains the event to its predecessor, it is empty if the chain is disabled
+	PrevHash string
+	Hash     string
+}
@@ -1,8 +1,24 @@
 package models
 
+import "context"
+
 type contextKey int
 
 const (
 	// KeyTokenUsername ...
 	KeyTokenUsername contextKey = iota
+	// KeyTokenRole ...
+	KeyTokenRole
+	// KeyTokenSubject contains the id of the authenticated user
+	KeyTokenSubject
+	// KeyPrincipal contains the authenticated Principal
+	KeyPrincipal
+	// KeyRequestID contains the id that identifies the request in logs and audit events
+	KeyRequestID
 )
+
+// RequestIDFromContext returns the id of the request stored in ctx, or an empty string
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(KeyRequestID).(string)
+	return id
+}
@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+const (
+	// InvitationPending invitations can still be accepted
+	InvitationPending = "pending"
+	// InvitationAccepted invitations have been used to create an account
+	InvitationAccepted = "accepted"
+	// InvitationRevoked invitations have been withdrawn before they were accepted
+	InvitationRevoked = "revoked"
+	// InvitationExpired invitations were neither accepted nor revoked in time
+	InvitationExpired = "expired"
+)
+
+// Invitation allows the owner of the email address to create an account
+// with the role in the organization, exactly once
+type Invitation struct {
+	ID    string
+	Email string
+	Role  string
+	OrgID string
+	// InvitedBy is the id of the user that created the invitation
+	InvitedBy string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	// AcceptedAt and RevokedAt are zero until the invitation is accepted or revoked
+	AcceptedAt time.Time
+	RevokedAt  time.Time
+	// UserID is the id of the account created by accepting the invitation
+	UserID string
+}
+
+// Status returns one of the Invitation* states at the time now
+func (i Invitation) Status(now time.Time) string {
+	switch {
+	case !i.AcceptedAt.IsZero():
+		return InvitationAccepted
+	case !i.RevokedAt.IsZero():
+		return InvitationRevoked
+	case !now.Before(i.ExpiresAt):
+		return InvitationExpired
+	}
+	return InvitationPending
+}
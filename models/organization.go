@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// DefaultOrgID is the organization of users that were not assigned to another one
+const DefaultOrgID = "default"
+
+// Organization is a tenant, every user belongs to exactly one
+type Organization struct {
+	// ID is a unique slug, e.g. "acme"
+	ID        string
+	Name      string
+	CreatedAt time.Time
+}
+
+// Group is a named set of users of the same organization
+type Group struct {
+	ID          string
+	OrgID       string
+	Name        string
+	Description string
+	CreatedAt   time.Time
+}
@@ -0,0 +1,25 @@
+package models
+
+import "context"
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	// ID is the id of the user the token was issued to
+	ID      string
+	Name    string
+	Role    string
+	TokenID string
+	// OrgID is the organization the token was issued for
+	OrgID string
+}
+
+// CanManageOrg reports whether the principal is allowed to manage the users and groups of the organization
+func (p Principal) CanManageOrg(orgID string) bool {
+	return p.Role == RoleAdmin || p.Role == RoleOrgAdmin && p.OrgID == orgID
+}
+
+// PrincipalFromContext returns the Principal stored in ctx by the authentication
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(KeyPrincipal).(Principal)
+	return p, ok
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// Session is a signed-in device of a user. Its ID is the jti of the access token.
+type Session struct {
+	ID     string
+	UserID string
+	// Device is a readable description like "Firefox on Windows", or the name the client sent
+	Device     string
+	IP         string
+	UserAgent  string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	ExpiresAt  time.Time
+	// RevokedAt is set when the session was signed out remotely
+	RevokedAt time.Time
+}
+
+// Active reports whether tokens of the session are still accepted at the time now
+func (s Session) Active(now time.Time) bool {
+	return s.RevokedAt.IsZero() && now.Before(s.ExpiresAt)
+}
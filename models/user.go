@@ -1,8 +1,60 @@
 package models
 
-// User type for UsersController
+import "time"
+
+const (
+	// RoleUser is the default role of every user
+	RoleUser = "user"
+	// RoleAdmin is allowed to manage all users and organizations
+	RoleAdmin = "admin"
+	// RoleOrgAdmin is allowed to manage the users and groups of its own organization
+	RoleOrgAdmin = "org_admin"
+)
+
+const (
+	// StatusActive users can sign in
+	StatusActive = "active"
+	// StatusDisabled users can neither sign in nor use previously issued tokens
+	StatusDisabled = "disabled"
+	// StatusDeleted users are disabled and purged after the retention period
+	StatusDeleted = "deleted"
+)
+
+// User type for UsersController.
+// Never send it to clients directly, use dtos.User instead
 type User struct {
 	ID   string
 	Name string
-	Hash []byte
+	Hash []byte `json:"-"`
+	Role string
+	// OrgID is the organization (tenant) the user belongs to
+	OrgID string
+
+	DisplayName string
+	Email       string
+	Locale      string
+	// Avatar is the key of the current profile picture, empty if the user has none
+	Avatar    string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	// Status is one of StatusActive, StatusDisabled or StatusDeleted
+	Status string
+	// DeletedAt is the time the user got the StatusDeleted
+	DeletedAt time.Time
+
+	// Version is increased by the store on every update
+	Version int64
+	// TokenGeneration is embedded into issued tokens, increasing it invalidates all of them at once
+	TokenGeneration int64
+}
+
+// IsActive reports whether the user is allowed to sign in
+func (u User) IsActive() bool {
+	return u.Status == StatusActive || u.Status == ""
+}
+
+// RevokeTokens invalidates all tokens issued to the user so far, once the user is saved
+func (u *User) RevokeTokens() {
+	u.TokenGeneration++
 }
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Kirides/simpleApi/models"
+	"github.com/Kirides/simpleApi/stores"
+)
+
+// auditVerifyBatchSize is the amount of events read at once while verifying the hash chain
+const auditVerifyBatchSize = 500
+
+// AuditLog appends security-relevant events to an AuditStore.
+// All methods can be called on a nil *AuditLog, which discards every event.
+type AuditLog struct {
+	store stores.AuditStore
+	// HashChain links every event to its predecessor by a SHA-256 hash.
+	// Modifying or removing an event breaks the chain, which is detected by Verify.
+	HashChain bool
+	// m serializes appends, so the predecessor of an event can not change while it is hashed
+	m sync.Mutex
+}
+
+// AuditVerification is the result of AuditLog.Verify
+type AuditVerification struct {
+	Valid bool `json:"valid"`
+	// Checked is the amount of hashed events that were verified
+	Checked int64 `json:"checked"`
+	// BrokenID is the newest event whose hash or link to its predecessor does not match
+	BrokenID int64 `json:"broken_id,omitempty"`
+}
+
+// NewAuditLog ...
+func NewAuditLog(store stores.AuditStore) *AuditLog {
+	return &AuditLog{store: store}
+}
+
+// Record appends the event. Failures are only logged, so they never break the audited action.
+func (l *AuditLog) Record(ctx context.Context, e models.AuditEvent) {
+	if l == nil {
+		return
+	}
+	if _, err := l.Append(ctx, e); err != nil {
+		log.Printf("Could not record audit event '%s'. Error: %v", e.Action, err)
+	}
+}
+
+// Append stores the event, setting its time if missing and its hashes if the chain is enabled
+func (l *AuditLog) Append(ctx context.Context, e models.AuditEvent) (models.AuditEvent, error) {
+	if l == nil {
+		return e, nil
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Time = e.Time.UTC().Truncate(time.Second)
+	e.PrevHash, e.Hash = "", ""
+	l.m.Lock()
+	defer l.m.Unlock()
+	if l.HashChain {
+		last, err := l.store.LastAudit(ctx)
+		if err != nil && !errors.Is(err, stores.ErrNotFound) {
+			return e, err
+		}
+		e.PrevHash = last.Hash
+		e.Hash = AuditHash(e)
+	}
+	return l.store.AppendAudit(ctx, e)
+}
+
+// Find returns the matching events, newest first
+func (l *AuditLog) Find(ctx context.Context, q stores.AuditQuery) ([]models.AuditEvent, error) {
+	if l == nil {
+		return []models.AuditEvent{}, nil
+	}
+	return l.store.FindAudit(ctx, q)
+}
+
+// AuditHash returns the hash of the event, covering every field except ID and Hash itself.
+// The ID is left out because stores assign it after the hash was computed.
+func AuditHash(e models.AuditEvent) string {
+	b, _ := json.Marshal([]interface{}{
+		e.PrevHash, e.Time.Unix(), e.Action, e.Outcome, e.ActorID, e.ActorName, e.TargetID,
+		e.OrgID, e.IP, e.UserAgent, e.RequestID, e.Details,
+	})
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// Verify checks the hash of every hashed event and its link to the predecessor.
+// Events recorded while the chain was disabled are skipped. Removing the newest
+// events can not be detected, compare the newest hash with a copy kept elsewhere for that.
+func (l *AuditLog) Verify(ctx context.Context) (AuditVerification, error) {
+	result := AuditVerification{Valid: true}
+	if l == nil {
+		return result, nil
+	}
+	q := stores.AuditQuery{Limit: auditVerifyBatchSize}
+	var newer *models.AuditEvent
+	for {
+		events, err := l.store.FindAudit(ctx, q)
+		if err != nil {
+			return result, err
+		}
+		for i := range events {
+			e := events[i]
+			if newer != nil && newer.Hash != "" && newer.PrevHash != e.Hash {
+				result.Valid, result.BrokenID = false, newer.ID
+				return result, nil
+			}
+			if e.Hash != "" {
+				if AuditHash(e) != e.Hash {
+					result.Valid, result.BrokenID = false, e.ID
+					return result, nil
+				}
+				result.Checked++
+			}
+			newer = &e
+		}
+		if len(events) < auditVerifyBatchSize {
+			break
+		}
+		q.BeforeID = events[len(events)-1].ID
+	}
+	if newer != nil && newer.Hash != "" && newer.PrevHash != "" {
+		// the oldest event must not have a predecessor
+		result.Valid, result.BrokenID = false, newer.ID
+	}
+	return result, nil
+}
@@ -0,0 +1,195 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	// decoders of the accepted upload formats
+	_ "image/gif"
+	_ "image/jpeg"
+
+	"github.com/Kirides/simpleApi/stores"
+)
+
+// AvatarContentType is the format avatars are stored and served in
+const AvatarContentType = "image/png"
+
+var (
+	// ErrUnsupportedImage is returned for uploads that are not a JPEG, PNG or GIF image
+	ErrUnsupportedImage = errors.New("Unsupported image, use JPEG, PNG or GIF")
+	// ErrImageTooLarge is returned for uploads exceeding AvatarService.MaxBytes or MaxDimension
+	ErrImageTooLarge = errors.New("Image is too large")
+)
+
+// avatarTypes are the sniffed content types accepted for uploads
+var avatarTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+// AvatarService turns uploaded pictures into square avatars of fixed sizes.
+// Every upload gets a new key, so stored avatars never change and can be cached forever
+type AvatarService struct {
+	blobs stores.BlobStore
+	// MaxBytes is the maximum size of uploads
+	MaxBytes int64
+	// MaxDimension is the maximum width and height of uploads, it protects against decompression bombs
+	MaxDimension int
+	// Sizes are the edge lengths in pixels avatars are stored in
+	Sizes []int
+	// DefaultSize is served if no size is requested, it has to be one of Sizes
+	DefaultSize int
+}
+
+// NewAvatarService ...
+func NewAvatarService(blobs stores.BlobStore) *AvatarService {
+	return &AvatarService{
+		blobs:        blobs,
+		MaxBytes:     5 << 20,
+		MaxDimension: 4096,
+		Sizes:        []int{32, 64, 128, 256},
+		DefaultSize:  128,
+	}
+}
+
+// ValidSize reports whether avatars are stored in size
+func (s *AvatarService) ValidSize(size int) bool {
+	for _, v := range s.Sizes {
+		if v == size {
+			return true
+		}
+	}
+	return false
+}
+
+func avatarBlobKey(key string, size int) string {
+	return "avatars/" + key + "/" + strconv.Itoa(size) + ".png"
+}
+
+// Save stores the picture read from r in all sizes and returns the key of the new avatar
+func (s *AvatarService) Save(ctx context.Context, userID string, r io.Reader) (string, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(r, s.MaxBytes+1))
+	if err != nil {
+		return "", err
+	}
+	if int64(len(data)) > s.MaxBytes {
+		return "", ErrImageTooLarge
+	}
+	if !avatarTypes[http.DetectContentType(data)] {
+		return "", ErrUnsupportedImage
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", ErrUnsupportedImage
+	}
+	if cfg.Width > s.MaxDimension || cfg.Height > s.MaxDimension {
+		return "", ErrImageTooLarge
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", ErrUnsupportedImage
+	}
+	square := cropSquare(img)
+
+	sum := sha256.Sum256(append([]byte(userID+"\x00"), data...))
+	key := hex.EncodeToString(sum[:16])
+	buf := &bytes.Buffer{}
+	for i, size := range s.Sizes {
+		buf.Reset()
+		if err := png.Encode(buf, resizeSquare(square, size)); err != nil {
+			return "", err
+		}
+		if err := s.blobs.Put(ctx, avatarBlobKey(key, size), buf); err != nil {
+			// the sizes stored so far are removed even if ctx is done
+			s.deleteSizes(context.Background(), key, s.Sizes[:i])
+			return "", fmt.Errorf("Could not store avatar. Error: %v", err)
+		}
+	}
+	return key, nil
+}
+
+// Open returns the avatar of key in size
+func (s *AvatarService) Open(ctx context.Context, key string, size int) (io.ReadCloser, stores.BlobInfo, error) {
+	return s.blobs.Open(ctx, avatarBlobKey(key, size))
+}
+
+// Delete removes all sizes of the avatar
+func (s *AvatarService) Delete(ctx context.Context, key string) error {
+	return s.deleteSizes(ctx, key, s.Sizes)
+}
+
+func (s *AvatarService) deleteSizes(ctx context.Context, key string, sizes []int) error {
+	var result error
+	for _, size := range sizes {
+		if err := s.blobs.Delete(ctx, avatarBlobKey(key, size)); err != nil && !errors.Is(err, stores.ErrNotFound) {
+			result = err
+		}
+	}
+	return result
+}
+
+// cropSquare returns the centered square of img with premultiplied colors
+func cropSquare(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	edge := b.Dx()
+	if b.Dy() < edge {
+		edge = b.Dy()
+	}
+	origin := image.Pt(b.Min.X+(b.Dx()-edge)/2, b.Min.Y+(b.Dy()-edge)/2)
+	square := image.NewRGBA(image.Rect(0, 0, edge, edge))
+	draw.Draw(square, square.Bounds(), img, origin, draw.Src)
+	return square
+}
+
+// resizeSquare scales src to size x size pixels.
+// Every target pixel is the average of the source pixels it covers (box filter),
+// which is good enough for downscaling photos to thumbnails.
+func resizeSquare(src *image.RGBA, size int) *image.RGBA {
+	edge := src.Bounds().Dx()
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	if edge == 0 {
+		return dst
+	}
+	for y := 0; y < size; y++ {
+		y0, y1 := y*edge/size, (y+1)*edge/size
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < size; x++ {
+			x0, x1 := x*edge/size, (x+1)*edge/size
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r += uint64(p[0])
+					g += uint64(p[1])
+					b += uint64(p[2])
+					a += uint64(p[3])
+					n++
+				}
+			}
+			d := dst.Pix[y*dst.Stride+x*4:]
+			d[0] = uint8(r / n)
+			d[1] = uint8(g / n)
+			d[2] = uint8(b / n)
+			d[3] = uint8(a / n)
+		}
+	}
+	return dst
+}
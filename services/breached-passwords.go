@@ -0,0 +1,110 @@
+package services
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// hibpPrefixLength is the length of the SHA-1 prefix used by the HIBP range API
+const hibpPrefixLength = 5
+
+// BreachedPasswordList allows checking if a password is known to be breached
+type BreachedPasswordList interface {
+	Contains(password string) (bool, error)
+}
+
+// LoadBreachedPasswordList opens a breached-password list from disk.
+// If path is a directory it is treated as a HIBP range-dump, containing one file per
+// 5-character SHA-1 prefix (e.g. "21BD1" or "21BD1.txt") with "SUFFIX:COUNT" lines.
+// Otherwise path is read as a single file of "SHA1[:COUNT]" lines and held in memory.
+func LoadBreachedPasswordList(path string) (BreachedPasswordList, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("Could not open breached-password list '%s'. Error: %v", path, err)
+	}
+	if info.IsDir() {
+		return &hibpRangeDirectory{dir: path}, nil
+	}
+	return loadSHA1PasswordFile(path)
+}
+
+func sha1Hex(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// hibpRangeDirectory looks up passwords in a directory of HIBP range files,
+// only ever reading the file that matches the hash prefix
+type hibpRangeDirectory struct {
+	dir string
+}
+
+func (d *hibpRangeDirectory) Contains(password string) (bool, error) {
+	hash := sha1Hex(password)
+	prefix, suffix := hash[:hibpPrefixLength], hash[hibpPrefixLength:]
+
+	f, err := os.Open(filepath.Join(d.dir, prefix))
+	if os.IsNotExist(err) {
+		f, err = os.Open(filepath.Join(d.dir, prefix+".txt"))
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			line = line[:i]
+		}
+		if strings.EqualFold(line, suffix) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// sha1PasswordSet is an in-memory set of SHA-1 password hashes
+type sha1PasswordSet map[string]struct{}
+
+func loadSHA1PasswordFile(path string) (sha1PasswordSet, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	set := sha1PasswordSet{}
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			line = line[:i]
+		}
+		if len(line) != sha1.Size*2 {
+			return nil, fmt.Errorf("Invalid SHA-1 hash in '%s' on line %d", path, lineNo)
+		}
+		set[strings.ToUpper(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+func (s sha1PasswordSet) Contains(password string) (bool, error) {
+	_, ok := s[sha1Hex(password)]
+	return ok, nil
+}
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// maxDeviceLength is the maximum amount of bytes of a device name
+const maxDeviceLength = 100
+
+// userAgentBrowsers maps tokens of a User-Agent to browser names.
+// The order matters, because e.g. Edge also claims to be Chrome and Safari.
+var userAgentBrowsers = []struct{ token, name string }{
+	{"Edg/", "Edge"},
+	{"OPR/", "Opera"},
+	{"Firefox/", "Firefox"},
+	{"Chrome/", "Chrome"},
+	{"Safari/", "Safari"},
+}
+
+// userAgentSystems maps tokens of a User-Agent to operating system names
+var userAgentSystems = []struct{ token, name string }{
+	{"Android", "Android"},
+	{"iPhone", "iOS"},
+	{"iPad", "iPadOS"},
+	{"Windows", "Windows"},
+	{"Mac OS X", "macOS"},
+	{"CrOS", "ChromeOS"},
+	{"Linux", "Linux"},
+}
+
+// DeviceName returns a short readable description like "Firefox on Windows" for a User-Agent header.
+// Clients that are no browsers are named by their product, e.g. "curl".
+func DeviceName(userAgent string) string {
+	var browser, system string
+	for _, b := range userAgentBrowsers {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	for _, s := range userAgentSystems {
+		if strings.Contains(userAgent, s.token) {
+			system = s.name
+			break
+		}
+	}
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	}
+	product := strings.TrimSpace(userAgent)
+	if i := strings.IndexAny(product, "/ "); i >= 0 {
+		product = product[:i]
+	}
+	if product == "" {
+		return "Unknown device"
+	}
+	return TruncateDeviceName(product)
+}
+
+// TruncateDeviceName shortens a device name chosen by a client to at most 100 bytes, without splitting characters
+func TruncateDeviceName(name string) string {
+	name = strings.TrimSpace(name)
+	if len(name) <= maxDeviceLength {
+		return name
+	}
+	cut := maxDeviceLength
+	for cut > 0 && !utf8.RuneStart(name[cut]) {
+		cut--
+	}
+	return name[:cut]
+}
@@ -0,0 +1,312 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrPasswordMismatch is returned when a password does not match its hash
+var ErrPasswordMismatch = errors.New("Password does not match")
+
+// ErrUnknownHashAlgorithm is returned for hashes of an algorithm no hasher is registered for
+var ErrUnknownHashAlgorithm = errors.New("Unknown password hash algorithm")
+
+// PasswordHasher creates and verifies PHC-string formatted password hashes
+// ($<id>[$<param>=<value>(,<param>=<value>)*][$<salt>[$<hash>]])
+type PasswordHasher interface {
+	Hash(password []byte) ([]byte, error)
+	// Verify returns nil if the password matches the hash.
+	// needsRehash reports whether the hash was created with outdated parameters or algorithm
+	Verify(hash, password []byte) (needsRehash bool, err error)
+	// Recognizes reports whether hash is a well-formed hash the hasher is able to verify,
+	// including that its parameters are within the limits of the hasher
+	Recognizes(hash []byte) bool
+}
+
+// HashAlgorithm is a PasswordHasher for a single algorithm
+type HashAlgorithm interface {
+	PasswordHasher
+	// Identifies reports whether the PHC identifier (e.g. "argon2id") belongs to this algorithm
+	Identifies(id string) bool
+}
+
+// PasswordHashers hashes with the preferred algorithm and verifies
+// against whichever algorithm a stored hash uses
+type PasswordHashers struct {
+	Preferred HashAlgorithm
+	Others    []HashAlgorithm
+}
+
+// NewPasswordHasher creates a PasswordHasher that hashes using preferred
+// and is able to verify hashes of all supplied algorithms
+func NewPasswordHasher(preferred HashAlgorithm, others ...HashAlgorithm) *PasswordHashers {
+	return &PasswordHashers{
+		Preferred: preferred,
+		Others:    others,
+	}
+}
+
+// DefaultPasswordHasher hashes using Argon2id and still verifies bcrypt hashes
+func DefaultPasswordHasher() *PasswordHashers {
+	return NewPasswordHasher(NewArgon2idHasher(), NewBcryptHasher())
+}
+
+// Hash ...
+func (h *PasswordHashers) Hash(password []byte) ([]byte, error) {
+	return h.Preferred.Hash(password)
+}
+
+// Verify ...
+func (h *PasswordHashers) Verify(hash, password []byte) (bool, error) {
+	id := phcIdentifier(hash)
+	if h.Preferred.Identifies(id) {
+		return h.Preferred.Verify(hash, password)
+	}
+	for _, alg := range h.Others {
+		if alg.Identifies(id) {
+			if _, err := alg.Verify(hash, password); err != nil {
+				return false, err
+			}
+			return true, nil
+		}
+	}
+	return false, ErrUnknownHashAlgorithm
+}
+
+// Recognizes ...
+func (h *PasswordHashers) Recognizes(hash []byte) bool {
+	if h.Preferred.Recognizes(hash) {
+		return true
+	}
+	for _, alg := range h.Others {
+		if alg.Recognizes(hash) {
+			return true
+		}
+	}
+	return false
+}
+
+// dummyHashes caches the hash VerifyDummy verifies against for every hasher
+var dummyHashes sync.Map
+
+// VerifyDummy verifies the password against a fixed hash of the hasher and discards the result.
+// Call it when there is no user to verify against, so the response time does not reveal which usernames exist.
+func VerifyDummy(h PasswordHasher, password []byte) {
+	hash, ok := dummyHashes.Load(h)
+	if !ok {
+		created, err := h.Hash([]byte("password of a user that does not exist"))
+		if err != nil {
+			return
+		}
+		hash, _ = dummyHashes.LoadOrStore(h, created)
+	}
+	h.Verify(hash.([]byte), password)
+}
+
+func phcIdentifier(hash []byte) string {
+	if len(hash) == 0 || hash[0] != '$' {
+		return ""
+	}
+	id := hash[1:]
+	if i := bytes.IndexByte(id, '$'); i >= 0 {
+		id = id[:i]
+	}
+	return string(id)
+}
+
+// BcryptHasher ...
+type BcryptHasher struct {
+	Cost int
+	// MaxCost limits the cost of hashes that are verified, every step doubles the time verifying takes.
+	// The cost of the hasher itself is always allowed.
+	MaxCost int
+}
+
+// NewBcryptHasher creates a BcryptHasher using bcrypt.DefaultCost
+func NewBcryptHasher() *BcryptHasher {
+	return &BcryptHasher{Cost: bcrypt.DefaultCost, MaxCost: 14}
+}
+
+// checkCost returns an error if the cost of the hash exceeds the limit of the hasher
+func (h *BcryptHasher) checkCost(hash []byte) error {
+	cost, err := bcrypt.Cost(hash)
+	if err != nil {
+		return err
+	}
+	if cost > h.MaxCost && cost > h.Cost {
+		return fmt.Errorf("Invalid bcrypt cost '%d', expected at most %d", cost, h.MaxCost)
+	}
+	return nil
+}
+
+// Identifies ...
+func (h *BcryptHasher) Identifies(id string) bool {
+	switch id {
+	case "2", "2a", "2b", "2x", "2y":
+		return true
+	}
+	return false
+}
+
+// Hash ...
+func (h *BcryptHasher) Hash(password []byte) ([]byte, error) {
+	return bcrypt.GenerateFromPassword(password, h.Cost)
+}
+
+// Verify ...
+func (h *BcryptHasher) Verify(hash, password []byte) (bool, error) {
+	if err := h.checkCost(hash); err != nil {
+		return false, err
+	}
+	if err := bcrypt.CompareHashAndPassword(hash, password); err != nil {
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return false, ErrPasswordMismatch
+		}
+		return false, err
+	}
+	cost, err := bcrypt.Cost(hash)
+	if err != nil {
+		return false, err
+	}
+	return cost < h.Cost, nil
+}
+
+// Recognizes ...
+func (h *BcryptHasher) Recognizes(hash []byte) bool {
+	if !h.Identifies(phcIdentifier(hash)) {
+		return false
+	}
+	return h.checkCost(hash) == nil
+}
+
+// Bounds of the salt and key of argon2id hashes that are verified,
+// hashes outside of them were not created by any sane configuration
+const (
+	argon2idMinSaltLength = 8
+	argon2idMaxSaltLength = 64
+	argon2idMinKeyLength  = 16
+	argon2idMaxKeyLength  = 128
+)
+
+// Argon2idHasher ...
+type Argon2idHasher struct {
+	Time       uint32
+	Memory     uint32 // in KiB
+	Threads    uint8
+	KeyLength  uint32
+	SaltLength uint32
+	// MaxTime and MaxMemory (in KiB) limit the parameters of hashes that are verified,
+	// so a stored or imported hash can not make verifying exhaust the CPU or memory.
+	// The parameters of the hasher itself are always allowed.
+	MaxTime   uint32
+	MaxMemory uint32
+}
+
+// NewArgon2idHasher creates an Argon2idHasher with the parameters recommended by OWASP
+func NewArgon2idHasher() *Argon2idHasher {
+	return &Argon2idHasher{
+		Time:       2,
+		Memory:     19 * 1024,
+		Threads:    1,
+		KeyLength:  32,
+		SaltLength: 16,
+		MaxTime:    16,
+		MaxMemory:  256 * 1024,
+	}
+}
+
+// Identifies ...
+func (h *Argon2idHasher) Identifies(id string) bool {
+	return id == "argon2id"
+}
+
+// Hash ...
+func (h *Argon2idHasher) Hash(password []byte) ([]byte, error) {
+	salt := make([]byte, h.SaltLength)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	key := argon2.IDKey(password, salt, h.Time, h.Memory, h.Threads, h.KeyLength)
+	return []byte(fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.Memory, h.Time, h.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key))), nil
+}
+
+// Verify ...
+func (h *Argon2idHasher) Verify(hash, password []byte) (bool, error) {
+	p, salt, key, err := h.decode(hash)
+	if err != nil {
+		return false, err
+	}
+	otherKey := argon2.IDKey(password, salt, p.Time, p.Memory, p.Threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(key, otherKey) != 1 {
+		return false, ErrPasswordMismatch
+	}
+	needsRehash := p.Memory != h.Memory || p.Time != h.Time || p.Threads != h.Threads ||
+		uint32(len(key)) != h.KeyLength || uint32(len(salt)) != h.SaltLength
+	return needsRehash, nil
+}
+
+// Recognizes ...
+func (h *Argon2idHasher) Recognizes(hash []byte) bool {
+	_, _, _, err := h.decode(hash)
+	return err == nil
+}
+
+// decode returns the parameters, salt and key of an argon2id hash.
+// Hashes whose parameters would make verifying fail or exceed the limits of the hasher are rejected.
+func (h *Argon2idHasher) decode(hash []byte) (p Argon2idHasher, salt, key []byte, err error) {
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, key
+	parts := strings.Split(string(hash), "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return p, nil, nil, fmt.Errorf("Invalid argon2id hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, fmt.Errorf("Unsupported argon2id version '%s'", parts[2])
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Time, &p.Threads); err != nil {
+		return p, nil, nil, fmt.Errorf("Invalid argon2id parameters '%s'", parts[3])
+	}
+	if p.Time < 1 || p.Time > maxUint32(h.MaxTime, h.Time) {
+		return p, nil, nil, fmt.Errorf("Invalid argon2id time '%d', expected 1 to %d", p.Time, maxUint32(h.MaxTime, h.Time))
+	}
+	if p.Threads < 1 {
+		return p, nil, nil, fmt.Errorf("Invalid argon2id parallelism '%d'", p.Threads)
+	}
+	// argon2 needs at least 8 KiB per thread
+	if p.Memory < 8*uint32(p.Threads) || p.Memory > maxUint32(h.MaxMemory, h.Memory) {
+		return p, nil, nil, fmt.Errorf("Invalid argon2id memory '%d' KiB, expected %d to %d", p.Memory, 8*uint32(p.Threads), maxUint32(h.MaxMemory, h.Memory))
+	}
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return p, nil, nil, fmt.Errorf("Invalid argon2id salt. Error: %v", err)
+	}
+	if len(salt) < argon2idMinSaltLength || len(salt) > argon2idMaxSaltLength {
+		return p, nil, nil, fmt.Errorf("Invalid argon2id salt length '%d', expected %d to %d bytes", len(salt), argon2idMinSaltLength, argon2idMaxSaltLength)
+	}
+	if key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return p, nil, nil, fmt.Errorf("Invalid argon2id key. Error: %v", err)
+	}
+	if len(key) < argon2idMinKeyLength || len(key) > argon2idMaxKeyLength {
+		return p, nil, nil, fmt.Errorf("Invalid argon2id key length '%d', expected %d to %d bytes", len(key), argon2idMinKeyLength, argon2idMaxKeyLength)
+	}
+	return p, salt, key, nil
+}
+
+func maxUint32(a, b uint32) uint32 {
+	if a > b {
+		return a
+	}
+	return b
+}
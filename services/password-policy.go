@@ -0,0 +1,68 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"unicode/utf8"
+)
+
+// bcryptMaxPasswordLength is the amount of bytes bcrypt takes into account,
+// everything after it is silently ignored
+const bcryptMaxPasswordLength = 72
+
+// ErrPasswordContainsUsername ...
+var ErrPasswordContainsUsername = errors.New("Password must not contain the username")
+
+// ErrPasswordBreached ...
+var ErrPasswordBreached = errors.New("Password is known to be part of a data breach, please choose a different one")
+
+// PasswordPolicy validates passwords before they are hashed and stored
+type PasswordPolicy struct {
+	// MinLength is the minimum amount of characters a password needs
+	MinLength int
+	// MaxLength is the maximum amount of bytes a password may have
+	MaxLength int
+	// DisallowUsername rejects passwords that contain the username (case-insensitive)
+	DisallowUsername bool
+	// Breached is an optional list of known breached passwords
+	Breached BreachedPasswordList
+}
+
+// NewPasswordPolicy creates a PasswordPolicy with sane defaults and no breached-password list
+func NewPasswordPolicy() *PasswordPolicy {
+	return &PasswordPolicy{
+		MinLength:        8,
+		MaxLength:        bcryptMaxPasswordLength,
+		DisallowUsername: true,
+	}
+}
+
+// Validate checks the password of the given user against the policy.
+// The returned error is meant to be shown to the user.
+func (p *PasswordPolicy) Validate(username, password string) error {
+	if !utf8.ValidString(password) {
+		return fmt.Errorf("Password contains invalid characters")
+	}
+	if p.MinLength > 0 && utf8.RuneCountInString(password) < p.MinLength {
+		return fmt.Errorf("Password must be at least %d characters long", p.MinLength)
+	}
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		return fmt.Errorf("Password must not be longer than %d bytes", p.MaxLength)
+	}
+	if p.DisallowUsername && username != "" &&
+		strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		return ErrPasswordContainsUsername
+	}
+	if p.Breached != nil {
+		// a broken list must not lock everyone out, so we only log here
+		breached, err := p.Breached.Contains(password)
+		if err != nil {
+			log.Printf("Could not check password against breached passwords. Error: %v", err)
+		} else if breached {
+			return ErrPasswordBreached
+		}
+	}
+	return nil
+}
@@ -1,16 +1,22 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log"
 
 	"github.com/Kirides/simpleApi/models"
 	"github.com/Kirides/simpleApi/stores"
-	"golang.org/x/crypto/bcrypt"
 )
 
+// ErrAccountDisabled is returned for valid credentials of users that are not active
+var ErrAccountDisabled = errors.New("Account is disabled")
+
 // SignInManager ...
 type SignInManager struct {
-	us stores.UserStore
+	us             stores.UserStore
+	PasswordHasher PasswordHasher
 }
 
 // NewSignInManager ...
@@ -19,23 +25,52 @@ func NewSignInManager(us stores.UserStore) (*SignInManager, error) {
 		return nil, fmt.Errorf("No valid userstore was provided")
 	}
 	return &SignInManager{
-		us: us,
+		us:             us,
+		PasswordHasher: DefaultPasswordHasher(),
 	}, nil
 }
 
 // LogIn ...
-func (sim *SignInManager) LogIn(name string, password []byte) (models.User, error) {
-	user, err := sim.us.GetByName(name)
+func (sim *SignInManager) LogIn(ctx context.Context, name string, password []byte) (models.User, error) {
+	user, err := sim.us.GetByName(ctx, name)
 	if err != nil {
+		if errors.Is(err, stores.ErrNotFound) {
+			// unknown users take as long as wrong passwords
+			VerifyDummy(sim.PasswordHasher, password)
+		}
 		return models.User{}, err
 	}
 
-	if err := bcrypt.CompareHashAndPassword(user.Hash, password); err != nil {
+	needsRehash, err := sim.PasswordHasher.Verify(user.Hash, password)
+	if err != nil {
 		return models.User{}, err
 	}
+	if !user.IsActive() {
+		return models.User{}, ErrAccountDisabled
+	}
+	if needsRehash {
+		if user, err = RehashPassword(ctx, sim.us, sim.PasswordHasher, user, password); err != nil {
+			log.Printf("Could not upgrade password hash of user '%s'. Error: %v", user.ID, err)
+		}
+	}
 	return user, nil
 }
 
+// RehashPassword hashes the password with the current parameters of the hasher
+// and stores the new hash. The user is returned unchanged if anything fails.
+func RehashPassword(ctx context.Context, us stores.UserStore, hasher PasswordHasher, user models.User, password []byte) (models.User, error) {
+	hash, err := hasher.Hash(password)
+	if err != nil {
+		return user, err
+	}
+	updated := user
+	updated.Hash = hash
+	if err := us.Update(ctx, updated); err != nil {
+		return user, err
+	}
+	return updated, nil
+}
+
 // LogOut ...
 func (sim *SignInManager) LogOut(u models.User) (bool, error) {
 
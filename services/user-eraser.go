@@ -0,0 +1,58 @@
+package services
+
+import (
+	"context"
+	"log"
+
+	"github.com/Kirides/simpleApi/models"
+	"github.com/Kirides/simpleApi/stores"
+)
+
+// UserEraser permanently removes users together with the data other stores keep about them.
+// Stores that are not set are skipped.
+type UserEraser struct {
+	us stores.UserStore
+	// Orgs removes the group memberships
+	Orgs stores.OrgStore
+	// Avatars removes the profile picture
+	Avatars *AvatarService
+	// Invitations removes accepted invitations and the user as inviter
+	Invitations stores.InvitationStore
+	// Sessions removes the sessions
+	Sessions stores.SessionStore
+}
+
+// NewUserEraser ...
+func NewUserEraser(us stores.UserStore) *UserEraser {
+	return &UserEraser{us: us}
+}
+
+// Erase deletes the user, which fails with stores.ErrVersionConflict if it was modified since it was read.
+// Afterwards every remaining reference is removed, failures are only logged
+// because the user itself is already gone and previously issued tokens are rejected.
+func (e *UserEraser) Erase(ctx context.Context, u models.User) error {
+	if err := e.us.Delete(ctx, u.ID, u.Version); err != nil {
+		return err
+	}
+	if e.Orgs != nil {
+		if err := e.Orgs.RemoveUserMemberships(ctx, u.ID); err != nil {
+			log.Printf("Could not remove group memberships of erased user '%s'. Error: %v", u.ID, err)
+		}
+	}
+	if e.Avatars != nil && u.Avatar != "" {
+		if err := e.Avatars.Delete(ctx, u.Avatar); err != nil {
+			log.Printf("Could not remove avatar of erased user '%s'. Error: %v", u.ID, err)
+		}
+	}
+	if e.Invitations != nil {
+		if err := e.Invitations.RemoveUserReferences(ctx, u.ID); err != nil {
+			log.Printf("Could not remove invitations of erased user '%s'. Error: %v", u.ID, err)
+		}
+	}
+	if e.Sessions != nil {
+		if err := e.Sessions.RemoveUserSessions(ctx, u.ID); err != nil {
+			log.Printf("Could not remove sessions of erased user '%s'. Error: %v", u.ID, err)
+		}
+	}
+	return nil
+}
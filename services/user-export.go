@@ -0,0 +1,92 @@
+package services
+
+import (
+	"context"
+	"io"
+
+	"github.com/Kirides/simpleApi/models"
+	"github.com/Kirides/simpleApi/stores"
+)
+
+// UserExporter writes users as CSV or JSON Lines, reading them from the store page by page
+type UserExporter struct {
+	us       stores.UserStore
+	PageSize int64
+	// IncludePasswordHashes exports the password hashes, so users can be imported into another instance
+	IncludePasswordHashes bool
+}
+
+// NewUserExporter ...
+func NewUserExporter(us stores.UserStore) *UserExporter {
+	return &UserExporter{
+		us:       us,
+		PageSize: 500,
+	}
+}
+
+// flusher is implemented by writers that buffer, like http.ResponseWriter
+type flusher interface {
+	Flush()
+}
+
+// Export writes all users matching the filters and sort order of q and returns their amount.
+// Cursors and paging of q are ignored.
+func (ex *UserExporter) Export(ctx context.Context, w io.Writer, format string, q stores.UserQuery) (int, error) {
+	records, err := newUserRecordWriter(w, format, ex.IncludePasswordHashes)
+	if err != nil {
+		return 0, err
+	}
+	q.After, q.Before, q.Offset = nil, nil, 0
+	q.Limit = ex.PageSize
+	if q.Limit <= 0 {
+		q.Limit = 500
+	}
+	n := 0
+	for {
+		users, err := ex.us.Find(ctx, q)
+		if err != nil {
+			return n, err
+		}
+		for _, u := range users {
+			if err := records.Write(ex.userToRecord(u)); err != nil {
+				return n, err
+			}
+			n++
+		}
+		if err := records.Flush(); err != nil {
+			return n, err
+		}
+		if f, ok := w.(flusher); ok {
+			f.Flush()
+		}
+		if int64(len(users)) < q.Limit {
+			return n, nil
+		}
+		q.After = stores.NewUserCursor(q.SortBy, users[len(users)-1])
+	}
+}
+
+func (ex *UserExporter) userToRecord(u models.User) UserRecord {
+	rec := UserRecord{
+		ID:          u.ID,
+		Username:    u.Name,
+		Email:       u.Email,
+		DisplayName: u.DisplayName,
+		Locale:      u.Locale,
+		Role:        u.Role,
+		Org:         u.OrgID,
+		Status:      u.Status,
+	}
+	if !u.CreatedAt.IsZero() {
+		createdAt := u.CreatedAt
+		rec.CreatedAt = &createdAt
+	}
+	if !u.UpdatedAt.IsZero() {
+		updatedAt := u.UpdatedAt
+		rec.UpdatedAt = &updatedAt
+	}
+	if ex.IncludePasswordHashes {
+		rec.PasswordHash = string(u.Hash)
+	}
+	return rec
+}
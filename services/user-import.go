@@ -0,0 +1,251 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/Kirides/simpleApi/models"
+	"github.com/Kirides/simpleApi/stores"
+)
+
+// UserImporter creates users from CSV or JSON Lines streams.
+// Every record is validated on its own, invalid records are reported and skipped.
+// Valid users are inserted in batches, each batch in a single transaction.
+type UserImporter struct {
+	us             stores.UserStore
+	PasswordPolicy *PasswordPolicy
+	PasswordHasher PasswordHasher
+	// BatchSize is the amount of users inserted per transaction
+	BatchSize int
+	// OrgID assigns all users to the organization, records of other organizations are rejected.
+	// If empty, the org of the record is used, defaulting to models.DefaultOrgID
+	OrgID string
+	// Orgs is used to check the org of the records, if set
+	Orgs stores.OrgStore
+	// AdminRoleAllowed permits importing users with the role models.RoleAdmin
+	AdminRoleAllowed bool
+}
+
+// UserImportError describes why a record was not imported
+type UserImportError struct {
+	// Line is the line of the record in the imported file
+	Line     int    `json:"line"`
+	Username string `json:"username,omitempty"`
+	Error    string `json:"error"`
+}
+
+// UserImportResult summarizes an import
+type UserImportResult struct {
+	DryRun bool `json:"dry_run"`
+	// Total is the amount of records read
+	Total int `json:"total"`
+	// Imported is the amount of users inserted, or the amount that would have been inserted on a dry run
+	Imported int               `json:"imported"`
+	Failed   int               `json:"failed"`
+	Errors   []UserImportError `json:"errors"`
+}
+
+// NewUserImporter ...
+func NewUserImporter(us stores.UserStore) *UserImporter {
+	return &UserImporter{
+		us:               us,
+		PasswordPolicy:   NewPasswordPolicy(),
+		PasswordHasher:   DefaultPasswordHasher(),
+		BatchSize:        500,
+		AdminRoleAllowed: true,
+	}
+}
+
+// pendingUser is a validated user waiting for its batch to be inserted
+type pendingUser struct {
+	line int
+	user models.User
+}
+
+// Import reads all records of r in the specified format.
+// A dry run validates all records without inserting any users.
+// If reading fails, the result of the records read until then is returned along with the error.
+func (im *UserImporter) Import(ctx context.Context, r io.Reader, format string, dryRun bool) (UserImportResult, error) {
+	result := UserImportResult{DryRun: dryRun, Errors: []UserImportError{}}
+	records, err := newUserRecordReader(r, format)
+	if err != nil {
+		return result, err
+	}
+	batchSize := im.BatchSize
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+	seen := map[string]bool{}
+	batch := make([]pendingUser, 0, batchSize)
+	for {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		rec, line, err := records.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if _, ok := err.(*recordError); !ok {
+				im.insertBatch(ctx, &result, batch)
+				return result, fmt.Errorf("Could not read line %d. Error: %v", line, err)
+			}
+		}
+		result.Total++
+		if err == nil {
+			err = im.validateRecord(ctx, rec, seen)
+		}
+		if err != nil {
+			result.fail(line, rec.Username, err)
+			continue
+		}
+		u, err := im.recordToUser(rec, dryRun)
+		if err != nil {
+			result.fail(line, rec.Username, err)
+			continue
+		}
+		seen[stores.NormalizeUserName(u.Name)] = true
+		if dryRun {
+			result.Imported++
+			continue
+		}
+		batch = append(batch, pendingUser{line: line, user: u})
+		if len(batch) == batchSize {
+			im.insertBatch(ctx, &result, batch)
+			batch = batch[:0]
+		}
+	}
+	im.insertBatch(ctx, &result, batch)
+	return result, nil
+}
+
+func (result *UserImportResult) fail(line int, username string, err error) {
+	result.Failed++
+	result.Errors = append(result.Errors, UserImportError{Line: line, Username: username, Error: err.Error()})
+}
+
+// insertBatch inserts all users of the batch or, if the transaction fails, reports all of them as failed
+func (im *UserImporter) insertBatch(ctx context.Context, result *UserImportResult, batch []pendingUser) {
+	if len(batch) == 0 {
+		return
+	}
+	users := make([]models.User, len(batch))
+	for i, p := range batch {
+		users[i] = p.user
+	}
+	if err := im.us.InsertAll(ctx, users); err != nil {
+		err = fmt.Errorf("Batch was not imported. Error: %v", err)
+		for _, p := range batch {
+			result.fail(p.line, p.user.Name, err)
+		}
+		return
+	}
+	result.Imported += len(batch)
+}
+
+// validateRecord applies the rules of the registration and the users API onto the record.
+// seen contains the normalized names of the users already accepted in the same import.
+func (im *UserImporter) validateRecord(ctx context.Context, rec UserRecord, seen map[string]bool) error {
+	if !ValidUsername(rec.Username) {
+		return fmt.Errorf("Invalid username")
+	}
+	if seen[stores.NormalizeUserName(rec.Username)] {
+		return fmt.Errorf("Duplicate username")
+	}
+	if _, err := im.us.GetByName(ctx, rec.Username); err == nil {
+		return fmt.Errorf("Username already exists")
+	}
+	if rec.Role != "" && !ValidRole(rec.Role) || rec.Role == models.RoleAdmin && !im.AdminRoleAllowed {
+		return fmt.Errorf("Invalid role")
+	}
+	if err := im.validateOrg(ctx, rec.Org); err != nil {
+		return err
+	}
+	if rec.Status != "" && rec.Status != models.StatusActive && rec.Status != models.StatusDisabled {
+		return fmt.Errorf("Invalid status")
+	}
+	if err := ValidateProfile(rec.DisplayName, rec.Email, rec.Locale); err != nil {
+		return err
+	}
+	switch {
+	case rec.Password == "" && rec.PasswordHash == "":
+		return fmt.Errorf("Either password or password_hash is required")
+	case rec.Password != "" && rec.PasswordHash != "":
+		return fmt.Errorf("password and password_hash can not be combined")
+	case rec.Password != "":
+		return im.PasswordPolicy.Validate(rec.Username, rec.Password)
+	}
+	// Recognizes checks the parameters of the hash, a stored hash with absurd ones
+	// would make every sign-in of the user fail or exhaust the server
+	if !im.PasswordHasher.Recognizes([]byte(rec.PasswordHash)) {
+		return fmt.Errorf("Unsupported or invalid password_hash")
+	}
+	return nil
+}
+
+func (im *UserImporter) validateOrg(ctx context.Context, org string) error {
+	if im.OrgID != "" {
+		if org != "" && org != im.OrgID {
+			return fmt.Errorf("Invalid org")
+		}
+		return nil
+	}
+	if org == "" || im.Orgs == nil {
+		return nil
+	}
+	if _, err := im.Orgs.GetOrg(ctx, org); err != nil {
+		if errors.Is(err, stores.ErrNotFound) {
+			return fmt.Errorf("Invalid org")
+		}
+		return fmt.Errorf("Could not check org. Error: %v", err)
+	}
+	return nil
+}
+
+// recordToUser converts a valid record. Passwords are not hashed on a dry run.
+func (im *UserImporter) recordToUser(rec UserRecord, dryRun bool) (models.User, error) {
+	u := models.User{
+		Name:        rec.Username,
+		Hash:        []byte(rec.PasswordHash),
+		Role:        rec.Role,
+		OrgID:       rec.Org,
+		DisplayName: strings.TrimSpace(rec.DisplayName),
+		Email:       rec.Email,
+		Locale:      rec.Locale,
+		Status:      rec.Status,
+	}
+	if im.OrgID != "" {
+		u.OrgID = im.OrgID
+	}
+	if rec.CreatedAt != nil {
+		u.CreatedAt = rec.CreatedAt.UTC()
+	}
+	if rec.Password != "" && !dryRun {
+		hash, err := im.PasswordHasher.Hash([]byte(rec.Password))
+		if err != nil {
+			return u, fmt.Errorf("Could not hash password. Error: %v", err)
+		}
+		u.Hash = hash
+	}
+	return u, nil
+}
+
+// WriteErrorReport writes the errors of the import as CSV with the columns line, username and error
+func (result UserImportResult) WriteErrorReport(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"line", "username", "error"}); err != nil {
+		return err
+	}
+	for _, e := range result.Errors {
+		if err := cw.Write([]string{strconv.Itoa(e.Line), e.Username, e.Error}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,62 @@
+package services_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Kirides/simpleApi/services"
+	"github.com/Kirides/simpleApi/stores"
+)
+
+func TestUserImportRejectsMalformedPasswordHashes(t *testing.T) {
+	ctx := context.Background()
+	hasher := services.DefaultPasswordHasher()
+	valid, err := hasher.Hash([]byte("correct horse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const (
+		salt = "c2FsdHNhbHRzYWx0c2FsdA"
+		key  = "a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U"
+	)
+	malformed := map[string]string{
+		"nokey":      "$argon2id$v=19$m=19456,t=2,p=1$" + salt + "$",
+		"nosalt":     "$argon2id$v=19$m=19456,t=2,p=1$$" + key,
+		"hugememory": "$argon2id$v=19$m=4194304,t=2,p=1$" + salt + "$" + key,
+		"nothreads":  "$argon2id$v=19$m=19456,t=2,p=0$" + salt + "$" + key,
+		"notime":     "$argon2id$v=19$m=19456,t=0,p=1$" + salt + "$" + key,
+		"hugecost":   "$2a$31$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy",
+	}
+	var b strings.Builder
+	b.WriteString(`{"username":"valid","password_hash":"` + string(valid) + `"}` + "\n")
+	for name, hash := range malformed {
+		b.WriteString(`{"username":"` + name + `","password_hash":"` + hash + `"}` + "\n")
+	}
+
+	us := stores.NewMemoryUserStore()
+	im := services.NewUserImporter(us)
+	im.PasswordHasher = hasher
+	result, err := im.Import(ctx, strings.NewReader(b.String()), services.FormatJSONL, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Imported != 1 || result.Failed != len(malformed) {
+		t.Fatalf("imported %d and rejected %d users, expected 1 and %d. Errors: %v", result.Imported, result.Failed, len(malformed), result.Errors)
+	}
+	for _, e := range result.Errors {
+		if _, ok := malformed[e.Username]; !ok {
+			t.Errorf("user '%s' was rejected. Error: %s", e.Username, e.Error)
+		}
+		if _, err := us.GetByName(ctx, e.Username); err == nil {
+			t.Errorf("user '%s' with a malformed hash was stored", e.Username)
+		}
+	}
+	u, err := us.GetByName(ctx, "valid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := hasher.Verify(u.Hash, []byte("correct horse")); err != nil {
+		t.Fatalf("imported hash does not verify. Error: %v", err)
+	}
+}
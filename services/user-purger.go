@@ -0,0 +1,106 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/Kirides/simpleApi/models"
+	"github.com/Kirides/simpleApi/stores"
+)
+
+// purgeBatchSize is the amount of deleted users read at once
+const purgeBatchSize = 100
+
+// UserPurger permanently removes users that are deleted for longer than the retention period
+type UserPurger struct {
+	us        stores.UserStore
+	Retention time.Duration
+	// Eraser removes purged users and their data
+	Eraser *UserEraser
+	// Audit records every purged user, if set
+	Audit *AuditLog
+	// Sessions removes expired sessions on every run, if set
+	Sessions stores.SessionStore
+	// Tokens removes expired revoked tokens on every run, if set
+	Tokens stores.TokenStore
+}
+
+// NewUserPurger ...
+func NewUserPurger(us stores.UserStore, retention time.Duration) *UserPurger {
+	return &UserPurger{
+		us:        us,
+		Retention: retention,
+		Eraser:    NewUserEraser(us),
+	}
+}
+
+// Purge removes all users whose retention period is over and returns their amount
+func (p *UserPurger) Purge(ctx context.Context) (int, error) {
+	deadline := time.Now().Add(-p.Retention)
+	query := stores.UserQuery{
+		Statuses: []string{models.StatusDeleted},
+		Limit:    purgeBatchSize,
+	}
+	purged := 0
+	for {
+		users, err := p.us.Find(ctx, query)
+		if err != nil {
+			return purged, err
+		}
+		for _, u := range users {
+			if u.DeletedAt.After(deadline) {
+				continue
+			}
+			if err := p.Eraser.Erase(ctx, u); err != nil {
+				if errors.Is(err, stores.ErrNotFound) || errors.Is(err, stores.ErrVersionConflict) {
+					// restored or purged concurrently
+					continue
+				}
+				return purged, err
+			}
+			p.Audit.Record(ctx, models.AuditEvent{
+				Action:    models.AuditUserErased,
+				Outcome:   models.AuditSuccess,
+				ActorName: "purger",
+				TargetID:  u.ID,
+				OrgID:     u.OrgID,
+				Details:   "retention period of deleted user is over",
+			})
+			purged++
+		}
+		if len(users) < purgeBatchSize {
+			return purged, nil
+		}
+		query.After = stores.NewUserCursor(query.SortBy, users[len(users)-1])
+	}
+}
+
+// Run purges users, expired sessions and tokens every interval until ctx is done
+func (p *UserPurger) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if n, err := p.Purge(ctx); err != nil {
+			log.Printf("Could not purge deleted users. Error: %v", err)
+		} else if n > 0 {
+			log.Printf("purged %d deleted users", n)
+		}
+		if p.Sessions != nil {
+			if _, err := p.Sessions.RemoveExpiredSessions(ctx, time.Now()); err != nil {
+				log.Printf("Could not remove expired sessions. Error: %v", err)
+			}
+		}
+		if p.Tokens != nil {
+			if _, err := p.Tokens.RemoveExpired(ctx, time.Now()); err != nil {
+				log.Printf("Could not remove expired tokens. Error: %v", err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
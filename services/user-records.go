@@ -0,0 +1,295 @@
+package services
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Formats supported by UserImporter and UserExporter
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+)
+
+// ValidUserFormat reports whether format is supported by UserImporter and UserExporter
+func ValidUserFormat(format string) bool {
+	return format == FormatCSV || format == FormatJSONL
+}
+
+// UserRecord is a single user of an import or export.
+// CSV files use the json names as column headers.
+type UserRecord struct {
+	ID          string     `json:"id,omitempty"`
+	Username    string     `json:"username"`
+	Email       string     `json:"email,omitempty"`
+	DisplayName string     `json:"display_name,omitempty"`
+	Locale      string     `json:"locale,omitempty"`
+	Role        string     `json:"role,omitempty"`
+	Org         string     `json:"org,omitempty"`
+	Status      string     `json:"status,omitempty"`
+	CreatedAt   *time.Time `json:"created_at,omitempty"`
+	UpdatedAt   *time.Time `json:"updated_at,omitempty"`
+	// Password is only read by imports and hashed before it is stored
+	Password string `json:"password,omitempty"`
+	// PasswordHash is a PHC string a PasswordHasher recognizes, used to migrate existing accounts
+	PasswordHash string `json:"password_hash,omitempty"`
+}
+
+// userRecordColumns are the CSV columns in the order they are exported
+var userRecordColumns = []string{
+	"id", "username", "email", "display_name", "locale", "role", "org", "status", "created_at", "updated_at", "password_hash",
+}
+
+func (r UserRecord) csvValue(column string) string {
+	switch column {
+	case "id":
+		return r.ID
+	case "username":
+		return r.Username
+	case "email":
+		return r.Email
+	case "display_name":
+		return r.DisplayName
+	case "locale":
+		return r.Locale
+	case "role":
+		return r.Role
+	case "org":
+		return r.Org
+	case "status":
+		return r.Status
+	case "created_at":
+		return formatRecordTime(r.CreatedAt)
+	case "updated_at":
+		return formatRecordTime(r.UpdatedAt)
+	case "password":
+		return r.Password
+	case "password_hash":
+		return r.PasswordHash
+	}
+	return ""
+}
+
+func (r *UserRecord) setCSVValue(column, value string) error {
+	var err error
+	switch column {
+	case "id":
+		r.ID = value
+	case "username":
+		r.Username = value
+	case "email":
+		r.Email = value
+	case "display_name":
+		r.DisplayName = value
+	case "locale":
+		r.Locale = value
+	case "role":
+		r.Role = value
+	case "org":
+		r.Org = value
+	case "status":
+		r.Status = value
+	case "created_at":
+		r.CreatedAt, err = parseRecordTime(value)
+	case "updated_at":
+		r.UpdatedAt, err = parseRecordTime(value)
+	case "password":
+		r.Password = value
+	case "password_hash":
+		r.PasswordHash = value
+	}
+	if err != nil {
+		return fmt.Errorf("%s must be a RFC 3339 timestamp", column)
+	}
+	return nil
+}
+
+func formatRecordTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+func parseRecordTime(v string) (*time.Time, error) {
+	if v == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// userRecordReader reads records one by one.
+// Errors of a single record are returned as *recordError, all other errors end the read.
+type userRecordReader interface {
+	// Read returns io.EOF after the last record
+	Read() (UserRecord, int, error)
+}
+
+// recordError is an invalid record that does not prevent reading the following ones
+type recordError struct {
+	err error
+}
+
+func (e *recordError) Error() string {
+	return e.err.Error()
+}
+
+func newUserRecordReader(r io.Reader, format string) (userRecordReader, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVRecordReader(r)
+	case FormatJSONL:
+		return newJSONLRecordReader(r), nil
+	}
+	return nil, fmt.Errorf("Unknown format '%s'", format)
+}
+
+type csvRecordReader struct {
+	r       *csv.Reader
+	columns []string
+}
+
+// newCSVRecordReader reads the header, which names the column of every field
+func newCSVRecordReader(r io.Reader) (*csvRecordReader, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("Missing CSV header")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Invalid CSV header. Error: %v", err)
+	}
+	columns := make([]string, len(header))
+	hasUsername := false
+	for i, h := range header {
+		columns[i] = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+		hasUsername = hasUsername || columns[i] == "username"
+	}
+	if !hasUsername {
+		return nil, fmt.Errorf("CSV header has no 'username' column")
+	}
+	return &csvRecordReader{r: cr, columns: columns}, nil
+}
+
+func (r *csvRecordReader) Read() (UserRecord, int, error) {
+	var rec UserRecord
+	fields, err := r.r.Read()
+	if err != nil {
+		if pe, ok := err.(*csv.ParseError); ok {
+			return rec, pe.StartLine, &recordError{err: pe.Err}
+		}
+		return rec, 0, err
+	}
+	line, _ := r.r.FieldPos(0)
+	if len(fields) != len(r.columns) {
+		return rec, line, &recordError{err: fmt.Errorf("Expected %d fields, got %d", len(r.columns), len(fields))}
+	}
+	for i, f := range fields {
+		// passwords may intentionally start or end with spaces
+		if r.columns[i] != "password" {
+			f = strings.TrimSpace(f)
+		}
+		if err := rec.setCSVValue(r.columns[i], f); err != nil {
+			return rec, line, &recordError{err: err}
+		}
+	}
+	return rec, line, nil
+}
+
+// maxJSONLRecordSize is the maximum size of a single line of a JSON Lines import
+const maxJSONLRecordSize = 64 * 1024
+
+type jsonlRecordReader struct {
+	s    *bufio.Scanner
+	line int
+}
+
+func newJSONLRecordReader(r io.Reader) *jsonlRecordReader {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 4096), maxJSONLRecordSize)
+	return &jsonlRecordReader{s: s}
+}
+
+func (r *jsonlRecordReader) Read() (UserRecord, int, error) {
+	var rec UserRecord
+	for r.s.Scan() {
+		r.line++
+		text := strings.TrimSpace(r.s.Text())
+		if text == "" {
+			continue
+		}
+		if err := json.Unmarshal([]byte(text), &rec); err != nil {
+			return rec, r.line, &recordError{err: fmt.Errorf("Invalid JSON. Error: %v", err)}
+		}
+		return rec, r.line, nil
+	}
+	if err := r.s.Err(); err != nil {
+		return rec, r.line + 1, err
+	}
+	return rec, r.line, io.EOF
+}
+
+// userRecordWriter writes records one by one
+type userRecordWriter interface {
+	Write(rec UserRecord) error
+	// Flush writes buffered records to the underlying writer
+	Flush() error
+}
+
+func newUserRecordWriter(w io.Writer, format string, withHashes bool) (userRecordWriter, error) {
+	switch format {
+	case FormatCSV:
+		columns := userRecordColumns
+		if !withHashes {
+			columns = columns[:len(columns)-1]
+		}
+		cw := &csvRecordWriter{w: csv.NewWriter(w), columns: columns}
+		return cw, cw.w.Write(columns)
+	case FormatJSONL:
+		bw := bufio.NewWriter(w)
+		return &jsonlRecordWriter{w: bw, enc: json.NewEncoder(bw)}, nil
+	}
+	return nil, fmt.Errorf("Unknown format '%s'", format)
+}
+
+type csvRecordWriter struct {
+	w       *csv.Writer
+	columns []string
+}
+
+func (w *csvRecordWriter) Write(rec UserRecord) error {
+	fields := make([]string, len(w.columns))
+	for i, c := range w.columns {
+		fields[i] = rec.csvValue(c)
+	}
+	return w.w.Write(fields)
+}
+
+func (w *csvRecordWriter) Flush() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+type jsonlRecordWriter struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func (w *jsonlRecordWriter) Write(rec UserRecord) error {
+	return w.enc.Encode(rec)
+}
+
+func (w *jsonlRecordWriter) Flush() error {
+	return w.w.Flush()
+}
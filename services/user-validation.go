@@ -0,0 +1,61 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Kirides/simpleApi/models"
+)
+
+// Patterns user input is validated against
+const (
+	UsernamePattern = "^[A-Za-z0-9]+(?:[_-][A-Za-z0-9]+)*$"
+	EmailPattern    = `^(?:(?:[^<>()[\]\\.,;:\s@"]+(?:\.[^<>()[\]\\.,;:\s@"]+)*)|(?:".+"))@(?:(?:\[[0-9]{1,3}\.[0-9]{1,3}\.[0-9]{1,3}\.[0-9]{1,3}])|(?:(?:[a-zA-Z\-0-9]+\.)+[a-zA-Z]{2,}))$`
+	LocalePattern   = `^[A-Za-z]{2,3}(?:-[A-Za-z0-9]{2,8})*$`
+)
+
+// MaxDisplayNameLength is the maximum amount of characters of a display name
+const MaxDisplayNameLength = 100
+
+var (
+	rxUsername = regexp.MustCompile(UsernamePattern)
+	rxEmail    = regexp.MustCompile(EmailPattern)
+	rxLocale   = regexp.MustCompile(LocalePattern)
+)
+
+// ValidUsername reports whether name is allowed as a username
+func ValidUsername(name string) bool {
+	return rxUsername.MatchString(name)
+}
+
+// ValidRole reports whether role is one of the roles users can have
+func ValidRole(role string) bool {
+	return role == models.RoleUser || role == models.RoleOrgAdmin || role == models.RoleAdmin
+}
+
+// ValidEmail reports whether email is a valid email address
+func ValidEmail(email string) bool {
+	return rxEmail.MatchString(email)
+}
+
+// ValidateProfile validates the fields users are allowed to change on their own.
+// Empty values are valid.
+func ValidateProfile(displayName, email, locale string) error {
+	if utf8.RuneCountInString(displayName) > MaxDisplayNameLength {
+		return fmt.Errorf("Display name must not be longer than %d characters", MaxDisplayNameLength)
+	}
+	for _, r := range displayName {
+		if unicode.IsControl(r) {
+			return fmt.Errorf("Invalid display name")
+		}
+	}
+	if email != "" && !ValidEmail(email) {
+		return fmt.Errorf("Invalid email")
+	}
+	if locale != "" && !rxLocale.MatchString(locale) {
+		return fmt.Errorf("Invalid locale")
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package stores
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+
+	"github.com/Kirides/simpleApi/models"
+	bolt "github.com/coreos/bbolt"
+)
+
+// BoltDBAuditStore stores audit events as JSON values keyed by their sequence
+type BoltDBAuditStore struct {
+	db *bolt.DB
+}
+
+// NewBoltDBAuditStore Creates a new BoltDB-Based AuditStore
+func NewBoltDBAuditStore(db *bolt.DB) (*BoltDBAuditStore, error) {
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltkeyAuditBucket)
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("Could not create audit bucket. Error: %w", err)
+	}
+	return &BoltDBAuditStore{db: db}, nil
+}
+
+// boltAuditKey encodes the id big-endian, unlike the other buckets,
+// so the cursor visits the events in the order they were appended
+func boltAuditKey(id uint64) []byte {
+	key := make([]byte, sizeOfUInt64)
+	binary.BigEndian.PutUint64(key, id)
+	return key
+}
+
+// AppendAudit ...
+func (s *BoltDBAuditStore) AppendAudit(ctx context.Context, e models.AuditEvent) (models.AuditEvent, error) {
+	err := boltUpdateContext(ctx, s.db, func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltkeyAuditBucket)
+		id, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		e.ID = int64(id)
+		return putBoltJSON(bucket, boltAuditKey(id), e)
+	})
+	return e, err
+}
+
+// FindAudit ...
+func (s *BoltDBAuditStore) FindAudit(ctx context.Context, q AuditQuery) ([]models.AuditEvent, error) {
+	events := []models.AuditEvent{}
+	err := boltViewContext(ctx, s.db, func(tx *bolt.Tx) error {
+		cur := tx.Bucket(boltkeyAuditBucket).Cursor()
+		k, v := cur.Last()
+		if q.BeforeID > 0 {
+			// seeking finds the first event that is not before BeforeID, Matches skips it
+			if k, v = cur.Seek(boltAuditKey(uint64(q.BeforeID))); k == nil {
+				k, v = cur.Last()
+			}
+		}
+		for ; k != nil; k, v = cur.Prev() {
+			if q.Limit > 0 && int64(len(events)) >= q.Limit {
+				break
+			}
+			var e models.AuditEvent
+			if err := json.Unmarshal(v, &e); err != nil {
+				return err
+			}
+			if q.Matches(e) {
+				events = append(events, e)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Could not retrieve audit events. Error: %w", err)
+	}
+	return events, nil
+}
+
+// LastAudit ...
+func (s *BoltDBAuditStore) LastAudit(ctx context.Context) (models.AuditEvent, error) {
+	var e models.AuditEvent
+	err := boltViewContext(ctx, s.db, func(tx *bolt.Tx) error {
+		_, v := tx.Bucket(boltkeyAuditBucket).Cursor().Last()
+		if v == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(v, &e)
+	})
+	return e, err
+}
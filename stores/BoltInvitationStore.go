@@ -0,0 +1,171 @@
+package stores
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Kirides/simpleApi/models"
+	bolt "github.com/coreos/bbolt"
+)
+
+// BoltDBInvitationStore stores invitations as JSON values keyed by their sequence
+type BoltDBInvitationStore struct {
+	db *bolt.DB
+}
+
+// NewBoltDBInvitationStore Creates a new BoltDB-Based InvitationStore
+func NewBoltDBInvitationStore(db *bolt.DB) (*BoltDBInvitationStore, error) {
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltkeyInvitationsBucket)
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("Could not create invitations bucket. Error: %w", err)
+	}
+	return &BoltDBInvitationStore{db: db}, nil
+}
+
+// FindInvitations ...
+func (s *BoltDBInvitationStore) FindInvitations(ctx context.Context, orgID string) ([]models.Invitation, error) {
+	invitations := []models.Invitation{}
+	err := boltViewContext(ctx, s.db, func(tx *bolt.Tx) error {
+		return tx.Bucket(boltkeyInvitationsBucket).ForEach(func(k, v []byte) error {
+			var inv models.Invitation
+			if err := json.Unmarshal(v, &inv); err != nil {
+				return err
+			}
+			if orgID == "" || inv.OrgID == orgID {
+				invitations = append(invitations, inv)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Could not retrieve Invitations. Error: %w", err)
+	}
+	// keys are little endian, so the order of the bucket is not the order of the ids
+	sort.Slice(invitations, func(i, j int) bool {
+		a, _ := strconv.ParseUint(invitations[i].ID, 10, 64)
+		b, _ := strconv.ParseUint(invitations[j].ID, 10, 64)
+		return a > b
+	})
+	return invitations, nil
+}
+
+func getBoltInvitation(tx *bolt.Tx, id string) (models.Invitation, []byte, error) {
+	var inv models.Invitation
+	n, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return inv, nil, ErrNotFound
+	}
+	key := getUInt64Bytes(n)
+	v := tx.Bucket(boltkeyInvitationsBucket).Get(key)
+	if v == nil {
+		return inv, nil, ErrNotFound
+	}
+	err = json.Unmarshal(v, &inv)
+	return inv, key, err
+}
+
+// GetInvitation ...
+func (s *BoltDBInvitationStore) GetInvitation(ctx context.Context, id string) (models.Invitation, error) {
+	var inv models.Invitation
+	err := boltViewContext(ctx, s.db, func(tx *bolt.Tx) error {
+		var err error
+		inv, _, err = getBoltInvitation(tx, id)
+		return err
+	})
+	return inv, err
+}
+
+// InsertInvitation ...
+func (s *BoltDBInvitationStore) InsertInvitation(ctx context.Context, inv models.Invitation) (models.Invitation, error) {
+	if inv.CreatedAt.IsZero() {
+		inv.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	}
+	err := boltUpdateContext(ctx, s.db, func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltkeyInvitationsBucket)
+		id, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		inv.ID = strconv.FormatUint(id, 10)
+		return putBoltJSON(bucket, getUInt64Bytes(id), inv)
+	})
+	if err != nil {
+		return models.Invitation{}, err
+	}
+	return inv, nil
+}
+
+// closeInvitation applies close onto a pending invitation
+func (s *BoltDBInvitationStore) closeInvitation(ctx context.Context, id string, close func(inv *models.Invitation)) error {
+	return boltUpdateContext(ctx, s.db, func(tx *bolt.Tx) error {
+		inv, key, err := getBoltInvitation(tx, id)
+		if err != nil {
+			return err
+		}
+		if !inv.AcceptedAt.IsZero() || !inv.RevokedAt.IsZero() {
+			return ErrConflict
+		}
+		close(&inv)
+		return putBoltJSON(tx.Bucket(boltkeyInvitationsBucket), key, inv)
+	})
+}
+
+// AcceptInvitation ...
+func (s *BoltDBInvitationStore) AcceptInvitation(ctx context.Context, id, userID string, at time.Time) error {
+	return s.closeInvitation(ctx, id, func(inv *models.Invitation) {
+		inv.AcceptedAt = at.UTC().Truncate(time.Second)
+		inv.UserID = userID
+	})
+}
+
+// RevokeInvitation ...
+func (s *BoltDBInvitationStore) RevokeInvitation(ctx context.Context, id string, at time.Time) error {
+	return s.closeInvitation(ctx, id, func(inv *models.Invitation) {
+		inv.RevokedAt = at.UTC().Truncate(time.Second)
+	})
+}
+
+// RemoveUserReferences ...
+func (s *BoltDBInvitationStore) RemoveUserReferences(ctx context.Context, userID string) error {
+	return boltUpdateContext(ctx, s.db, func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltkeyInvitationsBucket)
+		var (
+			remove  [][]byte
+			changed = map[string]models.Invitation{}
+		)
+		err := bucket.ForEach(func(k, v []byte) error {
+			var inv models.Invitation
+			if err := json.Unmarshal(v, &inv); err != nil {
+				return err
+			}
+			if inv.UserID == userID {
+				remove = append(remove, k)
+			} else if inv.InvitedBy == userID {
+				inv.InvitedBy = ""
+				changed[string(k)] = inv
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		// the bucket must not be modified while iterating over it
+		for _, k := range remove {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		for k, inv := range changed {
+			if err := putBoltJSON(bucket, []byte(k), inv); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
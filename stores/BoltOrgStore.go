@@ -0,0 +1,379 @@
+package stores
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Kirides/simpleApi/models"
+	bolt "github.com/coreos/bbolt"
+)
+
+// BoltDBOrgStore stores organizations and groups as JSON values.
+// Group members are kept in one bucket per group, keyed by user id
+type BoltDBOrgStore struct {
+	db *bolt.DB
+}
+
+// NewBoltDBOrgStore Creates a new BoltDB-Based OrgStore
+func NewBoltDBOrgStore(db *bolt.DB) (*BoltDBOrgStore, error) {
+	store := &BoltDBOrgStore{db: db}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		orgs, err := tx.CreateBucketIfNotExists(boltkeyOrgsBucket)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(boltkeyGroupsBucket); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(boltkeyGroupMembersBucket); err != nil {
+			return err
+		}
+		if orgs.Get([]byte(models.DefaultOrgID)) != nil {
+			return nil
+		}
+		return putBoltJSON(orgs, []byte(models.DefaultOrgID), models.Organization{
+			ID:        models.DefaultOrgID,
+			Name:      "Default",
+			CreatedAt: time.Now().UTC().Truncate(time.Second),
+		})
+	}); err != nil {
+		return nil, fmt.Errorf("Could not create organization buckets. Error: %w", err)
+	}
+	return store, nil
+}
+
+func putBoltJSON(bucket *bolt.Bucket, key []byte, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(key, data)
+}
+
+// boltGroupKey converts a group id to its bucket key, invalid ids are reported as not found
+func boltGroupKey(id string) ([]byte, error) {
+	n, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	return getUInt64Bytes(n), nil
+}
+
+// ListOrgs ...
+func (s *BoltDBOrgStore) ListOrgs(ctx context.Context) ([]models.Organization, error) {
+	orgs := []models.Organization{}
+	err := boltViewContext(ctx, s.db, func(tx *bolt.Tx) error {
+		return tx.Bucket(boltkeyOrgsBucket).ForEach(func(k, v []byte) error {
+			var o models.Organization
+			if err := json.Unmarshal(v, &o); err != nil {
+				return err
+			}
+			orgs = append(orgs, o)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Could not retrieve Organizations. Error: %w", err)
+	}
+	return orgs, nil
+}
+
+func getBoltOrg(tx *bolt.Tx, id string) (models.Organization, error) {
+	var o models.Organization
+	v := tx.Bucket(boltkeyOrgsBucket).Get([]byte(id))
+	if v == nil {
+		return o, ErrNotFound
+	}
+	err := json.Unmarshal(v, &o)
+	return o, err
+}
+
+// GetOrg ...
+func (s *BoltDBOrgStore) GetOrg(ctx context.Context, id string) (models.Organization, error) {
+	var o models.Organization
+	err := boltViewContext(ctx, s.db, func(tx *bolt.Tx) error {
+		var err error
+		o, err = getBoltOrg(tx, id)
+		return err
+	})
+	return o, err
+}
+
+// InsertOrg ...
+func (s *BoltDBOrgStore) InsertOrg(ctx context.Context, o models.Organization) (models.Organization, error) {
+	if o.CreatedAt.IsZero() {
+		o.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	}
+	err := boltUpdateContext(ctx, s.db, func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltkeyOrgsBucket)
+		if bucket.Get([]byte(o.ID)) != nil {
+			return ErrConflict
+		}
+		return putBoltJSON(bucket, []byte(o.ID), o)
+	})
+	if err != nil {
+		return models.Organization{}, err
+	}
+	return o, nil
+}
+
+// UpdateOrg ...
+func (s *BoltDBOrgStore) UpdateOrg(ctx context.Context, o models.Organization) error {
+	return boltUpdateContext(ctx, s.db, func(tx *bolt.Tx) error {
+		existing, err := getBoltOrg(tx, o.ID)
+		if err != nil {
+			return err
+		}
+		existing.Name = o.Name
+		return putBoltJSON(tx.Bucket(boltkeyOrgsBucket), []byte(o.ID), existing)
+	})
+}
+
+// DeleteOrg removes the organization along with its groups
+func (s *BoltDBOrgStore) DeleteOrg(ctx context.Context, id string) error {
+	return boltUpdateContext(ctx, s.db, func(tx *bolt.Tx) error {
+		if _, err := getBoltOrg(tx, id); err != nil {
+			return err
+		}
+		groups, err := boltGroups(tx, func(g models.Group) bool { return g.OrgID == id })
+		if err != nil {
+			return err
+		}
+		for _, g := range groups {
+			if err := deleteBoltGroup(tx, g.ID); err != nil {
+				return err
+			}
+		}
+		return tx.Bucket(boltkeyOrgsBucket).Delete([]byte(id))
+	})
+}
+
+// boltGroups returns all groups accepted by the filter, sorted by name
+func boltGroups(tx *bolt.Tx, filter func(models.Group) bool) ([]models.Group, error) {
+	groups := []models.Group{}
+	err := tx.Bucket(boltkeyGroupsBucket).ForEach(func(k, v []byte) error {
+		var g models.Group
+		if err := json.Unmarshal(v, &g); err != nil {
+			return err
+		}
+		if filter(g) {
+			groups = append(groups, g)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Could not retrieve Groups. Error: %w", err)
+	}
+	sortGroups(groups)
+	return groups, nil
+}
+
+func getBoltGroup(tx *bolt.Tx, orgID, id string) (models.Group, error) {
+	var g models.Group
+	key, err := boltGroupKey(id)
+	if err != nil {
+		return g, err
+	}
+	v := tx.Bucket(boltkeyGroupsBucket).Get(key)
+	if v == nil {
+		return g, ErrNotFound
+	}
+	if err := json.Unmarshal(v, &g); err != nil {
+		return g, err
+	}
+	if g.OrgID != orgID {
+		return models.Group{}, ErrNotFound
+	}
+	return g, nil
+}
+
+func deleteBoltGroup(tx *bolt.Tx, id string) error {
+	key, err := boltGroupKey(id)
+	if err != nil {
+		return err
+	}
+	members := tx.Bucket(boltkeyGroupMembersBucket)
+	if members.Bucket(key) != nil {
+		if err := members.DeleteBucket(key); err != nil {
+			return err
+		}
+	}
+	return tx.Bucket(boltkeyGroupsBucket).Delete(key)
+}
+
+// boltGroupNameTaken reports whether another group of the organization is named like g
+func boltGroupNameTaken(tx *bolt.Tx, g models.Group) (bool, error) {
+	groups, err := boltGroups(tx, func(other models.Group) bool {
+		return other.OrgID == g.OrgID && other.ID != g.ID && strings.EqualFold(other.Name, g.Name)
+	})
+	return len(groups) > 0, err
+}
+
+// ListGroups ...
+func (s *BoltDBOrgStore) ListGroups(ctx context.Context, orgID string) ([]models.Group, error) {
+	var groups []models.Group
+	err := boltViewContext(ctx, s.db, func(tx *bolt.Tx) error {
+		var err error
+		groups, err = boltGroups(tx, func(g models.Group) bool { return g.OrgID == orgID })
+		return err
+	})
+	return groups, err
+}
+
+// GetGroup ...
+func (s *BoltDBOrgStore) GetGroup(ctx context.Context, orgID, id string) (models.Group, error) {
+	var g models.Group
+	err := boltViewContext(ctx, s.db, func(tx *bolt.Tx) error {
+		var err error
+		g, err = getBoltGroup(tx, orgID, id)
+		return err
+	})
+	return g, err
+}
+
+// InsertGroup ...
+func (s *BoltDBOrgStore) InsertGroup(ctx context.Context, g models.Group) (models.Group, error) {
+	g.ID = ""
+	if g.CreatedAt.IsZero() {
+		g.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	}
+	err := boltUpdateContext(ctx, s.db, func(tx *bolt.Tx) error {
+		if taken, err := boltGroupNameTaken(tx, g); err != nil || taken {
+			if taken {
+				return ErrConflict
+			}
+			return err
+		}
+		bucket := tx.Bucket(boltkeyGroupsBucket)
+		id, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		g.ID = strconv.FormatUint(id, 10)
+		return putBoltJSON(bucket, getUInt64Bytes(id), g)
+	})
+	if err != nil {
+		return models.Group{}, err
+	}
+	return g, nil
+}
+
+// UpdateGroup ...
+func (s *BoltDBOrgStore) UpdateGroup(ctx context.Context, g models.Group) error {
+	return boltUpdateContext(ctx, s.db, func(tx *bolt.Tx) error {
+		existing, err := getBoltGroup(tx, g.OrgID, g.ID)
+		if err != nil {
+			return err
+		}
+		if taken, err := boltGroupNameTaken(tx, g); err != nil || taken {
+			if taken {
+				return ErrConflict
+			}
+			return err
+		}
+		existing.Name = g.Name
+		existing.Description = g.Description
+		key, _ := boltGroupKey(g.ID)
+		return putBoltJSON(tx.Bucket(boltkeyGroupsBucket), key, existing)
+	})
+}
+
+// DeleteGroup ...
+func (s *BoltDBOrgStore) DeleteGroup(ctx context.Context, orgID, id string) error {
+	return boltUpdateContext(ctx, s.db, func(tx *bolt.Tx) error {
+		if _, err := getBoltGroup(tx, orgID, id); err != nil {
+			return err
+		}
+		return deleteBoltGroup(tx, id)
+	})
+}
+
+// GroupMembers ...
+func (s *BoltDBOrgStore) GroupMembers(ctx context.Context, orgID, groupID string) ([]string, error) {
+	ids := []string{}
+	err := boltViewContext(ctx, s.db, func(tx *bolt.Tx) error {
+		if _, err := getBoltGroup(tx, orgID, groupID); err != nil {
+			return err
+		}
+		key, _ := boltGroupKey(groupID)
+		members := tx.Bucket(boltkeyGroupMembersBucket).Bucket(key)
+		if members == nil {
+			return nil
+		}
+		return members.ForEach(func(k, v []byte) error {
+			ids = append(ids, string(k))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortIDs(ids)
+	return ids, nil
+}
+
+// AddGroupMember adds the user to the group, adding an existing member does nothing
+func (s *BoltDBOrgStore) AddGroupMember(ctx context.Context, orgID, groupID, userID string) error {
+	return boltUpdateContext(ctx, s.db, func(tx *bolt.Tx) error {
+		if _, err := getBoltGroup(tx, orgID, groupID); err != nil {
+			return err
+		}
+		key, _ := boltGroupKey(groupID)
+		members, err := tx.Bucket(boltkeyGroupMembersBucket).CreateBucketIfNotExists(key)
+		if err != nil {
+			return err
+		}
+		return members.Put([]byte(userID), []byte{})
+	})
+}
+
+// RemoveGroupMember ...
+func (s *BoltDBOrgStore) RemoveGroupMember(ctx context.Context, orgID, groupID, userID string) error {
+	return boltUpdateContext(ctx, s.db, func(tx *bolt.Tx) error {
+		if _, err := getBoltGroup(tx, orgID, groupID); err != nil {
+			return err
+		}
+		key, _ := boltGroupKey(groupID)
+		members := tx.Bucket(boltkeyGroupMembersBucket).Bucket(key)
+		if members == nil || members.Get([]byte(userID)) == nil {
+			return ErrNotFound
+		}
+		return members.Delete([]byte(userID))
+	})
+}
+
+// UserGroups ...
+func (s *BoltDBOrgStore) UserGroups(ctx context.Context, userID string) ([]models.Group, error) {
+	var groups []models.Group
+	err := boltViewContext(ctx, s.db, func(tx *bolt.Tx) error {
+		members := tx.Bucket(boltkeyGroupMembersBucket)
+		var err error
+		groups, err = boltGroups(tx, func(g models.Group) bool {
+			key, err := boltGroupKey(g.ID)
+			if err != nil {
+				return false
+			}
+			m := members.Bucket(key)
+			return m != nil && m.Get([]byte(userID)) != nil
+		})
+		return err
+	})
+	return groups, err
+}
+
+// RemoveUserMemberships ...
+func (s *BoltDBOrgStore) RemoveUserMemberships(ctx context.Context, userID string) error {
+	return boltUpdateContext(ctx, s.db, func(tx *bolt.Tx) error {
+		members := tx.Bucket(boltkeyGroupMembersBucket)
+		return members.ForEach(func(k, v []byte) error {
+			if m := members.Bucket(k); m != nil {
+				return m.Delete([]byte(userID))
+			}
+			return nil
+		})
+	})
+}
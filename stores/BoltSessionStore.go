@@ -0,0 +1,176 @@
+package stores
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Kirides/simpleApi/models"
+	bolt "github.com/coreos/bbolt"
+)
+
+// BoltDBSessionStore stores sessions as JSON values keyed by their id
+type BoltDBSessionStore struct {
+	db *bolt.DB
+}
+
+// NewBoltDBSessionStore Creates a new BoltDB-Based SessionStore
+func NewBoltDBSessionStore(db *bolt.DB) (*BoltDBSessionStore, error) {
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltkeySessionsBucket)
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("Could not create sessions bucket. Error: %w", err)
+	}
+	return &BoltDBSessionStore{db: db}, nil
+}
+
+// forEachBoltSession calls fn for every session, fn may modify the bucket
+func forEachBoltSession(bucket *bolt.Bucket, fn func(session models.Session) error) error {
+	var sessions []models.Session
+	err := bucket.ForEach(func(k, v []byte) error {
+		var session models.Session
+		if err := json.Unmarshal(v, &session); err != nil {
+			return err
+		}
+		sessions = append(sessions, session)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		if err := fn(session); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateBoltSession applies fn to an existing session and stores the result
+func (s *BoltDBSessionStore) updateBoltSession(ctx context.Context, id string, fn func(session *models.Session) error) error {
+	return boltUpdateContext(ctx, s.db, func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltkeySessionsBucket)
+		v := bucket.Get([]byte(id))
+		if v == nil {
+			return ErrNotFound
+		}
+		var session models.Session
+		if err := json.Unmarshal(v, &session); err != nil {
+			return err
+		}
+		if err := fn(&session); err != nil {
+			return err
+		}
+		return putBoltJSON(bucket, []byte(id), session)
+	})
+}
+
+// InsertSession ...
+func (s *BoltDBSessionStore) InsertSession(ctx context.Context, session models.Session) error {
+	return boltUpdateContext(ctx, s.db, func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltkeySessionsBucket)
+		if bucket.Get([]byte(session.ID)) != nil {
+			return ErrConflict
+		}
+		return putBoltJSON(bucket, []byte(session.ID), session)
+	})
+}
+
+// GetSession ...
+func (s *BoltDBSessionStore) GetSession(ctx context.Context, id string) (models.Session, error) {
+	var session models.Session
+	err := boltViewContext(ctx, s.db, func(tx *bolt.Tx) error {
+		v := tx.Bucket(boltkeySessionsBucket).Get([]byte(id))
+		if v == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(v, &session)
+	})
+	return session, err
+}
+
+// UserSessions ...
+func (s *BoltDBSessionStore) UserSessions(ctx context.Context, userID string, now time.Time) ([]models.Session, error) {
+	sessions := []models.Session{}
+	err := boltViewContext(ctx, s.db, func(tx *bolt.Tx) error {
+		return forEachBoltSession(tx.Bucket(boltkeySessionsBucket), func(session models.Session) error {
+			if session.UserID == userID && session.Active(now) {
+				sessions = append(sessions, session)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Could not retrieve sessions. Error: %w", err)
+	}
+	sortSessions(sessions)
+	return sessions, nil
+}
+
+// TouchSession ...
+func (s *BoltDBSessionStore) TouchSession(ctx context.Context, id string, at time.Time, ip string) error {
+	return s.updateBoltSession(ctx, id, func(session *models.Session) error {
+		session.LastSeenAt = at
+		session.IP = ip
+		return nil
+	})
+}
+
+// RevokeSession ...
+func (s *BoltDBSessionStore) RevokeSession(ctx context.Context, id string, at time.Time) error {
+	return s.updateBoltSession(ctx, id, func(session *models.Session) error {
+		if !session.RevokedAt.IsZero() {
+			return ErrNotFound
+		}
+		session.RevokedAt = at
+		return nil
+	})
+}
+
+// RevokeUserSessions ...
+func (s *BoltDBSessionStore) RevokeUserSessions(ctx context.Context, userID, exceptID string, at time.Time) (int64, error) {
+	var n int64
+	err := boltUpdateContext(ctx, s.db, func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltkeySessionsBucket)
+		return forEachBoltSession(bucket, func(session models.Session) error {
+			if session.UserID != userID || session.ID == exceptID || !session.Active(at) {
+				return nil
+			}
+			session.RevokedAt = at
+			n++
+			return putBoltJSON(bucket, []byte(session.ID), session)
+		})
+	})
+	return n, err
+}
+
+// RemoveUserSessions ...
+func (s *BoltDBSessionStore) RemoveUserSessions(ctx context.Context, userID string) error {
+	return boltUpdateContext(ctx, s.db, func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltkeySessionsBucket)
+		return forEachBoltSession(bucket, func(session models.Session) error {
+			if session.UserID != userID {
+				return nil
+			}
+			return bucket.Delete([]byte(session.ID))
+		})
+	})
+}
+
+// RemoveExpiredSessions ...
+func (s *BoltDBSessionStore) RemoveExpiredSessions(ctx context.Context, before time.Time) (int64, error) {
+	var n int64
+	err := boltUpdateContext(ctx, s.db, func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltkeySessionsBucket)
+		return forEachBoltSession(bucket, func(session models.Session) error {
+			if !session.ExpiresAt.Before(before) {
+				return nil
+			}
+			n++
+			return bucket.Delete([]byte(session.ID))
+		})
+	})
+	return n, err
+}
@@ -2,7 +2,9 @@ package stores
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"time"
 
 	"github.com/Kirides/simpleApi/models"
 
@@ -27,35 +29,70 @@ func NewBoltDBTokenStore(db *bolt.DB) (*BoltDBTokenStore, error) {
 }
 
 // Get ...
-func (s BoltDBTokenStore) Get(id string) (models.TokenStruct, error) {
+func (s BoltDBTokenStore) Get(ctx context.Context, id string) (models.TokenStruct, error) {
 	var tokenStruct models.TokenStruct
-	if err := s.db.View(func(tx *bolt.Tx) error {
+	if err := boltViewContext(ctx, s.db, func(tx *bolt.Tx) error {
 		cur := tx.Bucket(boltkeyTokenBucket).Cursor()
 		idBytes := []byte(id)
 		k, v := cur.Seek(idBytes)
 		if k == nil || !bytes.Equal(k, idBytes) {
-			return fmt.Errorf("Token '%s' not found", id)
+			return ErrNotFound
 		}
 		unixDate := int64(boltByteOrder.Uint64(v))
+		if unixDate <= time.Now().Unix() {
+			return ErrNotFound
+		}
 		tokenStruct.Token = id
 		tokenStruct.Date = unixDate
 		return nil
 	}); err != nil {
-		return tokenStruct, fmt.Errorf("Could not find token '%s'. Error: %v", id, err)
+		return tokenStruct, fmt.Errorf("Could not find token '%s'. Error: %w", id, err)
 	}
 	return tokenStruct, nil
 }
 
 // Remove ...
-func (s BoltDBTokenStore) Remove(id string) error {
-	return nil
+func (s BoltDBTokenStore) Remove(ctx context.Context, id string) error {
+	return boltUpdateContext(ctx, s.db, func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltkeyTokenBucket)
+		if bucket.Get([]byte(id)) == nil {
+			return ErrNotFound
+		}
+		return bucket.Delete([]byte(id))
+	})
+}
+
+// RemoveExpired ...
+func (s BoltDBTokenStore) RemoveExpired(ctx context.Context, before time.Time) (int64, error) {
+	var n int64
+	err := boltUpdateContext(ctx, s.db, func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltkeyTokenBucket)
+		var expired [][]byte
+		err := bucket.ForEach(func(k, v []byte) error {
+			if int64(boltByteOrder.Uint64(v)) <= before.Unix() {
+				expired = append(expired, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range expired {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		n = int64(len(expired))
+		return nil
+	})
+	return n, err
 }
 
 // Set ...
-func (s BoltDBTokenStore) Set(id string, date uint64) error {
-	err := s.db.Update(func(tx *bolt.Tx) error {
-		if err := tx.Bucket(boltkeyTokenBucket).Put([]byte(id), getUInt64Bytes(date)); err != nil {
-			return fmt.Errorf("Could not add Token to bucket. Error: %v", err)
+func (s BoltDBTokenStore) Set(ctx context.Context, id string, date int64) error {
+	err := boltUpdateContext(ctx, s.db, func(tx *bolt.Tx) error {
+		if err := tx.Bucket(boltkeyTokenBucket).Put([]byte(id), getUInt64Bytes(uint64(date))); err != nil {
+			return fmt.Errorf("Could not add Token to bucket. Error: %w", err)
 		}
 		return nil
 	})
@@ -2,10 +2,11 @@ package stores
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"log"
 	"strconv"
-
-	"golang.org/x/crypto/bcrypt"
+	"time"
 
 	"github.com/Kirides/simpleApi/models"
 	bolt "github.com/coreos/bbolt"
@@ -20,155 +21,513 @@ var (
 	keyID   = getUInt64Bytes(1) //[]byte("id")
 	keyHash = getUInt64Bytes(2) //[]byte("hash")
 	keyName = getUInt64Bytes(3) //[]byte("name")
+	keyRole = getUInt64Bytes(4) //[]byte("role")
+
+	keyDisplayName = getUInt64Bytes(5)
+	keyEmail       = getUInt64Bytes(6)
+	keyLocale      = getUInt64Bytes(7)
+	keyCreatedAt   = getUInt64Bytes(8)
+	keyUpdatedAt   = getUInt64Bytes(9)
+	keyVersion     = getUInt64Bytes(10)
+	keyStatus      = getUInt64Bytes(11)
+	keyDeletedAt   = getUInt64Bytes(12)
+	keyOrgID       = getUInt64Bytes(13)
+	keyAvatar      = getUInt64Bytes(14)
+
+	keyTokenGeneration = getUInt64Bytes(15)
 )
 
-// NewBoltDBUserStore Creates a new BoltDB-Based UserStore
+// NewBoltDBUserStore Creates a new BoltDB-Based UserStore.
+// Databases created by older versions get the indexes of the normalized usernames and of the ids on the first start.
 func NewBoltDBUserStore(db *bolt.DB) (*BoltDBUserStore, error) {
 	store := &BoltDBUserStore{db: db}
 	return store, store.initialize()
 }
 
 func (s *BoltDBUserStore) initialize() error {
-	return s.db.Update(func(tx *bolt.Tx) error {
-		bucket, err := tx.CreateBucket(boltkeyUsersBucket)
+	return boltUpdate(s.db, func(tx *bolt.Tx) error {
+		users, err := tx.CreateBucketIfNotExists(boltkeyUsersBucket)
 		if err != nil {
-			return fmt.Errorf("Could not create bucket 'user'. Error: %v", err)
+			return fmt.Errorf("Could not create bucket 'user'. Error: %w", err)
 		}
-		for i := 0; i < 1; i++ {
-			id, _ := bucket.NextSequence()
-			curUserBucket, _ := bucket.CreateBucketIfNotExists(getUInt64Bytes(id))
+		if err := indexBoltUserNames(tx, users); err != nil {
+			return err
+		}
+		return indexBoltUserIDs(tx, users)
+	})
+}
 
-			if curUserBucket == nil {
-				return fmt.Errorf("Could not create bucket for user '%d'", id)
-			}
-			hash, err := bcrypt.GenerateFromPassword([]byte("1234567890"), bcrypt.DefaultCost)
-			if err != nil {
-				return err
-			}
-			if err := curUserBucket.Put(keyID, getUInt64Bytes(id)); err != nil {
-				return err
-			}
-			if err := curUserBucket.Put(keyName, []byte("abc"+strconv.Itoa(i))); err != nil {
-				return err
-			}
-			if err := curUserBucket.Put(keyHash, hash); err != nil {
+// indexBoltUserNames creates the index of the normalized usernames if it does not exist
+func indexBoltUserNames(tx *bolt.Tx, users *bolt.Bucket) error {
+	if tx.Bucket(boltkeyUserNamesBucket) != nil {
+		return nil
+	}
+	if tx.Bucket(boltkeyLegacyUserNamesBucket) != nil {
+		if err := tx.DeleteBucket(boltkeyLegacyUserNamesBucket); err != nil {
+			return fmt.Errorf("Could not delete bucket 'usernames'. Error: %w", err)
+		}
+	}
+	names, err := tx.CreateBucket(boltkeyUserNamesBucket)
+	if err != nil {
+		return fmt.Errorf("Could not create bucket 'usernames'. Error: %w", err)
+	}
+	return users.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return nil
+		}
+		name := users.Bucket(k).Get(keyName)
+		if existing := names.Get(boltNameKey(name)); existing != nil {
+			log.Printf("Username '%s' of user '%s' is already used by user '%s', it can not sign in",
+				name, getStringFromUInt64Bytes(k), getStringFromUInt64Bytes(existing))
+			return nil
+		}
+		return names.Put(boltNameKey(name), k)
+	})
+}
+
+// indexBoltUserIDs creates the index of the ids if it does not exist
+func indexBoltUserIDs(tx *bolt.Tx, users *bolt.Bucket) error {
+	if tx.Bucket(boltkeyUserIDsBucket) != nil {
+		return nil
+	}
+	ids, err := tx.CreateBucket(boltkeyUserIDsBucket)
+	if err != nil {
+		return fmt.Errorf("Could not create bucket 'userids'. Error: %w", err)
+	}
+	return users.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return nil
+		}
+		return ids.Put(boltIDKey(k), k)
+	})
+}
+
+// boltIDKey returns the key of a user key in the index of the ids
+func boltIDKey(key []byte) []byte {
+	return getSortableUInt64Bytes(boltByteOrder.Uint64(key))
+}
+
+// SeedIfEmpty inserts the users if the store does not contain any user yet, e.g. to create an initial admin.
+// It reports whether the users were inserted.
+func (s *BoltDBUserStore) SeedIfEmpty(users ...models.User) (bool, error) {
+	seeded := false
+	err := boltUpdate(s.db, func(tx *bolt.Tx) error {
+		if k, _ := tx.Bucket(boltkeyUsersBucket).Cursor().First(); k != nil {
+			return nil
+		}
+		for _, u := range users {
+			if _, err := insertBoltUser(tx, u); err != nil {
 				return err
 			}
 		}
+		seeded = true
 		return nil
 	})
+	return seeded, err
 }
 
 // GetPage ...
-func (s *BoltDBUserStore) GetPage(offset, limit uint64) ([]models.User, error) {
-	if limit <= 0 {
-		return nil, fmt.Errorf("Limit cannot be less-or-equal to 0")
+func (s *BoltDBUserStore) GetPage(ctx context.Context, offset int64, limit int64) ([]models.User, error) {
+	return s.Find(ctx, UserQuery{Offset: offset, Limit: limit})
+}
+
+// Find seeks to the position of the query in the index of the ids or of the usernames
+// and only reads users until the page is full. Other sort fields are not indexed,
+// users sorted by them are read completely and sorted in memory.
+func (s *BoltDBUserStore) Find(ctx context.Context, q UserQuery) ([]models.User, error) {
+	if q.SortBy != "" && q.SortBy != UserSortID && q.SortBy != UserSortName {
+		users, err := s.all(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return q.Apply(users), nil
 	}
 	var users []models.User
-	err := s.db.View(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket(boltkeyUsersBucket)
-		cur := bucket.Cursor()
+	err := boltViewContext(ctx, s.db, func(tx *bolt.Tx) error {
+		var err error
+		users, err = findBoltUsers(ctx, tx, q)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Could not query users. Error: %w", err)
+	}
+	return users, nil
+}
 
-		firstK, firstV := cur.First()
+// findBoltUsers reads the page of the query, which has to be sorted by id or username
+func findBoltUsers(ctx context.Context, tx *bolt.Tx, q UserQuery) ([]models.User, error) {
+	usersBucket := tx.Bucket(boltkeyUsersBucket)
+	// the values of both indexes are the keys of the users
+	index, byName := tx.Bucket(boltkeyUserIDsBucket), q.SortBy == UserSortName
+	if byName {
+		index = tx.Bucket(boltkeyUserNamesBucket)
+	}
+	cursor := q.After
+	if q.Before != nil {
+		cursor = q.Before
+	}
+	// pages in front of a cursor are read backwards and reversed afterwards
+	forward := q.SortDesc == (q.Before != nil)
+	c := index.Cursor()
+	next := c.Next
+	if !forward {
+		next = c.Prev
+	}
+	var k, v []byte
+	switch {
+	case cursor != nil:
+		k, v = seekBoltUser(c, byName, cursor, forward)
+	case forward:
+		k, v = c.First()
+	default:
+		k, v = c.Last()
+	}
+	offset := q.Offset
+	if cursor != nil {
+		offset = 0
+	}
+	users := []models.User{}
+	for ; k != nil && (q.Limit < 0 || int64(len(users)) < q.Limit); k, v = next() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		usrBucket := usersBucket.Bucket(v)
+		if usrBucket == nil {
+			continue
+		}
+		user, err := userFromBucket(usrBucket)
+		if err != nil {
+			return nil, err
+		}
+		if !q.Matches(user) {
+			continue
+		}
 		if offset > 0 {
-			for i := uint64(0); i < offset; i++ {
-				firstK, firstV = cur.Next()
-				if firstK == nil {
-					return nil
-				}
-			}
+			offset--
+			continue
 		}
-		if firstK == nil {
-			return nil
+		users = append(users, user)
+	}
+	if q.Before != nil {
+		for i, j := 0, len(users)-1; i < j; i, j = i+1, j-1 {
+			users[i], users[j] = users[j], users[i]
 		}
-		u := make([]models.User, limit)
-		rowsFetched := uint64(0)
-		for k, _ := firstK, firstV; k != nil && rowsFetched < limit; k, _ = cur.Next() {
-			user, _ := userFromBucket(bucket.Bucket(k))
+	}
+	return users, nil
+}
 
-			u[rowsFetched] = user
-			rowsFetched++
+// seekBoltUser moves c to the first entry behind the cursor in the direction of the iteration.
+// The index of the usernames is ordered by normalized name, the index of the ids by id.
+func seekBoltUser(c *bolt.Cursor, byName bool, cursor *UserCursor, forward bool) (k, v []byte) {
+	key, err := boltUserKey(cursor.ID)
+	if err != nil {
+		return nil, nil
+	}
+	target := boltIDKey(key)
+	if byName {
+		target = boltNameKey([]byte(cursor.Value))
+	}
+	k, v = c.Seek(target)
+	// the entry of the cursor itself is skipped, unless the name now belongs to a user sorted behind it
+	behind := func() bool {
+		cmp := compareIDs(getStringFromUInt64Bytes(v), cursor.ID)
+		return forward && cmp > 0 || !forward && cmp < 0
+	}
+	if forward {
+		if k != nil && bytes.Equal(k, target) && !behind() {
+			return c.Next()
 		}
-		users = u[:rowsFetched]
-		return nil
+		return k, v
+	}
+	if k == nil {
+		return c.Last()
+	}
+	if cmp := bytes.Compare(k, target); cmp > 0 || cmp == 0 && !behind() {
+		return c.Prev()
+	}
+	return k, v
+}
+
+// Count ...
+func (s *BoltDBUserStore) Count(ctx context.Context, q UserQuery) (int64, error) {
+	users, err := s.all(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return q.Count(users), nil
+}
+
+// all reads every user, it stops as soon as ctx is done
+func (s *BoltDBUserStore) all(ctx context.Context) ([]models.User, error) {
+	var users []models.User
+	err := boltViewContext(ctx, s.db, func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltkeyUsersBucket)
+		return bucket.ForEach(func(k, v []byte) error {
+			if v != nil {
+				return nil
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			user, err := userFromBucket(bucket.Bucket(k))
+			if err != nil {
+				return err
+			}
+			users = append(users, user)
+			return nil
+		})
 	})
 	if err != nil {
-		return nil, fmt.Errorf("Could not get page '%d'->'%d'. Error: %v", offset, limit, err)
+		return nil, fmt.Errorf("Could not query users. Error: %w", err)
 	}
 	return users, nil
 }
+
 func userFromBucket(bucket *bolt.Bucket) (models.User, error) {
 	user := models.User{
 		ID:   getStringFromUInt64Bytes(bucket.Get(keyID)),
 		Name: string(bucket.Get(keyName)),
-		Hash: bucket.Get(keyHash),
+		// values of bolt are only valid during the transaction
+		Hash: append([]byte(nil), bucket.Get(keyHash)...),
+		Role: string(bucket.Get(keyRole)),
+
+		DisplayName: string(bucket.Get(keyDisplayName)),
+		Email:       string(bucket.Get(keyEmail)),
+		Locale:      string(bucket.Get(keyLocale)),
+		CreatedAt:   timeFromUnix(getInt64FromBytes(bucket.Get(keyCreatedAt))),
+		UpdatedAt:   timeFromUnix(getInt64FromBytes(bucket.Get(keyUpdatedAt))),
+		Version:     boltUserVersion(bucket),
+		Status:      string(bucket.Get(keyStatus)),
+		DeletedAt:   timeFromUnix(getInt64FromBytes(bucket.Get(keyDeletedAt))),
+		OrgID:       string(bucket.Get(keyOrgID)),
+		Avatar:      string(bucket.Get(keyAvatar)),
+
+		TokenGeneration: getInt64FromBytes(bucket.Get(keyTokenGeneration)),
+	}
+	if user.Role == "" {
+		user.Role = models.RoleUser
+	}
+	if user.Status == "" {
+		user.Status = models.StatusActive
+	}
+	if user.OrgID == "" {
+		user.OrgID = models.DefaultOrgID
 	}
 	return user, nil
 }
 
+// boltUserKey converts a user id to its bucket key, invalid ids are reported as not found
+func boltUserKey(id string) ([]byte, error) {
+	n, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	return getUInt64Bytes(n), nil
+}
+
 // Get ...
-func (s *BoltDBUserStore) Get(id string) (models.User, error) {
-	var user models.User
-	idAsInt, err := strconv.ParseUint(id, 10, sizeOfUInt64)
+func (s *BoltDBUserStore) Get(ctx context.Context, id string) (models.User, error) {
+	key, err := boltUserKey(id)
 	if err != nil {
-		return user, err
+		return models.User{}, err
 	}
+	var user models.User
+	err = boltViewContext(ctx, s.db, func(tx *bolt.Tx) error {
+		usrBucket := tx.Bucket(boltkeyUsersBucket).Bucket(key)
+		if usrBucket == nil {
+			return ErrNotFound
+		}
+		user, err = userFromBucket(usrBucket)
+		return err
+	})
+	return user, err
+}
 
-	if err := s.db.View(func(tx *bolt.Tx) error {
-		usrBucket := tx.Bucket(boltkeyUsersBucket)
-		idAsBytes := getUInt64Bytes(idAsInt)
-		reqUsrBucket := usrBucket.Bucket(idAsBytes)
+// boltNameKey returns the key of a username in the index of the usernames
+func boltNameKey(name []byte) []byte {
+	return []byte(NormalizeUserName(string(name)))
+}
+
+// GetByName looks the user up by the index of the normalized usernames
+func (s *BoltDBUserStore) GetByName(ctx context.Context, name string) (models.User, error) {
+	var user models.User
+	err := boltViewContext(ctx, s.db, func(tx *bolt.Tx) error {
+		key := tx.Bucket(boltkeyUserNamesBucket).Get(boltNameKey([]byte(name)))
+		if key == nil {
+			return ErrNotFound
+		}
+		usrBucket := tx.Bucket(boltkeyUsersBucket).Bucket(key)
+		if usrBucket == nil {
+			return ErrNotFound
+		}
+		var err error
+		user, err = userFromBucket(usrBucket)
+		return err
+	})
+	return user, err
+}
+
+// Update ...
+func (s *BoltDBUserStore) Update(ctx context.Context, u models.User) error {
+	key, err := boltUserKey(u.ID)
+	if err != nil {
+		return err
+	}
+	return boltUpdateContext(ctx, s.db, func(tx *bolt.Tx) error {
+		reqUsrBucket := tx.Bucket(boltkeyUsersBucket).Bucket(key)
 		if reqUsrBucket == nil {
-			return fmt.Errorf("Could not locate user")
+			return ErrNotFound
 		}
-		foundUser, err := userFromBucket(reqUsrBucket)
-		if err != nil {
-			return fmt.Errorf("Could not locate user")
+		if boltUserVersion(reqUsrBucket) != u.Version {
+			return ErrVersionConflict
 		}
-		user = foundUser
-		return nil
-	}); err != nil {
-		return user, fmt.Errorf("Could not find user '%s'. Error: %v", id, err)
+		if err := renameBoltUser(tx, key, reqUsrBucket.Get(keyName), []byte(u.Name)); err != nil {
+			return err
+		}
+		u.Version++
+		u.CreatedAt = timeFromUnix(getInt64FromBytes(reqUsrBucket.Get(keyCreatedAt)))
+		u.UpdatedAt = time.Now().UTC()
+		return putUserIntoBucket(reqUsrBucket, u)
+	})
+}
+
+// boltUserVersion returns the version of a user, users written before versioning have version 1
+func boltUserVersion(bucket *bolt.Bucket) int64 {
+	if v := getInt64FromBytes(bucket.Get(keyVersion)); v > 0 {
+		return v
 	}
-	return user, nil
+	return 1
 }
 
-// GetByName ...
-func (s *BoltDBUserStore) GetByName(name string) (models.User, error) {
-	var user models.User
+func putUserIntoBucket(bucket *bolt.Bucket, u models.User) error {
+	if err := bucket.Put(keyName, []byte(u.Name)); err != nil {
+		return err
+	}
+	if err := bucket.Put(keyHash, u.Hash); err != nil {
+		return err
+	}
+	if err := bucket.Put(keyRole, []byte(u.Role)); err != nil {
+		return err
+	}
+	fields := []struct {
+		key   []byte
+		value []byte
+	}{
+		{keyDisplayName, []byte(u.DisplayName)},
+		{keyEmail, []byte(u.Email)},
+		{keyLocale, []byte(u.Locale)},
+		{keyCreatedAt, getUInt64Bytes(uint64(timeToUnix(u.CreatedAt)))},
+		{keyUpdatedAt, getUInt64Bytes(uint64(timeToUnix(u.UpdatedAt)))},
+		{keyVersion, getUInt64Bytes(uint64(u.Version))},
+		{keyStatus, []byte(u.Status)},
+		{keyDeletedAt, getUInt64Bytes(uint64(timeToUnix(u.DeletedAt)))},
+		{keyOrgID, []byte(u.OrgID)},
+		{keyAvatar, []byte(u.Avatar)},
+		{keyTokenGeneration, getUInt64Bytes(uint64(u.TokenGeneration))},
+	}
+	for _, f := range fields {
+		if err := bucket.Put(f.key, f.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	if err := s.db.View(func(tx *bolt.Tx) error {
-		usrBucket := tx.Bucket(boltkeyUsersBucket)
-		nameBytes := []byte(name)
-		cur := usrBucket.Cursor()
-		for k, _ := cur.First(); k != nil; k, _ = cur.Next() {
-			if bytes.Equal(usrBucket.Bucket(k).Get(keyName), nameBytes) {
-				foundUser, err := userFromBucket(usrBucket.Bucket(k))
-				if err != nil {
-					return fmt.Errorf("Internal Server Error: User")
-				}
-				user = foundUser
-				return nil
-			}
+// renameBoltUser moves the entry of the user with key in the index of the usernames from oldName to newName.
+// It returns ErrConflict if another user already has a name that is normalized like newName.
+func renameBoltUser(tx *bolt.Tx, key, oldName, newName []byte) error {
+	names := tx.Bucket(boltkeyUserNamesBucket)
+	oldName, newName = boltNameKey(oldName), boltNameKey(newName)
+	if existing := names.Get(newName); existing != nil && !bytes.Equal(existing, key) {
+		return ErrConflict
+	}
+	if oldName != nil && !bytes.Equal(oldName, newName) && bytes.Equal(names.Get(oldName), key) {
+		if err := names.Delete(oldName); err != nil {
+			return err
 		}
-		return fmt.Errorf("Could not locate user")
-	}); err != nil {
-		return user, fmt.Errorf("Could not find user '%s'. Error: %v", name, err)
 	}
-	return user, nil
+	return names.Put(newName, key)
 }
 
-// Update ...
-func (s *BoltDBUserStore) Update(u models.User) error {
-	return nil
+// Delete ...
+func (s *BoltDBUserStore) Delete(ctx context.Context, id string, version int64) error {
+	key, err := boltUserKey(id)
+	if err != nil {
+		return err
+	}
+	return boltUpdateContext(ctx, s.db, func(tx *bolt.Tx) error {
+		usrBucket := tx.Bucket(boltkeyUsersBucket)
+		reqUsrBucket := usrBucket.Bucket(key)
+		if reqUsrBucket == nil {
+			return ErrNotFound
+		}
+		if boltUserVersion(reqUsrBucket) != version {
+			return ErrVersionConflict
+		}
+		names := tx.Bucket(boltkeyUserNamesBucket)
+		if name := boltNameKey(reqUsrBucket.Get(keyName)); bytes.Equal(names.Get(name), key) {
+			if err := names.Delete(name); err != nil {
+				return err
+			}
+		}
+		if err := tx.Bucket(boltkeyUserIDsBucket).Delete(boltIDKey(key)); err != nil {
+			return err
+		}
+		return usrBucket.DeleteBucket(key)
+	})
 }
 
-// InsertAll ...
-func (s *BoltDBUserStore) InsertAll(users []models.User) error {
-	return nil
+// InsertAll adds all users in a single transaction
+func (s *BoltDBUserStore) InsertAll(ctx context.Context, users []models.User) error {
+	return boltUpdateContext(ctx, s.db, func(tx *bolt.Tx) error {
+		for _, u := range users {
+			if _, err := insertBoltUser(tx, u); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
 // Insert ...
-func (s *BoltDBUserStore) Insert(user models.User) error {
-	return nil
+func (s *BoltDBUserStore) Insert(ctx context.Context, user models.User) (models.User, error) {
+	err := boltUpdateContext(ctx, s.db, func(tx *bolt.Tx) error {
+		var err error
+		user, err = insertBoltUser(tx, user)
+		return err
+	})
+	if err != nil {
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+// insertBoltUser adds the user with the next id, it returns ErrConflict if the normalized name is already used
+func insertBoltUser(tx *bolt.Tx, user models.User) (models.User, error) {
+	user = withInsertDefaults(user)
+	name := boltNameKey([]byte(user.Name))
+	if tx.Bucket(boltkeyUserNamesBucket).Get(name) != nil {
+		return models.User{}, ErrConflict
+	}
+	bucket := tx.Bucket(boltkeyUsersBucket)
+	id, err := bucket.NextSequence()
+	if err != nil {
+		return models.User{}, err
+	}
+	key := getUInt64Bytes(id)
+	curUserBucket, err := bucket.CreateBucket(key)
+	if err != nil {
+		return models.User{}, fmt.Errorf("Could not create bucket for user '%d'. Error: %w", id, err)
+	}
+	if err := curUserBucket.Put(keyID, key); err != nil {
+		return models.User{}, err
+	}
+	if err := tx.Bucket(boltkeyUserNamesBucket).Put(name, key); err != nil {
+		return models.User{}, err
+	}
+	if err := tx.Bucket(boltkeyUserIDsBucket).Put(boltIDKey(key), key); err != nil {
+		return models.User{}, err
+	}
+	user.ID = strconv.FormatUint(id, 10)
+	return user, putUserIntoBucket(curUserBucket, user)
 }
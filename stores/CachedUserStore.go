@@ -0,0 +1,126 @@
+package stores
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Kirides/simpleApi/models"
+)
+
+// maxCachedUsers limits the memory used by a CachedUserStore
+const maxCachedUsers = 10000
+
+// CachedUserStore keeps users read by Get for a short time, so the user of every
+// authenticated request does not have to be read from the underlying store.
+// Writes through the CachedUserStore remove the affected users from the cache immediately,
+// changes made by other processes are seen once the TTL is over.
+type CachedUserStore struct {
+	us  UserStore
+	TTL time.Duration
+
+	m     sync.Mutex
+	users map[string]cachedUser
+	// epoch is increased by every invalidation, users loaded while it changed are not cached,
+	// they might have been read before the change that caused the invalidation
+	epoch uint64
+}
+
+type cachedUser struct {
+	user    models.User
+	expires time.Time
+}
+
+// NewCachedUserStore creates a UserStore that caches users of us for ttl
+func NewCachedUserStore(us UserStore, ttl time.Duration) *CachedUserStore {
+	return &CachedUserStore{us: us, TTL: ttl, users: make(map[string]cachedUser)}
+}
+
+// Invalidate removes the user from the cache
+func (s *CachedUserStore) Invalidate(id string) {
+	s.m.Lock()
+	delete(s.users, id)
+	s.epoch++
+	s.m.Unlock()
+}
+
+// put caches the user unless the cache was invalidated since epoch
+func (s *CachedUserStore) put(u models.User, now time.Time, epoch uint64) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.epoch != epoch {
+		return
+	}
+	if len(s.users) >= maxCachedUsers {
+		for id, c := range s.users {
+			if now.After(c.expires) {
+				delete(s.users, id)
+			}
+		}
+		if len(s.users) >= maxCachedUsers {
+			s.users = make(map[string]cachedUser)
+		}
+	}
+	s.users[u.ID] = cachedUser{user: u, expires: now.Add(s.TTL)}
+}
+
+// GetPage ...
+func (s *CachedUserStore) GetPage(ctx context.Context, offset int64, limit int64) ([]models.User, error) {
+	return s.us.GetPage(ctx, offset, limit)
+}
+
+// Find ...
+func (s *CachedUserStore) Find(ctx context.Context, q UserQuery) ([]models.User, error) {
+	return s.us.Find(ctx, q)
+}
+
+// Count ...
+func (s *CachedUserStore) Count(ctx context.Context, q UserQuery) (int64, error) {
+	return s.us.Count(ctx, q)
+}
+
+// Get ...
+func (s *CachedUserStore) Get(ctx context.Context, id string) (models.User, error) {
+	now := time.Now()
+	s.m.Lock()
+	c, ok := s.users[id]
+	epoch := s.epoch
+	s.m.Unlock()
+	if ok && now.Before(c.expires) {
+		// the cached user is shared, callers must not be able to modify its hash
+		return cloneUser(c.user), nil
+	}
+	u, err := s.us.Get(ctx, id)
+	if err != nil || s.TTL <= 0 {
+		return u, err
+	}
+	s.put(cloneUser(u), now, epoch)
+	return u, nil
+}
+
+// GetByName ...
+func (s *CachedUserStore) GetByName(ctx context.Context, name string) (models.User, error) {
+	return s.us.GetByName(ctx, name)
+}
+
+// Update ...
+func (s *CachedUserStore) Update(ctx context.Context, u models.User) error {
+	defer s.Invalidate(u.ID)
+	return s.us.Update(ctx, u)
+}
+
+// InsertAll ...
+func (s *CachedUserStore) InsertAll(ctx context.Context, users []models.User) error {
+	return s.us.InsertAll(ctx, users)
+}
+
+// Insert ...
+func (s *CachedUserStore) Insert(ctx context.Context, user models.User) (models.User, error) {
+	return s.us.Insert(ctx, user)
+}
+
+// Delete ...
+func (s *CachedUserStore) Delete(ctx context.Context, id string, version int64) error {
+	defer s.Invalidate(id)
+	return s.us.Delete(ctx, id, version)
+}
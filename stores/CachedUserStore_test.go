@@ -0,0 +1,84 @@
+package stores_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Kirides/simpleApi/models"
+	"github.com/Kirides/simpleApi/stores"
+)
+
+// blockingUserStore pauses Get after reading the user until release is closed
+type blockingUserStore struct {
+	stores.UserStore
+	read    chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingUserStore) Get(ctx context.Context, id string) (models.User, error) {
+	u, err := s.UserStore.Get(ctx, id)
+	if s.release != nil {
+		close(s.read)
+		<-s.release
+	}
+	return u, err
+}
+
+func TestCachedUserStoreDoesNotCacheUsersReadBeforeAnInvalidation(t *testing.T) {
+	ctx := context.Background()
+	inner := &blockingUserStore{UserStore: stores.NewMemoryUserStore()}
+	u, err := inner.Insert(ctx, models.User{Name: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := stores.NewCachedUserStore(inner, time.Hour)
+
+	inner.read, inner.release = make(chan struct{}), make(chan struct{})
+	stale := make(chan models.User)
+	go func() {
+		u, _ := cache.Get(ctx, u.ID)
+		stale <- u
+	}()
+	<-inner.read
+	// revoke all tokens while the old user is being loaded
+	updated := u
+	updated.RevokeTokens()
+	if err := cache.Update(ctx, updated); err != nil {
+		t.Fatal(err)
+	}
+	close(inner.release)
+	if got := <-stale; got.TokenGeneration != u.TokenGeneration {
+		t.Fatalf("the concurrent Get should have returned the old user")
+	}
+
+	inner.release = nil
+	got, err := cache.Get(ctx, u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.TokenGeneration == u.TokenGeneration {
+		t.Fatalf("the user read before the invalidation was cached, token generation is still %d", got.TokenGeneration)
+	}
+}
+
+func TestCachedUserStoreDoesNotShareTheHash(t *testing.T) {
+	ctx := context.Background()
+	inner := stores.NewMemoryUserStore()
+	u, err := inner.Insert(ctx, models.User{Name: "alice", Hash: []byte("hash")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := stores.NewCachedUserStore(inner, time.Hour)
+	// the first Get caches the user, the others read it from the cache
+	for i := 0; i < 3; i++ {
+		got, err := cache.Get(ctx, u.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got.Hash) != "hash" {
+			t.Fatalf("Get %d returned the hash %q", i, got.Hash)
+		}
+		got.Hash[0] = 'X'
+	}
+}
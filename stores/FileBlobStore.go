@@ -0,0 +1,124 @@
+package stores
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// FileBlobStore stores blobs as files below a directory of the local filesystem
+type FileBlobStore struct {
+	dir string
+}
+
+// NewFileBlobStore creates a new BlobStore that keeps its files in dir, which is created if needed
+func NewFileBlobStore(dir string) (*FileBlobStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("Could not create blob directory '%s'. Error: %v", dir, err)
+	}
+	return &FileBlobStore{dir: dir}, nil
+}
+
+// filename maps key to a file inside of the directory, keys leaving it are rejected
+func (s *FileBlobStore) filename(key string) (string, error) {
+	clean := path.Clean("/" + key)[1:]
+	if key == "" || clean != key || strings.Contains(key, "\\") {
+		return "", fmt.Errorf("Invalid blob key '%s'", key)
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(clean)), nil
+}
+
+// Put writes the blob into a temporary file and moves it into place afterwards,
+// readers never see partially written blobs
+func (s *FileBlobStore) Put(ctx context.Context, key string, r io.Reader) error {
+	if err := contextError(ctx); err != nil {
+		return err
+	}
+	name, err := s.filename(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(name), ".blob-")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	// the blob is not stored if the context was done while it was written
+	if err := contextError(ctx); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// Open ...
+func (s *FileBlobStore) Open(ctx context.Context, key string) (io.ReadCloser, BlobInfo, error) {
+	if err := contextError(ctx); err != nil {
+		return nil, BlobInfo{}, err
+	}
+	name, err := s.filename(key)
+	if err != nil {
+		return nil, BlobInfo{}, ErrNotFound
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, BlobInfo{}, ErrNotFound
+		}
+		return nil, BlobInfo{}, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, BlobInfo{}, err
+	}
+	if fi.IsDir() {
+		f.Close()
+		return nil, BlobInfo{}, ErrNotFound
+	}
+	return f, BlobInfo{Size: fi.Size(), ModTime: fi.ModTime()}, nil
+}
+
+// Delete removes the blob and the directories that became empty because of it
+func (s *FileBlobStore) Delete(ctx context.Context, key string) error {
+	if err := contextError(ctx); err != nil {
+		return err
+	}
+	name, err := s.filename(key)
+	if err != nil {
+		return ErrNotFound
+	}
+	if err := os.Remove(name); err != nil {
+		if os.IsNotExist(err) {
+			return ErrNotFound
+		}
+		return err
+	}
+	for dir := filepath.Dir(name); dir != filepath.Clean(s.dir); dir = filepath.Dir(dir) {
+		// fails for directories that still contain other blobs
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
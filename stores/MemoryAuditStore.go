@@ -0,0 +1,63 @@
+package stores
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Kirides/simpleApi/models"
+)
+
+// InMemoryAuditStore ...
+type InMemoryAuditStore struct {
+	events []models.AuditEvent
+	m      *sync.RWMutex
+}
+
+// NewMemoryAuditStore creates a new In-Memory AuditStore
+func NewMemoryAuditStore() *InMemoryAuditStore {
+	return &InMemoryAuditStore{m: new(sync.RWMutex)}
+}
+
+// AppendAudit ...
+func (s *InMemoryAuditStore) AppendAudit(ctx context.Context, e models.AuditEvent) (models.AuditEvent, error) {
+	if err := contextError(ctx); err != nil {
+		return e, err
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	e.ID = int64(len(s.events)) + 1
+	s.events = append(s.events, e)
+	return e, nil
+}
+
+// FindAudit ...
+func (s *InMemoryAuditStore) FindAudit(ctx context.Context, q AuditQuery) ([]models.AuditEvent, error) {
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+	s.m.RLock()
+	defer s.m.RUnlock()
+	events := []models.AuditEvent{}
+	for i := len(s.events) - 1; i >= 0; i-- {
+		if q.Limit > 0 && int64(len(events)) >= q.Limit {
+			break
+		}
+		if q.Matches(s.events[i]) {
+			events = append(events, s.events[i])
+		}
+	}
+	return events, nil
+}
+
+// LastAudit ...
+func (s *InMemoryAuditStore) LastAudit(ctx context.Context) (models.AuditEvent, error) {
+	if err := contextError(ctx); err != nil {
+		return models.AuditEvent{}, err
+	}
+	s.m.RLock()
+	defer s.m.RUnlock()
+	if len(s.events) == 0 {
+		return models.AuditEvent{}, ErrNotFound
+	}
+	return s.events[len(s.events)-1], nil
+}
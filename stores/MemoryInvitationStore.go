@@ -0,0 +1,133 @@
+package stores
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Kirides/simpleApi/models"
+)
+
+// InMemoryInvitationStore ...
+type InMemoryInvitationStore struct {
+	invitations []models.Invitation
+	lastID      int64
+	m           *sync.Mutex
+}
+
+// NewMemoryInvitationStore creates a new In-Memory InvitationStore
+func NewMemoryInvitationStore() *InMemoryInvitationStore {
+	return &InMemoryInvitationStore{m: new(sync.Mutex)}
+}
+
+// FindInvitations ...
+func (s *InMemoryInvitationStore) FindInvitations(ctx context.Context, orgID string) ([]models.Invitation, error) {
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	invitations := []models.Invitation{}
+	for i := len(s.invitations) - 1; i >= 0; i-- {
+		if orgID == "" || s.invitations[i].OrgID == orgID {
+			invitations = append(invitations, s.invitations[i])
+		}
+	}
+	return invitations, nil
+}
+
+// index requires the lock to be held
+func (s *InMemoryInvitationStore) index(id string) int {
+	for i, inv := range s.invitations {
+		if inv.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// GetInvitation ...
+func (s *InMemoryInvitationStore) GetInvitation(ctx context.Context, id string) (models.Invitation, error) {
+	if err := contextError(ctx); err != nil {
+		return models.Invitation{}, err
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	i := s.index(id)
+	if i < 0 {
+		return models.Invitation{}, ErrNotFound
+	}
+	return s.invitations[i], nil
+}
+
+// InsertInvitation ...
+func (s *InMemoryInvitationStore) InsertInvitation(ctx context.Context, inv models.Invitation) (models.Invitation, error) {
+	if err := contextError(ctx); err != nil {
+		return models.Invitation{}, err
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.lastID++
+	inv.ID = strconv.FormatInt(s.lastID, 10)
+	if inv.CreatedAt.IsZero() {
+		inv.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	}
+	s.invitations = append(s.invitations, inv)
+	return inv, nil
+}
+
+// closeInvitation applies close onto a pending invitation
+func (s *InMemoryInvitationStore) closeInvitation(ctx context.Context, id string, close func(inv *models.Invitation)) error {
+	if err := contextError(ctx); err != nil {
+		return err
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	i := s.index(id)
+	if i < 0 {
+		return ErrNotFound
+	}
+	inv := &s.invitations[i]
+	if !inv.AcceptedAt.IsZero() || !inv.RevokedAt.IsZero() {
+		return ErrConflict
+	}
+	close(inv)
+	return nil
+}
+
+// AcceptInvitation ...
+func (s *InMemoryInvitationStore) AcceptInvitation(ctx context.Context, id, userID string, at time.Time) error {
+	return s.closeInvitation(ctx, id, func(inv *models.Invitation) {
+		inv.AcceptedAt = at.UTC().Truncate(time.Second)
+		inv.UserID = userID
+	})
+}
+
+// RevokeInvitation ...
+func (s *InMemoryInvitationStore) RevokeInvitation(ctx context.Context, id string, at time.Time) error {
+	return s.closeInvitation(ctx, id, func(inv *models.Invitation) {
+		inv.RevokedAt = at.UTC().Truncate(time.Second)
+	})
+}
+
+// RemoveUserReferences ...
+func (s *InMemoryInvitationStore) RemoveUserReferences(ctx context.Context, userID string) error {
+	if err := contextError(ctx); err != nil {
+		return err
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	kept := s.invitations[:0]
+	for _, inv := range s.invitations {
+		if inv.UserID == userID {
+			continue
+		}
+		if inv.InvitedBy == userID {
+			inv.InvitedBy = ""
+		}
+		kept = append(kept, inv)
+	}
+	s.invitations = kept
+	return nil
+}
@@ -0,0 +1,310 @@
+package stores
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Kirides/simpleApi/models"
+)
+
+// InMemoryOrgStore ...
+type InMemoryOrgStore struct {
+	orgs   map[string]models.Organization
+	groups map[string]models.Group
+	// members maps group ids to the ids of their members
+	members     map[string]map[string]bool
+	lastGroupID int64
+	m           *sync.Mutex
+}
+
+// NewMemoryOrgStore creates a new In-Memory OrgStore containing the default organization
+func NewMemoryOrgStore() *InMemoryOrgStore {
+	return &InMemoryOrgStore{
+		orgs: map[string]models.Organization{
+			models.DefaultOrgID: {ID: models.DefaultOrgID, Name: "Default", CreatedAt: time.Now().UTC().Truncate(time.Second)},
+		},
+		groups:  map[string]models.Group{},
+		members: map[string]map[string]bool{},
+		m:       new(sync.Mutex),
+	}
+}
+
+// ListOrgs ...
+func (s *InMemoryOrgStore) ListOrgs(ctx context.Context) ([]models.Organization, error) {
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	orgs := make([]models.Organization, 0, len(s.orgs))
+	for _, o := range s.orgs {
+		orgs = append(orgs, o)
+	}
+	sort.Slice(orgs, func(i, j int) bool { return orgs[i].ID < orgs[j].ID })
+	return orgs, nil
+}
+
+// GetOrg ...
+func (s *InMemoryOrgStore) GetOrg(ctx context.Context, id string) (models.Organization, error) {
+	if err := contextError(ctx); err != nil {
+		return models.Organization{}, err
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	o, ok := s.orgs[id]
+	if !ok {
+		return models.Organization{}, ErrNotFound
+	}
+	return o, nil
+}
+
+// InsertOrg ...
+func (s *InMemoryOrgStore) InsertOrg(ctx context.Context, o models.Organization) (models.Organization, error) {
+	if err := contextError(ctx); err != nil {
+		return models.Organization{}, err
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	if _, ok := s.orgs[o.ID]; ok {
+		return models.Organization{}, ErrConflict
+	}
+	if o.CreatedAt.IsZero() {
+		o.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	}
+	s.orgs[o.ID] = o
+	return o, nil
+}
+
+// UpdateOrg ...
+func (s *InMemoryOrgStore) UpdateOrg(ctx context.Context, o models.Organization) error {
+	if err := contextError(ctx); err != nil {
+		return err
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	existing, ok := s.orgs[o.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	existing.Name = o.Name
+	s.orgs[o.ID] = existing
+	return nil
+}
+
+// DeleteOrg ...
+func (s *InMemoryOrgStore) DeleteOrg(ctx context.Context, id string) error {
+	if err := contextError(ctx); err != nil {
+		return err
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	if _, ok := s.orgs[id]; !ok {
+		return ErrNotFound
+	}
+	for gid, g := range s.groups {
+		if g.OrgID == id {
+			delete(s.groups, gid)
+			delete(s.members, gid)
+		}
+	}
+	delete(s.orgs, id)
+	return nil
+}
+
+// sortGroups sorts groups by name and id
+func sortGroups(groups []models.Group) {
+	sort.Slice(groups, func(i, j int) bool {
+		a, b := strings.ToLower(groups[i].Name), strings.ToLower(groups[j].Name)
+		if a != b {
+			return a < b
+		}
+		return compareIDs(groups[i].ID, groups[j].ID) < 0
+	})
+}
+
+// ListGroups ...
+func (s *InMemoryOrgStore) ListGroups(ctx context.Context, orgID string) ([]models.Group, error) {
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	groups := []models.Group{}
+	for _, g := range s.groups {
+		if g.OrgID == orgID {
+			groups = append(groups, g)
+		}
+	}
+	sortGroups(groups)
+	return groups, nil
+}
+
+// group requires the lock to be held
+func (s *InMemoryOrgStore) group(orgID, id string) (models.Group, error) {
+	g, ok := s.groups[id]
+	if !ok || g.OrgID != orgID {
+		return models.Group{}, ErrNotFound
+	}
+	return g, nil
+}
+
+// nameTaken requires the lock to be held
+func (s *InMemoryOrgStore) nameTaken(g models.Group) bool {
+	for _, other := range s.groups {
+		if other.OrgID == g.OrgID && other.ID != g.ID && strings.EqualFold(other.Name, g.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetGroup ...
+func (s *InMemoryOrgStore) GetGroup(ctx context.Context, orgID, id string) (models.Group, error) {
+	if err := contextError(ctx); err != nil {
+		return models.Group{}, err
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.group(orgID, id)
+}
+
+// InsertGroup ...
+func (s *InMemoryOrgStore) InsertGroup(ctx context.Context, g models.Group) (models.Group, error) {
+	if err := contextError(ctx); err != nil {
+		return models.Group{}, err
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	g.ID = ""
+	if s.nameTaken(g) {
+		return models.Group{}, ErrConflict
+	}
+	s.lastGroupID++
+	g.ID = strconv.FormatInt(s.lastGroupID, 10)
+	if g.CreatedAt.IsZero() {
+		g.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	}
+	s.groups[g.ID] = g
+	return g, nil
+}
+
+// UpdateGroup ...
+func (s *InMemoryOrgStore) UpdateGroup(ctx context.Context, g models.Group) error {
+	if err := contextError(ctx); err != nil {
+		return err
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	existing, err := s.group(g.OrgID, g.ID)
+	if err != nil {
+		return err
+	}
+	if s.nameTaken(g) {
+		return ErrConflict
+	}
+	existing.Name = g.Name
+	existing.Description = g.Description
+	s.groups[g.ID] = existing
+	return nil
+}
+
+// DeleteGroup ...
+func (s *InMemoryOrgStore) DeleteGroup(ctx context.Context, orgID, id string) error {
+	if err := contextError(ctx); err != nil {
+		return err
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	if _, err := s.group(orgID, id); err != nil {
+		return err
+	}
+	delete(s.groups, id)
+	delete(s.members, id)
+	return nil
+}
+
+// GroupMembers ...
+func (s *InMemoryOrgStore) GroupMembers(ctx context.Context, orgID, groupID string) ([]string, error) {
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	if _, err := s.group(orgID, groupID); err != nil {
+		return nil, err
+	}
+	ids := []string{}
+	for id := range s.members[groupID] {
+		ids = append(ids, id)
+	}
+	sortIDs(ids)
+	return ids, nil
+}
+
+// AddGroupMember ...
+func (s *InMemoryOrgStore) AddGroupMember(ctx context.Context, orgID, groupID, userID string) error {
+	if err := contextError(ctx); err != nil {
+		return err
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	if _, err := s.group(orgID, groupID); err != nil {
+		return err
+	}
+	if s.members[groupID] == nil {
+		s.members[groupID] = map[string]bool{}
+	}
+	s.members[groupID][userID] = true
+	return nil
+}
+
+// RemoveGroupMember ...
+func (s *InMemoryOrgStore) RemoveGroupMember(ctx context.Context, orgID, groupID, userID string) error {
+	if err := contextError(ctx); err != nil {
+		return err
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	if _, err := s.group(orgID, groupID); err != nil {
+		return err
+	}
+	if !s.members[groupID][userID] {
+		return ErrNotFound
+	}
+	delete(s.members[groupID], userID)
+	return nil
+}
+
+// UserGroups ...
+func (s *InMemoryOrgStore) UserGroups(ctx context.Context, userID string) ([]models.Group, error) {
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	groups := []models.Group{}
+	for gid, members := range s.members {
+		if members[userID] {
+			groups = append(groups, s.groups[gid])
+		}
+	}
+	sortGroups(groups)
+	return groups, nil
+}
+
+// RemoveUserMemberships ...
+func (s *InMemoryOrgStore) RemoveUserMemberships(ctx context.Context, userID string) error {
+	if err := contextError(ctx); err != nil {
+		return err
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	for _, members := range s.members {
+		delete(members, userID)
+	}
+	return nil
+}
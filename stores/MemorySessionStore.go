@@ -0,0 +1,159 @@
+package stores
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Kirides/simpleApi/models"
+)
+
+// InMemorySessionStore ...
+type InMemorySessionStore struct {
+	sessions map[string]models.Session
+	m        *sync.RWMutex
+}
+
+// NewMemorySessionStore creates a new In-Memory SessionStore
+func NewMemorySessionStore() *InMemorySessionStore {
+	return &InMemorySessionStore{sessions: make(map[string]models.Session), m: new(sync.RWMutex)}
+}
+
+// sortSessions orders sessions newest first
+func sortSessions(sessions []models.Session) {
+	sort.Slice(sessions, func(i, j int) bool {
+		if !sessions[i].CreatedAt.Equal(sessions[j].CreatedAt) {
+			return sessions[i].CreatedAt.After(sessions[j].CreatedAt)
+		}
+		return sessions[i].ID < sessions[j].ID
+	})
+}
+
+// InsertSession ...
+func (s *InMemorySessionStore) InsertSession(ctx context.Context, session models.Session) error {
+	if err := contextError(ctx); err != nil {
+		return err
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	if _, ok := s.sessions[session.ID]; ok {
+		return ErrConflict
+	}
+	s.sessions[session.ID] = session
+	return nil
+}
+
+// GetSession ...
+func (s *InMemorySessionStore) GetSession(ctx context.Context, id string) (models.Session, error) {
+	if err := contextError(ctx); err != nil {
+		return models.Session{}, err
+	}
+	s.m.RLock()
+	defer s.m.RUnlock()
+	session, ok := s.sessions[id]
+	if !ok {
+		return session, ErrNotFound
+	}
+	return session, nil
+}
+
+// UserSessions ...
+func (s *InMemorySessionStore) UserSessions(ctx context.Context, userID string, now time.Time) ([]models.Session, error) {
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+	s.m.RLock()
+	defer s.m.RUnlock()
+	sessions := []models.Session{}
+	for _, session := range s.sessions {
+		if session.UserID == userID && session.Active(now) {
+			sessions = append(sessions, session)
+		}
+	}
+	sortSessions(sessions)
+	return sessions, nil
+}
+
+// TouchSession ...
+func (s *InMemorySessionStore) TouchSession(ctx context.Context, id string, at time.Time, ip string) error {
+	if err := contextError(ctx); err != nil {
+		return err
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	session, ok := s.sessions[id]
+	if !ok {
+		return ErrNotFound
+	}
+	session.LastSeenAt = at
+	session.IP = ip
+	s.sessions[id] = session
+	return nil
+}
+
+// RevokeSession ...
+func (s *InMemorySessionStore) RevokeSession(ctx context.Context, id string, at time.Time) error {
+	if err := contextError(ctx); err != nil {
+		return err
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	session, ok := s.sessions[id]
+	if !ok || !session.RevokedAt.IsZero() {
+		return ErrNotFound
+	}
+	session.RevokedAt = at
+	s.sessions[id] = session
+	return nil
+}
+
+// RevokeUserSessions ...
+func (s *InMemorySessionStore) RevokeUserSessions(ctx context.Context, userID, exceptID string, at time.Time) (int64, error) {
+	if err := contextError(ctx); err != nil {
+		return 0, err
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	var n int64
+	for id, session := range s.sessions {
+		if session.UserID == userID && id != exceptID && session.Active(at) {
+			session.RevokedAt = at
+			s.sessions[id] = session
+			n++
+		}
+	}
+	return n, nil
+}
+
+// RemoveUserSessions ...
+func (s *InMemorySessionStore) RemoveUserSessions(ctx context.Context, userID string) error {
+	if err := contextError(ctx); err != nil {
+		return err
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	for id, session := range s.sessions {
+		if session.UserID == userID {
+			delete(s.sessions, id)
+		}
+	}
+	return nil
+}
+
+// RemoveExpiredSessions ...
+func (s *InMemorySessionStore) RemoveExpiredSessions(ctx context.Context, before time.Time) (int64, error) {
+	if err := contextError(ctx); err != nil {
+		return 0, err
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	var n int64
+	for id, session := range s.sessions {
+		if session.ExpiresAt.Before(before) {
+			delete(s.sessions, id)
+			n++
+		}
+	}
+	return n, nil
+}
@@ -1,41 +1,86 @@
 package stores
 
 import (
-	"fmt"
+	"context"
+	"sync"
+	"time"
 
 	"github.com/Kirides/simpleApi/models"
 )
 
-// MemoryTokenStore ...
+// MemoryTokenStore keeps tokens in memory until their date, it is safe for concurrent use.
+// Tokens whose date is over are reported by ErrNotFound and removed.
 type MemoryTokenStore struct {
-	db map[string]int64
+	tokens map[string]int64
+	m      *sync.RWMutex
 }
 
-// NewMemoryTokenStore Creates a new BoltDB-Based UserStore
-func NewMemoryTokenStore(db map[string]int64) (*MemoryTokenStore, error) {
-	store := &MemoryTokenStore{db: db}
-	return store, nil
+// NewMemoryTokenStore Creates a new In-Memory TokenStore
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{tokens: make(map[string]int64), m: new(sync.RWMutex)}
 }
 
 // Get ...
-func (s MemoryTokenStore) Get(id string) (models.TokenStruct, error) {
-	tokenStruct := models.TokenStruct{}
-	if v, ok := s.db[id]; ok {
-		tokenStruct.Token = id
-		tokenStruct.Date = v
-	} else {
-		return tokenStruct, fmt.Errorf("Could not locate token")
-	}
-	return tokenStruct, nil
+func (s *MemoryTokenStore) Get(ctx context.Context, id string) (models.TokenStruct, error) {
+	if err := contextError(ctx); err != nil {
+		return models.TokenStruct{}, err
+	}
+	s.m.RLock()
+	date, ok := s.tokens[id]
+	s.m.RUnlock()
+	if !ok {
+		return models.TokenStruct{}, ErrNotFound
+	}
+	if date <= time.Now().Unix() {
+		s.m.Lock()
+		// the token may have been set again in the meantime
+		if s.tokens[id] == date {
+			delete(s.tokens, id)
+		}
+		s.m.Unlock()
+		return models.TokenStruct{}, ErrNotFound
+	}
+	return models.TokenStruct{Token: id, Date: date}, nil
 }
 
 // Remove ...
-func (s *MemoryTokenStore) Remove(id string) error {
+func (s *MemoryTokenStore) Remove(ctx context.Context, id string) error {
+	if err := contextError(ctx); err != nil {
+		return err
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	if _, ok := s.tokens[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.tokens, id)
 	return nil
 }
 
-// Set ...
-func (s *MemoryTokenStore) Set(id string, date int64) error {
-	s.db[id] = date
+// Set stores the token until the date (unix seconds)
+func (s *MemoryTokenStore) Set(ctx context.Context, id string, date int64) error {
+	if err := contextError(ctx); err != nil {
+		return err
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.tokens[id] = date
 	return nil
 }
+
+// RemoveExpired ...
+func (s *MemoryTokenStore) RemoveExpired(ctx context.Context, before time.Time) (int64, error) {
+	if err := contextError(ctx); err != nil {
+		return 0, err
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	var n int64
+	for id, date := range s.tokens {
+		if date <= before.Unix() {
+			delete(s.tokens, id)
+			n++
+		}
+	}
+	return n, nil
+}
@@ -1,81 +1,225 @@
 package stores
 
 import (
-	"log"
+	"context"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/Kirides/simpleApi/models"
 )
 
-// InMemoryUserStore ...
+// InMemoryUserStore keeps users in memory, it is meant for tests and demos.
+// It behaves like the other stores: ids are assigned on insert, names are unique
+// and missing users are reported by ErrNotFound. It is safe for concurrent use.
 type InMemoryUserStore struct {
-	users []models.User
-	m     *sync.Mutex
+	users  []models.User
+	lastID int64
+	m      *sync.RWMutex
 }
 
-// NewMemoryUserStore Creates a new In-Memory UserStore
+// NewMemoryUserStore Creates a new empty In-Memory UserStore
 func NewMemoryUserStore() *InMemoryUserStore {
-	store := &InMemoryUserStore{
-		m: new(sync.Mutex),
+	return &InMemoryUserStore{
+		m: new(sync.RWMutex),
 	}
-	if err := store.Insert(models.User{ID: "1", Name: "abc", Hash: []byte("$2a$10$WX3dM2ElqQFOTgtnOzjP9.snX3d0HbfQ1t.1uOWeSUeucz5RB8rEa")}); err != nil {
-		log.Printf("Error inserting Demo data. Error: %v", err)
+}
+
+// SeedIfEmpty inserts the users if the store does not contain any user yet, e.g. demo data.
+// It reports whether the users were inserted.
+func (s *InMemoryUserStore) SeedIfEmpty(users ...models.User) (bool, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if len(s.users) > 0 {
+		return false, nil
+	}
+	if err := s.insertAll(users); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// cloneUser copies the hash of u, so callers can not modify the stored user
+func cloneUser(u models.User) models.User {
+	if u.Hash != nil {
+		u.Hash = append([]byte(nil), u.Hash...)
 	}
-	return store
+	return u
+}
+
+// cloneUsers copies users, see cloneUser
+func cloneUsers(users []models.User) []models.User {
+	result := make([]models.User, len(users))
+	for i, u := range users {
+		result[i] = cloneUser(u)
+	}
+	return result
 }
 
 // GetPage ...
-func (s *InMemoryUserStore) GetPage(offset int64, limit int64) ([]models.User, error) {
-	total := offset + limit
-	if total > int64(len(s.users)) {
-		return s.users[offset:], nil
+func (s *InMemoryUserStore) GetPage(ctx context.Context, offset int64, limit int64) ([]models.User, error) {
+	return s.Find(ctx, UserQuery{Offset: offset, Limit: limit})
+}
+
+// Find ...
+func (s *InMemoryUserStore) Find(ctx context.Context, q UserQuery) ([]models.User, error) {
+	if err := contextError(ctx); err != nil {
+		return nil, err
 	}
-	return s.users[offset : offset+limit], nil
+	s.m.RLock()
+	defer s.m.RUnlock()
+	return cloneUsers(q.Apply(s.users)), nil
 }
 
-// Get ...
-func (s *InMemoryUserStore) Get(id string) (models.User, error) {
-	s.m.Lock()
-	for _, v := range s.users {
-		if v.ID == id {
-			s.m.Unlock()
-			return v, nil
+// Count ...
+func (s *InMemoryUserStore) Count(ctx context.Context, q UserQuery) (int64, error) {
+	if err := contextError(ctx); err != nil {
+		return 0, err
+	}
+	s.m.RLock()
+	defer s.m.RUnlock()
+	return q.Count(s.users), nil
+}
+
+// index returns the position of the user with the id or -1, it requires the lock to be held
+func (s *InMemoryUserStore) index(id string) int {
+	for i, u := range s.users {
+		if u.ID == id {
+			return i
 		}
 	}
-	s.m.Unlock()
-	return models.User{}, nil
+	return -1
+}
+
+// nameTaken reports whether a user other than the one with the id has a name that is normalized like name,
+// it requires the lock to be held
+func (s *InMemoryUserStore) nameTaken(name, id string) bool {
+	name = NormalizeUserName(name)
+	for _, u := range s.users {
+		if NormalizeUserName(u.Name) == name && u.ID != id {
+			return true
+		}
+	}
+	return false
+}
+
+// Get ...
+func (s *InMemoryUserStore) Get(ctx context.Context, id string) (models.User, error) {
+	if err := contextError(ctx); err != nil {
+		return models.User{}, err
+	}
+	s.m.RLock()
+	defer s.m.RUnlock()
+	i := s.index(id)
+	if i < 0 {
+		return models.User{}, ErrNotFound
+	}
+	return cloneUser(s.users[i]), nil
 }
 
 // GetByName ...
-func (s *InMemoryUserStore) GetByName(name string) (models.User, error) {
-	s.m.Lock()
-	for _, v := range s.users {
-		if v.Name == name {
-			s.m.Unlock()
-			return v, nil
+func (s *InMemoryUserStore) GetByName(ctx context.Context, name string) (models.User, error) {
+	if err := contextError(ctx); err != nil {
+		return models.User{}, err
+	}
+	name = NormalizeUserName(name)
+	s.m.RLock()
+	defer s.m.RUnlock()
+	for _, u := range s.users {
+		if NormalizeUserName(u.Name) == name {
+			return cloneUser(u), nil
 		}
 	}
-	s.m.Unlock()
-	return models.User{}, nil
+	return models.User{}, ErrNotFound
 }
 
 // Update ...
-func (s *InMemoryUserStore) Update(u models.User) error {
+func (s *InMemoryUserStore) Update(ctx context.Context, u models.User) error {
+	if err := contextError(ctx); err != nil {
+		return err
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	i := s.index(u.ID)
+	if i < 0 {
+		return ErrNotFound
+	}
+	existing := s.users[i]
+	if existing.Version != u.Version {
+		return ErrVersionConflict
+	}
+	if s.nameTaken(u.Name, u.ID) {
+		return ErrConflict
+	}
+	u.Version++
+	u.CreatedAt = existing.CreatedAt
+	u.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+	s.users[i] = cloneUser(u)
 	return nil
 }
 
-// InsertAll ...
-func (s *InMemoryUserStore) InsertAll(users []models.User) error {
+// Delete ...
+func (s *InMemoryUserStore) Delete(ctx context.Context, id string, version int64) error {
+	if err := contextError(ctx); err != nil {
+		return err
+	}
 	s.m.Lock()
-	s.users = append(s.users, users...)
-	s.m.Unlock()
+	defer s.m.Unlock()
+	i := s.index(id)
+	if i < 0 {
+		return ErrNotFound
+	}
+	if s.users[i].Version != version {
+		return ErrVersionConflict
+	}
+	s.users = append(s.users[:i], s.users[i+1:]...)
 	return nil
 }
 
-// Insert ...
-func (s *InMemoryUserStore) Insert(user models.User) error {
+// InsertAll adds either all users or, if a name is already used, none of them
+func (s *InMemoryUserStore) InsertAll(ctx context.Context, users []models.User) error {
+	if err := contextError(ctx); err != nil {
+		return err
+	}
 	s.m.Lock()
-	s.users = append(s.users, user)
-	s.m.Unlock()
+	defer s.m.Unlock()
+	return s.insertAll(users)
+}
+
+// insertAll requires the lock to be held
+func (s *InMemoryUserStore) insertAll(users []models.User) error {
+	names := make(map[string]bool, len(users))
+	for _, u := range users {
+		name := NormalizeUserName(u.Name)
+		if names[name] || s.nameTaken(u.Name, "") {
+			return ErrConflict
+		}
+		names[name] = true
+	}
+	for _, u := range users {
+		s.insert(u)
+	}
 	return nil
 }
+
+// Insert ...
+func (s *InMemoryUserStore) Insert(ctx context.Context, user models.User) (models.User, error) {
+	if err := contextError(ctx); err != nil {
+		return models.User{}, err
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.nameTaken(user.Name, "") {
+		return models.User{}, ErrConflict
+	}
+	return s.insert(user), nil
+}
+
+// insert assigns the next id, it requires the lock to be held
+func (s *InMemoryUserStore) insert(user models.User) models.User {
+	s.lastID++
+	user = withInsertDefaults(user)
+	user.ID = strconv.FormatInt(s.lastID, 10)
+	s.users = append(s.users, cloneUser(user))
+	return user
+}
@@ -1,85 +1,66 @@
 package stores
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"log"
+	"time"
 
 	"github.com/Kirides/simpleApi/models"
 )
 
 // SQLTokenStore Store that enables Saving and Reading Users
 type SQLTokenStore struct {
-	db *sql.DB
+	db sqlDB
 }
 
-// NewSQLTokenStore Creates a new UserStore that uses Sqlite3
-func NewSQLTokenStore(db *sql.DB) (*SQLTokenStore, error) {
-	store := &SQLTokenStore{db: db}
-
-	return store, store.initialize()
-}
-func (s *SQLTokenStore) initialize() error {
-	if _, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS Tokens (
-Id INTEGER PRIMARY KEY AUTOINCREMENT,
-TokenId TEXT NOT NULL,
-Date INTEGER NOT NULL
-)`); err != nil {
-		log.Printf("Could not initialize Table. Error: %v", err)
-	}
-	return nil
+// NewSQLTokenStore Creates a new TokenStore for the database of the dialect.
+// The tables are created by the migrations, see NewSQLMigrator.
+func NewSQLTokenStore(db *sql.DB, d SQLDialect) (*SQLTokenStore, error) {
+	return &SQLTokenStore{db: sqlDB{db: db, d: d}}, nil
 }
 
 // Get ...
-func (s SQLTokenStore) Get(id string) (models.TokenStruct, error) {
+func (s SQLTokenStore) Get(ctx context.Context, id string) (models.TokenStruct, error) {
 	var tokenStruct models.TokenStruct
-	row := s.db.QueryRow("SELECT TokenId, Date FROM Tokens WHERE TokenId = ? LIMIT 1", id)
+	row := s.db.QueryRowContext(ctx, "SELECT TokenId, Date FROM Tokens WHERE TokenId = ? AND Date > ? LIMIT 1", id, time.Now().Unix())
 	if err := row.Scan(&tokenStruct.Token, &tokenStruct.Date); err != nil {
-		return tokenStruct, fmt.Errorf("Could not find token '%s'. Error: %v", id, err)
+		return tokenStruct, fmt.Errorf("Could not find token '%s'. Error: %w", id, sqlError(err))
 	}
 
 	return tokenStruct, nil
 }
 
 // Remove ...
-func (s SQLTokenStore) Remove(id string) error {
+func (s SQLTokenStore) Remove(ctx context.Context, id string) error {
+	r, err := s.db.ExecContext(ctx, "DELETE FROM Tokens WHERE TokenId = ?", id)
+	if err != nil {
+		return fmt.Errorf("Could not remove token '%s'. Error: %w", id, sqlError(err))
+	}
+	if n, err := r.RowsAffected(); err != nil {
+		return sqlError(err)
+	} else if n == 0 {
+		return ErrNotFound
+	}
 	return nil
 }
 
-// Set ...
-func (s SQLTokenStore) Set(id string, date int64) error {
-	r := s.db.QueryRow("SELECT Id FROM Tokens WHERE TokenId = ? LIMIT 1", id)
-	exist := false
-	if err := r.Scan(1); err == nil {
-		exist = true
-	}
-	tx, err := s.db.Begin()
+// RemoveExpired ...
+func (s SQLTokenStore) RemoveExpired(ctx context.Context, before time.Time) (int64, error) {
+	r, err := s.db.ExecContext(ctx, "DELETE FROM Tokens WHERE Date <= ?", before.Unix())
 	if err != nil {
-		return err
+		return 0, fmt.Errorf("Could not remove expired tokens. Error: %w", sqlError(err))
 	}
-	if exist {
-		r, err := tx.Exec("UPDATE Tokens SET Date = ? WHERE TokenId = ?", date, id)
-		if err != nil {
-			return fmt.Errorf("Error executing SQL. Error: %v", err)
-		}
-		if _, err := r.RowsAffected(); err != nil {
-			return fmt.Errorf("Error could not update token. Error: %v", err)
-		}
-	} else {
-		r, err := tx.Exec("INSERT INTO Tokens (TokenId, Date) VALUES (?, ?)", id, date)
-		if err != nil {
-			return fmt.Errorf("Error executing SQL. Error: %v", err)
-		}
+	n, err := r.RowsAffected()
+	return n, sqlError(err)
+}
 
-		if _, err := r.LastInsertId(); err != nil {
-			return fmt.Errorf("Error could not insert token into database. Error: %v", err)
-		}
-	}
-	if err := tx.Commit(); err != nil {
-		log.Printf("Could not commit changes. Error: %v", err)
-		if err := tx.Rollback(); err != nil {
-			log.Printf("WARNING: Could not rollback changes!. Error: %v", err)
-		}
+// Set stores the token until the date (unix seconds), replacing the date if the token exists.
+// TokenId is unique, so concurrent calls for the same token never store it twice.
+func (s SQLTokenStore) Set(ctx context.Context, id string, date int64) error {
+	stmt := s.db.d.upsert("INSERT INTO Tokens (TokenId, Date) VALUES (?, ?)", "TokenId", "Date")
+	if _, err := s.db.ExecContext(ctx, stmt, id, date); err != nil {
+		return fmt.Errorf("Could not store token '%s'. Error: %w", id, sqlError(err))
 	}
 	return nil
 }
@@ -0,0 +1,125 @@
+package stores
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/Kirides/simpleApi/models"
+)
+
+// SQLAuditStore persists audit events using SQL
+type SQLAuditStore struct {
+	db sqlDB
+}
+
+// NewSQLiteAuditStore creates a new AuditStore that uses Sqlite3.
+// The table is created by the migrations, whose triggers reject every UPDATE and DELETE, so it stays append-only.
+func NewSQLiteAuditStore(db *sql.DB) (*SQLAuditStore, error) {
+	return NewSQLAuditStore(db, SQLiteDialect)
+}
+
+// NewSQLAuditStore creates a new AuditStore for the database of the dialect.
+// The table is created by the migrations, whose triggers reject every UPDATE and DELETE, so it stays append-only.
+func NewSQLAuditStore(db *sql.DB, d SQLDialect) (*SQLAuditStore, error) {
+	return &SQLAuditStore{db: sqlDB{db: db, d: d}}, nil
+}
+
+const sqlAuditColumns = "Id, Time, Action, Outcome, ActorId, ActorName, TargetId, OrgID, IP, UserAgent, RequestId, Details, PrevHash, Hash"
+
+func scanSQLAudit(row sqlRowScanner) (models.AuditEvent, error) {
+	var (
+		e models.AuditEvent
+		t int64
+	)
+	if err := row.Scan(&e.ID, &t, &e.Action, &e.Outcome, &e.ActorID, &e.ActorName, &e.TargetID, &e.OrgID,
+		&e.IP, &e.UserAgent, &e.RequestID, &e.Details, &e.PrevHash, &e.Hash); err != nil {
+		return e, sqlError(err)
+	}
+	e.Time = timeFromUnix(t)
+	return e, nil
+}
+
+// AppendAudit ...
+func (s SQLAuditStore) AppendAudit(ctx context.Context, e models.AuditEvent) (models.AuditEvent, error) {
+	id, err := s.db.insert(ctx, "INSERT INTO AuditEvents (Time, Action, Outcome, ActorId, ActorName, TargetId, OrgID, IP, UserAgent, RequestId, Details, PrevHash, Hash) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?)",
+		timeToUnix(e.Time), e.Action, e.Outcome, e.ActorID, e.ActorName, e.TargetID, e.OrgID, e.IP, e.UserAgent, e.RequestID, e.Details, e.PrevHash, e.Hash)
+	if err != nil {
+		return e, sqlError(err)
+	}
+	e.ID = id
+	return e, nil
+}
+
+// FindAudit ...
+func (s SQLAuditStore) FindAudit(ctx context.Context, q AuditQuery) ([]models.AuditEvent, error) {
+	var (
+		where []string
+		args  []interface{}
+	)
+	for _, f := range []struct {
+		column string
+		value  string
+	}{
+		{"Action", q.Action},
+		{"Outcome", q.Outcome},
+		{"OrgID", q.OrgID},
+		{"IP", q.IP},
+		{"RequestId", q.RequestID},
+	} {
+		if f.value != "" {
+			where = append(where, f.column+" = ?")
+			args = append(args, f.value)
+		}
+	}
+	if q.UserID != "" {
+		where = append(where, "(ActorId = ? OR TargetId = ?)")
+		args = append(args, q.UserID, q.UserID)
+	}
+	if !q.From.IsZero() {
+		where = append(where, "Time >= ?")
+		args = append(args, timeToUnix(q.From))
+	}
+	if !q.Until.IsZero() {
+		where = append(where, "Time < ?")
+		args = append(args, timeToUnix(q.Until))
+	}
+	if q.BeforeID > 0 {
+		where = append(where, "Id < ?")
+		args = append(args, q.BeforeID)
+	}
+	query := "SELECT " + sqlAuditColumns + " FROM AuditEvents"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY Id DESC"
+	if q.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, q.Limit)
+	}
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("Could not retrieve audit events. Error: %w", sqlError(err))
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Error closing SQL rows. Error: %v", err)
+		}
+	}()
+	events := []models.AuditEvent{}
+	for rows.Next() {
+		e, err := scanSQLAudit(rows)
+		if err != nil {
+			return nil, sqlError(err)
+		}
+		events = append(events, e)
+	}
+	return events, sqlError(rows.Err())
+}
+
+// LastAudit ...
+func (s SQLAuditStore) LastAudit(ctx context.Context) (models.AuditEvent, error) {
+	return scanSQLAudit(s.db.QueryRowContext(ctx, "SELECT "+sqlAuditColumns+" FROM AuditEvents ORDER BY Id DESC LIMIT 1"))
+}
@@ -0,0 +1,142 @@
+package stores
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/Kirides/simpleApi/models"
+)
+
+// SQLInvitationStore persists invitations using SQL
+type SQLInvitationStore struct {
+	db sqlDB
+}
+
+// NewSQLiteInvitationStore creates a new InvitationStore that uses Sqlite3.
+// The table is created by the migrations, see NewSQLiteMigrator.
+func NewSQLiteInvitationStore(db *sql.DB) (*SQLInvitationStore, error) {
+	return NewSQLInvitationStore(db, SQLiteDialect)
+}
+
+// NewSQLInvitationStore creates a new InvitationStore for the database of the dialect.
+// The table is created by the migrations, see NewSQLMigrator.
+func NewSQLInvitationStore(db *sql.DB, d SQLDialect) (*SQLInvitationStore, error) {
+	return &SQLInvitationStore{db: sqlDB{db: db, d: d}}, nil
+}
+
+const sqlInvitationColumns = "Id, Email, Role, OrgID, InvitedBy, CreatedAt, ExpiresAt, AcceptedAt, RevokedAt, UserId"
+
+func scanSQLInvitation(row sqlRowScanner) (models.Invitation, error) {
+	var (
+		inv                                         models.Invitation
+		createdAt, expiresAt, acceptedAt, revokedAt int64
+	)
+	if err := row.Scan(&inv.ID, &inv.Email, &inv.Role, &inv.OrgID, &inv.InvitedBy,
+		&createdAt, &expiresAt, &acceptedAt, &revokedAt, &inv.UserID); err != nil {
+		return inv, sqlError(err)
+	}
+	inv.CreatedAt = timeFromUnix(createdAt)
+	inv.ExpiresAt = timeFromUnix(expiresAt)
+	inv.AcceptedAt = timeFromUnix(acceptedAt)
+	inv.RevokedAt = timeFromUnix(revokedAt)
+	return inv, nil
+}
+
+// FindInvitations ...
+func (s SQLInvitationStore) FindInvitations(ctx context.Context, orgID string) ([]models.Invitation, error) {
+	query := "SELECT " + sqlInvitationColumns + " FROM Invitations"
+	var args []interface{}
+	if orgID != "" {
+		query += " WHERE OrgID = ?"
+		args = append(args, orgID)
+	}
+	rows, err := s.db.QueryContext(ctx, query+" ORDER BY Id DESC", args...)
+	if err != nil {
+		return nil, fmt.Errorf("Could not retrieve Invitations: %w", sqlError(err))
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Error closing SQL rows. Error: %v", err)
+		}
+	}()
+	invitations := []models.Invitation{}
+	for rows.Next() {
+		inv, err := scanSQLInvitation(rows)
+		if err != nil {
+			return nil, sqlError(err)
+		}
+		invitations = append(invitations, inv)
+	}
+	return invitations, sqlError(rows.Err())
+}
+
+// GetInvitation ...
+func (s SQLInvitationStore) GetInvitation(ctx context.Context, id string) (models.Invitation, error) {
+	if !validSQLID(id) {
+		return models.Invitation{}, ErrNotFound
+	}
+	return scanSQLInvitation(s.db.QueryRowContext(ctx, "SELECT "+sqlInvitationColumns+" FROM Invitations WHERE Id = ?", id))
+}
+
+// InsertInvitation ...
+func (s SQLInvitationStore) InsertInvitation(ctx context.Context, inv models.Invitation) (models.Invitation, error) {
+	if inv.CreatedAt.IsZero() {
+		inv.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	}
+	id, err := s.db.insert(ctx, "INSERT INTO Invitations (Email, Role, OrgID, InvitedBy, CreatedAt, ExpiresAt) VALUES (?, ?, ?, ?, ?, ?)",
+		inv.Email, inv.Role, inv.OrgID, inv.InvitedBy, timeToUnix(inv.CreatedAt), timeToUnix(inv.ExpiresAt))
+	if err != nil {
+		return models.Invitation{}, sqlError(err)
+	}
+	inv.ID = strconv.FormatInt(id, 10)
+	return inv, nil
+}
+
+// closeInvitation runs an update that only affects pending invitations.
+// If nothing was updated, the invitation either does not exist or is no longer pending.
+func (s SQLInvitationStore) closeInvitation(ctx context.Context, id string, query string, args ...interface{}) error {
+	if !validSQLID(id) {
+		return ErrNotFound
+	}
+	r, err := s.db.ExecContext(ctx, query, args...)
+	if err := checkAffected(r, err); err != ErrNotFound {
+		return sqlError(err)
+	}
+	if _, err := s.GetInvitation(ctx, id); err != nil {
+		return sqlError(err)
+	}
+	return ErrConflict
+}
+
+// AcceptInvitation ...
+func (s SQLInvitationStore) AcceptInvitation(ctx context.Context, id, userID string, at time.Time) error {
+	return s.closeInvitation(ctx, id, "UPDATE Invitations SET AcceptedAt = ?, UserId = ? WHERE Id = ? AND AcceptedAt = 0 AND RevokedAt = 0",
+		timeToUnix(at), userID, id)
+}
+
+// RevokeInvitation ...
+func (s SQLInvitationStore) RevokeInvitation(ctx context.Context, id string, at time.Time) error {
+	return s.closeInvitation(ctx, id, "UPDATE Invitations SET RevokedAt = ? WHERE Id = ? AND AcceptedAt = 0 AND RevokedAt = 0",
+		timeToUnix(at), id)
+}
+
+// RemoveUserReferences ...
+func (s SQLInvitationStore) RemoveUserReferences(ctx context.Context, userID string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return sqlError(err)
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM Invitations WHERE UserId = ?", userID); err != nil {
+		tx.Rollback()
+		return sqlError(err)
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE Invitations SET InvitedBy = '' WHERE InvitedBy = ?", userID); err != nil {
+		tx.Rollback()
+		return sqlError(err)
+	}
+	return tx.Commit()
+}
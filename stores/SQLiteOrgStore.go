@@ -0,0 +1,281 @@
+package stores
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/Kirides/simpleApi/models"
+)
+
+// SQLOrgStore persists organizations and groups using SQL
+type SQLOrgStore struct {
+	db sqlDB
+	// groups is the quoted name of the Groups table
+	groups string
+}
+
+// NewSQLiteOrgStore creates a new OrgStore that uses Sqlite3.
+// The tables and the default organization are created by the migrations, see NewSQLiteMigrator.
+func NewSQLiteOrgStore(db *sql.DB) (*SQLOrgStore, error) {
+	return NewSQLOrgStore(db, SQLiteDialect)
+}
+
+// NewSQLOrgStore creates a new OrgStore for the database of the dialect.
+// The tables and the default organization are created by the migrations, see NewSQLMigrator.
+func NewSQLOrgStore(db *sql.DB, d SQLDialect) (*SQLOrgStore, error) {
+	return &SQLOrgStore{db: sqlDB{db: db, d: d}, groups: d.ident("Groups")}, nil
+}
+
+// ListOrgs ...
+func (s SQLOrgStore) ListOrgs(ctx context.Context) ([]models.Organization, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT Id, Name, CreatedAt FROM Organizations ORDER BY Id")
+	if err != nil {
+		return nil, fmt.Errorf("Could not retrieve Organizations: %w", sqlError(err))
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Error closing SQL rows. Error: %v", err)
+		}
+	}()
+	orgs := []models.Organization{}
+	for rows.Next() {
+		o, err := scanSQLOrg(rows)
+		if err != nil {
+			return nil, sqlError(err)
+		}
+		orgs = append(orgs, o)
+	}
+	return orgs, sqlError(rows.Err())
+}
+
+func scanSQLOrg(row sqlRowScanner) (models.Organization, error) {
+	var (
+		o         models.Organization
+		createdAt int64
+	)
+	if err := row.Scan(&o.ID, &o.Name, &createdAt); err != nil {
+		return o, sqlError(err)
+	}
+	o.CreatedAt = timeFromUnix(createdAt)
+	return o, nil
+}
+
+// GetOrg ...
+func (s SQLOrgStore) GetOrg(ctx context.Context, id string) (models.Organization, error) {
+	return scanSQLOrg(s.db.QueryRowContext(ctx, "SELECT Id, Name, CreatedAt FROM Organizations WHERE Id = ?", id))
+}
+
+// InsertOrg ...
+func (s SQLOrgStore) InsertOrg(ctx context.Context, o models.Organization) (models.Organization, error) {
+	if o.CreatedAt.IsZero() {
+		o.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	}
+	if _, err := s.db.ExecContext(ctx, "INSERT INTO Organizations (Id, Name, CreatedAt) VALUES (?, ?, ?)", o.ID, o.Name, timeToUnix(o.CreatedAt)); err != nil {
+		if isUniqueViolation(err) {
+			return models.Organization{}, ErrConflict
+		}
+		return models.Organization{}, sqlError(err)
+	}
+	return o, nil
+}
+
+// UpdateOrg ...
+func (s SQLOrgStore) UpdateOrg(ctx context.Context, o models.Organization) error {
+	r, err := s.db.ExecContext(ctx, "UPDATE Organizations SET Name = ? WHERE Id = ?", o.Name, o.ID)
+	return checkAffected(r, err)
+}
+
+// DeleteOrg removes the organization along with its groups
+func (s SQLOrgStore) DeleteOrg(ctx context.Context, id string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return sqlError(err)
+	}
+	statements := []string{
+		"DELETE FROM GroupMembers WHERE GroupId IN (SELECT Id FROM " + s.groups + " WHERE OrgID = ?)",
+		"DELETE FROM " + s.groups + " WHERE OrgID = ?",
+	}
+	for _, stmt := range statements {
+		if _, err := tx.ExecContext(ctx, stmt, id); err != nil {
+			tx.Rollback()
+			return sqlError(err)
+		}
+	}
+	r, err := tx.ExecContext(ctx, "DELETE FROM Organizations WHERE Id = ?", id)
+	if err := checkAffected(r, err); err != nil {
+		tx.Rollback()
+		return sqlError(err)
+	}
+	return tx.Commit()
+}
+
+// checkAffected returns ErrNotFound if a statement did not affect any row
+func checkAffected(r sql.Result, err error) error {
+	if err != nil {
+		return sqlError(err)
+	}
+	n, err := r.RowsAffected()
+	if err != nil {
+		return sqlError(err)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+const sqlGroupColumns = "Id, OrgID, Name, Description, CreatedAt"
+
+func scanSQLGroup(row sqlRowScanner) (models.Group, error) {
+	var (
+		g         models.Group
+		createdAt int64
+	)
+	if err := row.Scan(&g.ID, &g.OrgID, &g.Name, &g.Description, &createdAt); err != nil {
+		return g, sqlError(err)
+	}
+	g.CreatedAt = timeFromUnix(createdAt)
+	return g, nil
+}
+
+func (s SQLOrgStore) queryGroups(ctx context.Context, query string, args ...interface{}) ([]models.Group, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("Could not retrieve Groups: %w", sqlError(err))
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Error closing SQL rows. Error: %v", err)
+		}
+	}()
+	groups := []models.Group{}
+	for rows.Next() {
+		g, err := scanSQLGroup(rows)
+		if err != nil {
+			return nil, sqlError(err)
+		}
+		groups = append(groups, g)
+	}
+	return groups, sqlError(rows.Err())
+}
+
+// ListGroups ...
+func (s SQLOrgStore) ListGroups(ctx context.Context, orgID string) ([]models.Group, error) {
+	return s.queryGroups(ctx, "SELECT "+sqlGroupColumns+" FROM "+s.groups+" WHERE OrgID = ? ORDER BY "+s.db.d.nocase("Name")+", Id", orgID)
+}
+
+// GetGroup ...
+func (s SQLOrgStore) GetGroup(ctx context.Context, orgID, id string) (models.Group, error) {
+	if !validSQLID(id) {
+		return models.Group{}, ErrNotFound
+	}
+	return scanSQLGroup(s.db.QueryRowContext(ctx, "SELECT "+sqlGroupColumns+" FROM "+s.groups+" WHERE OrgID = ? AND Id = ?", orgID, id))
+}
+
+// InsertGroup ...
+func (s SQLOrgStore) InsertGroup(ctx context.Context, g models.Group) (models.Group, error) {
+	if g.CreatedAt.IsZero() {
+		g.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	}
+	id, err := s.db.insert(ctx, "INSERT INTO "+s.groups+" (OrgID, Name, Description, CreatedAt) VALUES (?, ?, ?, ?)",
+		g.OrgID, g.Name, g.Description, timeToUnix(g.CreatedAt))
+	if err != nil {
+		if isUniqueViolation(err) {
+			return models.Group{}, ErrConflict
+		}
+		return models.Group{}, sqlError(err)
+	}
+	g.ID = strconv.FormatInt(id, 10)
+	return g, nil
+}
+
+// UpdateGroup ...
+func (s SQLOrgStore) UpdateGroup(ctx context.Context, g models.Group) error {
+	if !validSQLID(g.ID) {
+		return ErrNotFound
+	}
+	r, err := s.db.ExecContext(ctx, "UPDATE "+s.groups+" SET Name = ?, Description = ? WHERE OrgID = ? AND Id = ?", g.Name, g.Description, g.OrgID, g.ID)
+	if isUniqueViolation(err) {
+		return ErrConflict
+	}
+	return checkAffected(r, err)
+}
+
+// DeleteGroup ...
+func (s SQLOrgStore) DeleteGroup(ctx context.Context, orgID, id string) error {
+	if !validSQLID(id) {
+		return ErrNotFound
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return sqlError(err)
+	}
+	r, err := tx.ExecContext(ctx, "DELETE FROM "+s.groups+" WHERE OrgID = ? AND Id = ?", orgID, id)
+	if err := checkAffected(r, err); err != nil {
+		tx.Rollback()
+		return sqlError(err)
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM GroupMembers WHERE GroupId = ?", id); err != nil {
+		tx.Rollback()
+		return sqlError(err)
+	}
+	return tx.Commit()
+}
+
+// GroupMembers ...
+func (s SQLOrgStore) GroupMembers(ctx context.Context, orgID, groupID string) ([]string, error) {
+	if _, err := s.GetGroup(ctx, orgID, groupID); err != nil {
+		return nil, sqlError(err)
+	}
+	rows, err := s.db.QueryContext(ctx, "SELECT UserId FROM GroupMembers WHERE GroupId = ? ORDER BY LENGTH(UserId), UserId", groupID)
+	if err != nil {
+		return nil, fmt.Errorf("Could not retrieve GroupMembers: %w", sqlError(err))
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Error closing SQL rows. Error: %v", err)
+		}
+	}()
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, sqlError(err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, sqlError(rows.Err())
+}
+
+// AddGroupMember adds the user to the group, adding an existing member does nothing
+func (s SQLOrgStore) AddGroupMember(ctx context.Context, orgID, groupID, userID string) error {
+	if _, err := s.GetGroup(ctx, orgID, groupID); err != nil {
+		return sqlError(err)
+	}
+	_, err := s.db.ExecContext(ctx, s.db.d.insertIgnore("INSERT INTO GroupMembers (GroupId, UserId) VALUES (?, ?)"), groupID, userID)
+	return sqlError(err)
+}
+
+// RemoveGroupMember ...
+func (s SQLOrgStore) RemoveGroupMember(ctx context.Context, orgID, groupID, userID string) error {
+	if _, err := s.GetGroup(ctx, orgID, groupID); err != nil {
+		return sqlError(err)
+	}
+	r, err := s.db.ExecContext(ctx, "DELETE FROM GroupMembers WHERE GroupId = ? AND UserId = ?", groupID, userID)
+	return checkAffected(r, err)
+}
+
+// UserGroups ...
+func (s SQLOrgStore) UserGroups(ctx context.Context, userID string) ([]models.Group, error) {
+	return s.queryGroups(ctx, "SELECT "+sqlGroupColumns+" FROM "+s.groups+" WHERE Id IN (SELECT GroupId FROM GroupMembers WHERE UserId = ?) ORDER BY "+s.db.d.nocase("Name")+", Id", userID)
+}
+
+// RemoveUserMemberships ...
+func (s SQLOrgStore) RemoveUserMemberships(ctx context.Context, userID string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM GroupMembers WHERE UserId = ?", userID)
+	return sqlError(err)
+}
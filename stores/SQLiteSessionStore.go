@@ -0,0 +1,121 @@
+package stores
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Kirides/simpleApi/models"
+)
+
+// SQLSessionStore persists sessions using SQL
+type SQLSessionStore struct {
+	db sqlDB
+}
+
+// NewSQLiteSessionStore creates a new SessionStore that uses Sqlite3.
+// The table is created by the migrations, see NewSQLiteMigrator.
+func NewSQLiteSessionStore(db *sql.DB) (*SQLSessionStore, error) {
+	return NewSQLSessionStore(db, SQLiteDialect)
+}
+
+// NewSQLSessionStore creates a new SessionStore for the database of the dialect.
+// The table is created by the migrations, see NewSQLMigrator.
+func NewSQLSessionStore(db *sql.DB, d SQLDialect) (*SQLSessionStore, error) {
+	return &SQLSessionStore{db: sqlDB{db: db, d: d}}, nil
+}
+
+const sqlSessionColumns = "Id, UserId, Device, IP, UserAgent, CreatedAt, LastSeenAt, ExpiresAt, RevokedAt"
+
+func scanSQLSession(row sqlRowScanner) (models.Session, error) {
+	var (
+		s                                           models.Session
+		createdAt, lastSeenAt, expiresAt, revokedAt int64
+	)
+	if err := row.Scan(&s.ID, &s.UserID, &s.Device, &s.IP, &s.UserAgent, &createdAt, &lastSeenAt, &expiresAt, &revokedAt); err != nil {
+		return s, sqlError(err)
+	}
+	s.CreatedAt = timeFromUnix(createdAt)
+	s.LastSeenAt = timeFromUnix(lastSeenAt)
+	s.ExpiresAt = timeFromUnix(expiresAt)
+	s.RevokedAt = timeFromUnix(revokedAt)
+	return s, nil
+}
+
+// InsertSession ...
+func (s SQLSessionStore) InsertSession(ctx context.Context, session models.Session) error {
+	_, err := s.db.ExecContext(ctx, "INSERT INTO Sessions ("+sqlSessionColumns+") VALUES (?,?,?,?,?,?,?,?,?)",
+		session.ID, session.UserID, session.Device, session.IP, session.UserAgent, timeToUnix(session.CreatedAt),
+		timeToUnix(session.LastSeenAt), timeToUnix(session.ExpiresAt), timeToUnix(session.RevokedAt))
+	if isUniqueViolation(err) {
+		return ErrConflict
+	}
+	return sqlError(err)
+}
+
+// GetSession ...
+func (s SQLSessionStore) GetSession(ctx context.Context, id string) (models.Session, error) {
+	return scanSQLSession(s.db.QueryRowContext(ctx, "SELECT "+sqlSessionColumns+" FROM Sessions WHERE Id = ?", id))
+}
+
+// UserSessions ...
+func (s SQLSessionStore) UserSessions(ctx context.Context, userID string, now time.Time) ([]models.Session, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+sqlSessionColumns+" FROM Sessions WHERE UserId = ? AND RevokedAt = 0 AND ExpiresAt > ? ORDER BY CreatedAt DESC, Id",
+		userID, timeToUnix(now))
+	if err != nil {
+		return nil, fmt.Errorf("Could not retrieve sessions. Error: %w", sqlError(err))
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("Error closing SQL rows. Error: %v", err)
+		}
+	}()
+	sessions := []models.Session{}
+	for rows.Next() {
+		session, err := scanSQLSession(rows)
+		if err != nil {
+			return nil, sqlError(err)
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, sqlError(rows.Err())
+}
+
+// TouchSession ...
+func (s SQLSessionStore) TouchSession(ctx context.Context, id string, at time.Time, ip string) error {
+	r, err := s.db.ExecContext(ctx, "UPDATE Sessions SET LastSeenAt = ?, IP = ? WHERE Id = ?", timeToUnix(at), ip, id)
+	return checkAffected(r, err)
+}
+
+// RevokeSession ...
+func (s SQLSessionStore) RevokeSession(ctx context.Context, id string, at time.Time) error {
+	r, err := s.db.ExecContext(ctx, "UPDATE Sessions SET RevokedAt = ? WHERE Id = ? AND RevokedAt = 0", timeToUnix(at), id)
+	return checkAffected(r, err)
+}
+
+// RevokeUserSessions ...
+func (s SQLSessionStore) RevokeUserSessions(ctx context.Context, userID, exceptID string, at time.Time) (int64, error) {
+	r, err := s.db.ExecContext(ctx, "UPDATE Sessions SET RevokedAt = ? WHERE UserId = ? AND Id <> ? AND RevokedAt = 0 AND ExpiresAt > ?",
+		timeToUnix(at), userID, exceptID, timeToUnix(at))
+	if err != nil {
+		return 0, sqlError(err)
+	}
+	return r.RowsAffected()
+}
+
+// RemoveUserSessions ...
+func (s SQLSessionStore) RemoveUserSessions(ctx context.Context, userID string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM Sessions WHERE UserId = ?", userID)
+	return sqlError(err)
+}
+
+// RemoveExpiredSessions ...
+func (s SQLSessionStore) RemoveExpiredSessions(ctx context.Context, before time.Time) (int64, error) {
+	r, err := s.db.ExecContext(ctx, "DELETE FROM Sessions WHERE ExpiresAt < ?", timeToUnix(before))
+	if err != nil {
+		return 0, sqlError(err)
+	}
+	return r.RowsAffected()
+}
@@ -1,118 +1,308 @@
 package stores
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/Kirides/simpleApi/models"
 )
 
 // SQLUserStore Store that enables Saving and Reading Users
 type SQLUserStore struct {
-	db *sql.DB
+	db sqlDB
 }
 
-// NewSQLiteUserStore Creates a new UserStore that uses Sqlite3
+// NewSQLiteUserStore Creates a new UserStore that uses Sqlite3.
+// The tables are created by the migrations, see NewSQLiteMigrator.
 func NewSQLiteUserStore(db *sql.DB) (*SQLUserStore, error) {
-	store := &SQLUserStore{db: db}
+	return NewSQLUserStore(db, SQLiteDialect)
+}
+
+// NewSQLUserStore Creates a new UserStore for the database of the dialect.
+// The tables are created by the migrations, see NewSQLMigrator.
+func NewSQLUserStore(db *sql.DB, d SQLDialect) (*SQLUserStore, error) {
+	return &SQLUserStore{db: sqlDB{db: db, d: d}}, nil
+}
+
+const sqlUserColumns = "Id, Username, Hash, Role, DisplayName, Email, Locale, CreatedAt, UpdatedAt, Version, Status, DeletedAt, OrgID, Avatar, TokenGeneration"
 
-	if err := store.initialize(); err != nil {
-		return nil, err
+type sqlRowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSQLUser(row sqlRowScanner) (models.User, error) {
+	var (
+		u                               models.User
+		createdAt, updatedAt, deletedAt int64
+	)
+	if err := row.Scan(&u.ID, &u.Name, &u.Hash, &u.Role, &u.DisplayName, &u.Email, &u.Locale, &createdAt, &updatedAt, &u.Version, &u.Status, &deletedAt, &u.OrgID, &u.Avatar, &u.TokenGeneration); err != nil {
+		return models.User{}, sqlError(err)
 	}
+	u.CreatedAt = timeFromUnix(createdAt)
+	u.UpdatedAt = timeFromUnix(updatedAt)
+	u.DeletedAt = timeFromUnix(deletedAt)
+	return u, nil
+}
 
-	return store, nil
+// GetPage Retrieves a paginated arary of Users
+func (s SQLUserStore) GetPage(ctx context.Context, offset int64, limit int64) ([]models.User, error) {
+	return s.Find(ctx, UserQuery{Offset: offset, Limit: limit})
 }
-func (s *SQLUserStore) initialize() error {
-	if err := s.createTableSQLite(); err != nil {
-		return err
+
+// sqlUserSortColumns maps the allowed UserSortFields to their columns
+var sqlUserSortColumns = map[string]string{
+	UserSortID:          "Id",
+	UserSortName:        "Username",
+	UserSortDisplayName: "DisplayName",
+	UserSortEmail:       "Email",
+	UserSortCreatedAt:   "CreatedAt",
+	UserSortUpdatedAt:   "UpdatedAt",
+}
+
+// sqlUserSortExpr returns the expression users are sorted by for the field, text is sorted ignoring case
+func sqlUserSortExpr(d SQLDialect, field string) string {
+	column, ok := sqlUserSortColumns[field]
+	if !ok {
+		return sqlUserSortColumns[UserSortID]
+	}
+	if isNumericUserSortField(field) {
+		return column
 	}
+	return d.nocase(column)
+}
 
-	// if _, err := s.db.Exec(`INSERT INTO Users (Username, Hash) VALUES ("abc", "$2a$10$WX3dM2ElqQFOTgtnOzjP9.snX3d0HbfQ1t.1uOWeSUeucz5RB8rEa")`); err != nil {
-	// 	return err
-	// }
+// escapeLike escapes the wildcards of a LIKE pattern, using '!' as the escape character.
+// Unlike '\' it is no escape character of string literals in any database.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`!`, `!!`, `%`, `!%`, `_`, `!_`).Replace(s)
+}
 
-	return nil
+// sqlUserFilter creates the WHERE clause for the filters of the query
+func sqlUserFilter(d SQLDialect, q UserQuery) (string, []interface{}) {
+	var (
+		where []string
+		args  []interface{}
+	)
+	if q.NamePrefix != "" {
+		where = append(where, d.like("Username"))
+		args = append(args, escapeLike(q.NamePrefix)+"%")
+	}
+	if q.Email != "" {
+		where = append(where, d.nocase("Email")+" = "+d.nocase("?"))
+		args = append(args, q.Email)
+	}
+	if q.Role != "" {
+		where = append(where, "Role = ?")
+		args = append(args, q.Role)
+	}
+	if q.OrgID != "" {
+		where = append(where, "OrgID = ?")
+		args = append(args, q.OrgID)
+	}
+	if len(q.Statuses) > 0 {
+		where = append(where, "Status IN (?"+strings.Repeat(",?", len(q.Statuses)-1)+")")
+		for _, status := range q.Statuses {
+			args = append(args, status)
+		}
+	}
+	if !q.CreatedFrom.IsZero() {
+		where = append(where, "CreatedAt >= ?")
+		args = append(args, q.CreatedFrom.Unix())
+	}
+	if !q.CreatedUntil.IsZero() {
+		where = append(where, "CreatedAt < ?")
+		args = append(args, q.CreatedUntil.Unix())
+	}
+	if q.Search != "" {
+		where = append(where, "("+d.like("Username")+" OR "+d.like("DisplayName")+" OR "+d.like("Email")+")")
+		search := "%" + escapeLike(q.Search) + "%"
+		args = append(args, search, search, search)
+	}
+	if q.After != nil || q.Before != nil {
+		column := sqlUserSortExpr(d, q.SortBy)
+		value := "?"
+		if !isNumericUserSortField(q.SortBy) {
+			value = d.nocase("?")
+		}
+		if q.After != nil {
+			op := ">"
+			if q.SortDesc {
+				op = "<"
+			}
+			where = append(where, "("+column+" "+op+" "+value+" OR ("+column+" = "+value+" AND Id "+op+" ?))")
+			args = append(args, sqlCursorValue(q.SortBy, q.After), sqlCursorValue(q.SortBy, q.After), q.After.ID)
+		}
+		if q.Before != nil {
+			op := "<"
+			if q.SortDesc {
+				op = ">"
+			}
+			where = append(where, "("+column+" "+op+" "+value+" OR ("+column+" = "+value+" AND Id "+op+" ?))")
+			args = append(args, sqlCursorValue(q.SortBy, q.Before), sqlCursorValue(q.SortBy, q.Before), q.Before.ID)
+		}
+	}
+	if len(where) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(where, " AND "), args
 }
 
-func (s SQLUserStore) createTableSQLite() error {
-	if _, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS Users (
-		Id INTEGER PRIMARY KEY AUTOINCREMENT,
-		Username TEXT NOT NULL,
-		Hash TEXT NOT NULL
-		)`); err != nil {
-		return err
+func sqlCursorValue(field string, c *UserCursor) interface{} {
+	if isNumericUserSortField(field) {
+		v, _ := strconv.ParseInt(c.Value, 10, 64)
+		return v
 	}
-	return nil
+	return c.Value
 }
 
-// GetPage Retrieves a paginated arary of Users
-func (s SQLUserStore) GetPage(offset int64, limit int64) ([]models.User, error) {
-	rows, err := s.db.Query("SELECT Id, Username, Hash FROM Users LIMIT ? OFFSET ?", limit, offset)
+// Find retrieves all users matching the query
+func (s SQLUserStore) Find(ctx context.Context, q UserQuery) ([]models.User, error) {
+	where, args := sqlUserFilter(s.db.d, q)
+	query := "SELECT " + sqlUserColumns + " FROM Users" + where
+
+	column := sqlUserSortExpr(s.db.d, q.SortBy)
+	// pages in front of a cursor are read backwards and reversed afterwards
+	desc := q.SortDesc != (q.Before != nil)
+	direction := " ASC"
+	if desc {
+		direction = " DESC"
+	}
+	query += " ORDER BY " + column + direction + ", Id" + direction + " LIMIT ? OFFSET ?"
+	offset := q.Offset
+	if q.After != nil || q.Before != nil {
+		offset = 0
+	}
+	args = append(args, q.Limit, offset)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("Could not retrieve Users: %v", err)
+		return nil, fmt.Errorf("Could not retrieve Users: %w", sqlError(err))
 	}
 	defer func() {
 		if err := rows.Close(); err != nil {
 			log.Printf("Error closing SQL rows. Error: %v", err)
 		}
 	}()
-	var rowData []models.User
+	rowData := []models.User{}
 	for rows.Next() {
-		var u models.User
-		if err := rows.Scan(&u.ID, &u.Name, &u.Hash); err != nil {
+		u, err := scanSQLUser(rows)
+		if err != nil {
 			return nil, err
 		}
 		rowData = append(rowData, u)
 	}
-
+	if err := rows.Err(); err != nil {
+		return nil, sqlError(err)
+	}
+	if q.Before != nil {
+		for i, j := 0, len(rowData)-1; i < j; i, j = i+1, j-1 {
+			rowData[i], rowData[j] = rowData[j], rowData[i]
+		}
+	}
 	return rowData, nil
 }
 
+// Count returns the amount of users matching the filters of the query
+func (s SQLUserStore) Count(ctx context.Context, q UserQuery) (int64, error) {
+	q.After, q.Before = nil, nil
+	where, args := sqlUserFilter(s.db.d, q)
+	var n int64
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM Users"+where, args...).Scan(&n); err != nil {
+		return 0, fmt.Errorf("Could not count Users: %w", sqlError(err))
+	}
+	return n, nil
+}
+
 // Get returns a single User by its Id
-func (s SQLUserStore) Get(id string) (models.User, error) {
-	row := s.db.QueryRow("SELECT Id, Username, Hash FROM Users WHERE Id = ?", id)
-	var u models.User
-	err := row.Scan(&u.ID, &u.Name, &u.Hash)
-	return u, err
+func (s SQLUserStore) Get(ctx context.Context, id string) (models.User, error) {
+	if !validSQLID(id) {
+		return models.User{}, ErrNotFound
+	}
+	return scanSQLUser(s.db.QueryRowContext(ctx, "SELECT "+sqlUserColumns+" FROM Users WHERE Id = ?", id))
 }
 
-// GetByName ...
-func (s SQLUserStore) GetByName(name string) (models.User, error) {
-	row := s.db.QueryRow("SELECT Id, Username, Hash FROM Users WHERE Username = ?", name)
-	var u models.User
-	err := row.Scan(&u.ID, &u.Name, &u.Hash)
-	return u, err
+// GetByName looks the user up by its normalized name
+func (s SQLUserStore) GetByName(ctx context.Context, name string) (models.User, error) {
+	return scanSQLUser(s.db.QueryRowContext(ctx, "SELECT "+sqlUserColumns+" FROM Users WHERE NormalizedUsername = ?", NormalizeUserName(name)))
 }
 
-// Insert adds a user to the store
-func (s SQLUserStore) Insert(u models.User) error {
-	_, err := s.db.Exec("INSERT INTO Users (Username, Hash) VALUES (?,?)", u.Name, string(u.Hash))
-	return err
+// Insert adds a user to the store and returns it with its assigned Id
+func (s SQLUserStore) Insert(ctx context.Context, u models.User) (models.User, error) {
+	return insertSQLUser(ctx, s.db, u)
 }
 
-// InsertAll adds all specified users to the store
-func (s SQLUserStore) InsertAll(users []models.User) error {
-	tx, err := s.db.Begin()
+func insertSQLUser(ctx context.Context, db sqlQueryer, u models.User) (models.User, error) {
+	u = withInsertDefaults(u)
+	id, err := db.insert(ctx, "INSERT INTO Users (Username, NormalizedUsername, Hash, Role, DisplayName, Email, Locale, CreatedAt, UpdatedAt, Version, Status, DeletedAt, OrgID, Avatar, TokenGeneration) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)",
+		u.Name, NormalizeUserName(u.Name), string(u.Hash), u.Role, u.DisplayName, u.Email, u.Locale, timeToUnix(u.CreatedAt), timeToUnix(u.UpdatedAt), u.Version, u.Status, timeToUnix(u.DeletedAt), u.OrgID, u.Avatar, u.TokenGeneration)
 	if err != nil {
-		return err
+		return models.User{}, sqlError(err)
 	}
+	u.ID = strconv.FormatInt(id, 10)
+	return u, nil
+}
 
+// InsertAll adds all specified users to the store in a single transaction.
+// Either all or none of the users are added.
+func (s SQLUserStore) InsertAll(ctx context.Context, users []models.User) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return sqlError(err)
+	}
 	for _, u := range users {
-		if _, err := tx.Exec("INSERT INTO Users Id VALUES (NULL)", u.ID); err != nil {
-			return err
+		if _, err := insertSQLUser(ctx, tx, u); err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				log.Printf("Could not rollback Insert. Error: %v", rbErr)
+			}
+			return fmt.Errorf("Could not insert user '%s'. Error: %w", u.Name, err)
 		}
 	}
+	return sqlError(tx.Commit())
+}
 
-	if err := tx.Commit(); err != nil {
-		log.Printf("Could not commit Insert. Error: %v", err)
-		return tx.Rollback()
+// Update updates the specified User
+func (s SQLUserStore) Update(ctx context.Context, u models.User) error {
+	if !validSQLID(u.ID) {
+		return ErrNotFound
+	}
+	r, err := s.db.ExecContext(ctx, "UPDATE Users SET Username = ?, NormalizedUsername = ?, Hash = ?, Role = ?, DisplayName = ?, Email = ?, Locale = ?, UpdatedAt = ?, Status = ?, DeletedAt = ?, OrgID = ?, Avatar = ?, TokenGeneration = ?, Version = Version + 1 WHERE Id = ? AND Version = ?",
+		u.Name, NormalizeUserName(u.Name), string(u.Hash), u.Role, u.DisplayName, u.Email, u.Locale, time.Now().Unix(), u.Status, timeToUnix(u.DeletedAt), u.OrgID, u.Avatar, u.TokenGeneration, u.ID, u.Version)
+	if err != nil {
+		return sqlError(err)
 	}
-	return nil
+	return s.checkVersionedWrite(ctx, r, u.ID)
 }
 
-// Update updates the specified User
-func (s SQLUserStore) Update(u models.User) error {
-	_, err := s.db.Exec("UPDATE Users SET xy=Z WHERE Id=?", u.ID)
-	return err
+// checkVersionedWrite tells apart missing users and version conflicts
+// for UPDATE and DELETE statements that did not affect any row
+func (s SQLUserStore) checkVersionedWrite(ctx context.Context, r sql.Result, id string) error {
+	n, err := r.RowsAffected()
+	if err != nil {
+		return sqlError(err)
+	}
+	if n > 0 {
+		return nil
+	}
+	var exists int
+	if err := s.db.QueryRowContext(ctx, "SELECT 1 FROM Users WHERE Id = ?", id).Scan(&exists); err != nil {
+		return sqlError(err)
+	}
+	return ErrVersionConflict
+}
+
+// Delete removes the specified User
+func (s SQLUserStore) Delete(ctx context.Context, id string, version int64) error {
+	if !validSQLID(id) {
+		return ErrNotFound
+	}
+	r, err := s.db.ExecContext(ctx, "DELETE FROM Users WHERE Id = ? AND Version = ?", id, version)
+	if err != nil {
+		return sqlError(err)
+	}
+	return s.checkVersionedWrite(ctx, r, id)
 }
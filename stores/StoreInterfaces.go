@@ -1,20 +1,130 @@
 package stores
 
-import "github.com/Kirides/simpleApi/models"
+import (
+	"context"
+	"io"
+	"time"
 
-// UserStore contains the logic to persist users
+	"github.com/Kirides/simpleApi/models"
+)
+
+// UserStore contains the logic to persist users.
+// Update and Delete only succeed if the stored version of the user still matches
+// and return ErrVersionConflict otherwise.
+// Usernames are unique in their normalized form (see NormalizeUserName): GetByName ignores case,
+// and Insert, InsertAll and Update atomically return ErrConflict if another user already has the name.
+// Every method stops as soon as the context is done and returns an error wrapping the context's error.
 type UserStore interface {
-	GetPage(offset int64, limit int64) ([]models.User, error)
-	Get(id string) (models.User, error)
-	GetByName(name string) (models.User, error)
-	Update(u models.User) error
-	InsertAll(users []models.User) error
-	Insert(users models.User) error
+	GetPage(ctx context.Context, offset int64, limit int64) ([]models.User, error)
+	Find(ctx context.Context, q UserQuery) ([]models.User, error)
+	Count(ctx context.Context, q UserQuery) (int64, error)
+	Get(ctx context.Context, id string) (models.User, error)
+	GetByName(ctx context.Context, name string) (models.User, error)
+	Update(ctx context.Context, u models.User) error
+	InsertAll(ctx context.Context, users []models.User) error
+	Insert(ctx context.Context, user models.User) (models.User, error)
+	Delete(ctx context.Context, id string, version int64) error
 }
 
-// TokenStore ...
+// TokenStore persists revoked tokens until their date (unix seconds).
+// Get reports tokens whose date is over like unknown ones by ErrNotFound, Remove returns ErrNotFound
+// if the token is not stored. Expired tokens are deleted by RemoveExpired.
+// Every method stops as soon as the context is done and returns an error wrapping the context's error.
 type TokenStore interface {
-	Get(id string) (models.TokenStruct, error)
-	Set(id string, date int64) error
-	Remove(id string) error
+	Get(ctx context.Context, id string) (models.TokenStruct, error)
+	Set(ctx context.Context, id string, date int64) error
+	Remove(ctx context.Context, id string) error
+	// RemoveExpired deletes all tokens whose date is not after the time, the tokens Get would no longer
+	// report at that time, and returns their amount
+	RemoveExpired(ctx context.Context, before time.Time) (int64, error)
+}
+
+// OrgStore persists organizations and their groups.
+// Inserting an organization with an existing id or a group with a name
+// that already exists in its organization returns ErrConflict.
+// Every method stops as soon as the context is done and returns an error wrapping the context's error.
+type OrgStore interface {
+	ListOrgs(ctx context.Context) ([]models.Organization, error)
+	GetOrg(ctx context.Context, id string) (models.Organization, error)
+	InsertOrg(ctx context.Context, o models.Organization) (models.Organization, error)
+	UpdateOrg(ctx context.Context, o models.Organization) error
+	DeleteOrg(ctx context.Context, id string) error
+
+	ListGroups(ctx context.Context, orgID string) ([]models.Group, error)
+	GetGroup(ctx context.Context, orgID, id string) (models.Group, error)
+	InsertGroup(ctx context.Context, g models.Group) (models.Group, error)
+	UpdateGroup(ctx context.Context, g models.Group) error
+	// DeleteGroup removes the group and all of its memberships
+	DeleteGroup(ctx context.Context, orgID, id string) error
+
+	// GroupMembers returns the ids of the users in the group
+	GroupMembers(ctx context.Context, orgID, groupID string) ([]string, error)
+	AddGroupMember(ctx context.Context, orgID, groupID, userID string) error
+	RemoveGroupMember(ctx context.Context, orgID, groupID, userID string) error
+	// UserGroups returns the groups the user is a member of
+	UserGroups(ctx context.Context, userID string) ([]models.Group, error)
+	// RemoveUserMemberships removes the user from all groups
+	RemoveUserMemberships(ctx context.Context, userID string) error
+}
+
+// InvitationStore persists invitations.
+// AcceptInvitation and RevokeInvitation return ErrConflict if the invitation
+// has already been accepted or revoked, so every invitation is used at most once.
+// Every method stops as soon as the context is done and returns an error wrapping the context's error.
+type InvitationStore interface {
+	// FindInvitations returns the invitations of the organization, or all if orgID is empty, newest first
+	FindInvitations(ctx context.Context, orgID string) ([]models.Invitation, error)
+	GetInvitation(ctx context.Context, id string) (models.Invitation, error)
+	InsertInvitation(ctx context.Context, inv models.Invitation) (models.Invitation, error)
+	AcceptInvitation(ctx context.Context, id, userID string, at time.Time) error
+	RevokeInvitation(ctx context.Context, id string, at time.Time) error
+	// RemoveUserReferences deletes the invitations accepted by the user
+	// and removes it as inviter of the others
+	RemoveUserReferences(ctx context.Context, userID string) error
+}
+
+// BlobInfo describes a stored blob
+type BlobInfo struct {
+	Size    int64
+	ModTime time.Time
+}
+
+// BlobStore persists binary objects, like profile pictures, by key.
+// Keys are relative, slash separated paths. Open and Delete return ErrNotFound for unknown keys.
+// Every method stops as soon as the context is done and returns an error wrapping the context's error,
+// the reader returned by Open is not bound to the context.
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader) error
+	Open(ctx context.Context, key string) (io.ReadCloser, BlobInfo, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// AuditStore persists audit events. It is append-only, events can never be modified or removed.
+// Every method stops as soon as the context is done and returns an error wrapping the context's error.
+type AuditStore interface {
+	// AppendAudit stores the event and returns it with its assigned ID
+	AppendAudit(ctx context.Context, e models.AuditEvent) (models.AuditEvent, error)
+	// FindAudit returns the matching events, newest first
+	FindAudit(ctx context.Context, q AuditQuery) ([]models.AuditEvent, error)
+	// LastAudit returns the newest event, or ErrNotFound if there is none
+	LastAudit(ctx context.Context) (models.AuditEvent, error)
+}
+
+// SessionStore persists the sessions of users.
+// Every method stops as soon as the context is done and returns an error wrapping the context's error.
+type SessionStore interface {
+	InsertSession(ctx context.Context, s models.Session) error
+	GetSession(ctx context.Context, id string) (models.Session, error)
+	// UserSessions returns all sessions of the user that are neither expired nor revoked at the time now, newest first
+	UserSessions(ctx context.Context, userID string, now time.Time) ([]models.Session, error)
+	// TouchSession updates the time and address the session was last used from
+	TouchSession(ctx context.Context, id string, at time.Time, ip string) error
+	// RevokeSession returns ErrNotFound if the session does not exist or is already revoked
+	RevokeSession(ctx context.Context, id string, at time.Time) error
+	// RevokeUserSessions revokes all sessions of the user except the one with exceptID and returns their amount
+	RevokeUserSessions(ctx context.Context, userID, exceptID string, at time.Time) (int64, error)
+	// RemoveUserSessions deletes all sessions of the user
+	RemoveUserSessions(ctx context.Context, userID string) error
+	// RemoveExpiredSessions deletes all sessions that expired before the time and returns their amount
+	RemoveExpiredSessions(ctx context.Context, before time.Time) (int64, error)
 }
@@ -0,0 +1,119 @@
+package stores
+
+import (
+	"context"
+
+	"github.com/Kirides/simpleApi/models"
+)
+
+// TenantUserStore restricts a UserStore to the users of a single organization.
+// Users of other organizations are reported as not found and can neither be
+// modified nor deleted. Inserted users are always assigned to the organization.
+//
+// Usernames stay unique across all organizations, as they are used to sign in,
+// so Insert and Update return ErrConflict if a user of another organization has the name.
+type TenantUserStore struct {
+	us    UserStore
+	orgID string
+}
+
+// NewTenantUserStore creates a UserStore that only contains the users of the organization
+func NewTenantUserStore(us UserStore, orgID string) *TenantUserStore {
+	return &TenantUserStore{us: us, orgID: orgID}
+}
+
+// OrgID returns the organization the store is restricted to
+func (s *TenantUserStore) OrgID() string {
+	return s.orgID
+}
+
+// GetPage ...
+func (s *TenantUserStore) GetPage(ctx context.Context, offset int64, limit int64) ([]models.User, error) {
+	return s.Find(ctx, UserQuery{Offset: offset, Limit: limit})
+}
+
+// Find ...
+func (s *TenantUserStore) Find(ctx context.Context, q UserQuery) ([]models.User, error) {
+	q.OrgID = s.orgID
+	return s.us.Find(ctx, q)
+}
+
+// Count ...
+func (s *TenantUserStore) Count(ctx context.Context, q UserQuery) (int64, error) {
+	q.OrgID = s.orgID
+	return s.us.Count(ctx, q)
+}
+
+// Get ...
+func (s *TenantUserStore) Get(ctx context.Context, id string) (models.User, error) {
+	u, err := s.us.Get(ctx, id)
+	if err != nil {
+		return models.User{}, err
+	}
+	if u.OrgID != s.orgID {
+		return models.User{}, ErrNotFound
+	}
+	return u, nil
+}
+
+// GetByName ...
+func (s *TenantUserStore) GetByName(ctx context.Context, name string) (models.User, error) {
+	u, err := s.us.GetByName(ctx, name)
+	if err != nil {
+		return models.User{}, err
+	}
+	if u.OrgID != s.orgID {
+		return models.User{}, ErrNotFound
+	}
+	return u, nil
+}
+
+// checkName returns ErrConflict if a user of another organization is named like u
+func (s *TenantUserStore) checkName(ctx context.Context, u models.User) error {
+	if existing, err := s.us.GetByName(ctx, u.Name); err == nil && existing.ID != "" && existing.ID != u.ID && existing.OrgID != s.orgID {
+		return ErrConflict
+	}
+	return nil
+}
+
+// Update ...
+func (s *TenantUserStore) Update(ctx context.Context, u models.User) error {
+	if _, err := s.Get(ctx, u.ID); err != nil {
+		return err
+	}
+	if err := s.checkName(ctx, u); err != nil {
+		return err
+	}
+	u.OrgID = s.orgID
+	return s.us.Update(ctx, u)
+}
+
+// InsertAll ...
+func (s *TenantUserStore) InsertAll(ctx context.Context, users []models.User) error {
+	scoped := make([]models.User, len(users))
+	for i, u := range users {
+		if err := s.checkName(ctx, u); err != nil {
+			return err
+		}
+		u.OrgID = s.orgID
+		scoped[i] = u
+	}
+	return s.us.InsertAll(ctx, scoped)
+}
+
+// Insert ...
+func (s *TenantUserStore) Insert(ctx context.Context, user models.User) (models.User, error) {
+	if err := s.checkName(ctx, user); err != nil {
+		return models.User{}, err
+	}
+	user.OrgID = s.orgID
+	return s.us.Insert(ctx, user)
+}
+
+// Delete ...
+func (s *TenantUserStore) Delete(ctx context.Context, id string, version int64) error {
+	if _, err := s.Get(ctx, id); err != nil {
+		return err
+	}
+	return s.us.Delete(ctx, id, version)
+}
@@ -0,0 +1,42 @@
+package stores
+
+import (
+	"time"
+
+	"github.com/Kirides/simpleApi/models"
+)
+
+// AuditQuery filters audit events, empty fields match every event
+type AuditQuery struct {
+	Action  string
+	Outcome string
+	// UserID matches events with the user as actor or target
+	UserID    string
+	OrgID     string
+	IP        string
+	RequestID string
+	// From only returns events at or after it
+	From time.Time
+	// Until only returns events before it
+	Until time.Time
+	// BeforeID only returns events with a smaller ID, it is used for paging
+	BeforeID int64
+	Limit    int64
+}
+
+// Matches reports whether the event satisfies the query, ignoring Limit
+func (q AuditQuery) Matches(e models.AuditEvent) bool {
+	switch {
+	case q.Action != "" && e.Action != q.Action,
+		q.Outcome != "" && e.Outcome != q.Outcome,
+		q.UserID != "" && e.ActorID != q.UserID && e.TargetID != q.UserID,
+		q.OrgID != "" && e.OrgID != q.OrgID,
+		q.IP != "" && e.IP != q.IP,
+		q.RequestID != "" && e.RequestID != q.RequestID,
+		!q.From.IsZero() && e.Time.Before(q.From),
+		!q.Until.IsZero() && !e.Time.Before(q.Until),
+		q.BeforeID > 0 && e.ID >= q.BeforeID:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,73 @@
+package stores_test
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Kirides/simpleApi/models"
+	"github.com/Kirides/simpleApi/stores"
+	bolt "github.com/coreos/bbolt"
+)
+
+// TestBoltStores runs the checks of TestSQLStores against the BoltDB stores
+func TestBoltStores(t *testing.T) {
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "stores.db"), 0600, &bolt.Options{Timeout: time.Second})
+	must(t, err)
+	defer db.Close()
+
+	t.Run("UserStore", func(t *testing.T) {
+		us, err := stores.NewBoltDBUserStore(db)
+		must(t, err)
+		testUserStore(t, us)
+	})
+	t.Run("TokenStore", func(t *testing.T) {
+		ts, err := stores.NewBoltDBTokenStore(db)
+		must(t, err)
+		testTokenStore(t, ts)
+	})
+	t.Run("OrgStore", func(t *testing.T) {
+		s, err := stores.NewBoltDBOrgStore(db)
+		must(t, err)
+		testOrgStore(t, s)
+	})
+	t.Run("InvitationStore", func(t *testing.T) {
+		is, err := stores.NewBoltDBInvitationStore(db)
+		must(t, err)
+		testInvitationStore(t, is)
+	})
+	t.Run("SessionStore", func(t *testing.T) {
+		ss, err := stores.NewBoltDBSessionStore(db)
+		must(t, err)
+		testSessionStore(t, ss)
+	})
+	t.Run("AuditStore", func(t *testing.T) {
+		as, err := stores.NewBoltDBAuditStore(db)
+		must(t, err)
+		testAuditStore(t, as)
+	})
+}
+
+// TestBoltUserStoreCopiesTheHash checks that users stay valid after their transaction,
+// when bolt reuses or remaps the memory of its values
+func TestBoltUserStoreCopiesTheHash(t *testing.T) {
+	ctx := context.Background()
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "users.db"), 0600, &bolt.Options{Timeout: time.Second})
+	must(t, err)
+	defer db.Close()
+	us, err := stores.NewBoltDBUserStore(db)
+	must(t, err)
+	u, err := us.Insert(ctx, models.User{Name: "alice", Hash: []byte("the-password-hash")})
+	must(t, err)
+	got, err := us.Get(ctx, u.ID)
+	must(t, err)
+	for i := 0; i < 2000; i++ {
+		_, err := us.Insert(ctx, models.User{Name: fmt.Sprintf("user%d", i), Hash: []byte("other-hash")})
+		must(t, err)
+	}
+	if string(got.Hash) != "the-password-hash" {
+		t.Fatalf("the hash changed to %q after inserting more users", got.Hash)
+	}
+}
@@ -6,10 +6,21 @@ import (
 )
 
 var (
-	sizeOfUInt64                        = 8
-	boltByteOrder      binary.ByteOrder = binary.LittleEndian
-	boltkeyUsersBucket                  = getUInt64Bytes(0)
-	boltkeyTokenBucket                  = getUInt64Bytes(1)
+	sizeOfUInt64                               = 8
+	boltByteOrder             binary.ByteOrder = binary.LittleEndian
+	boltkeyUsersBucket                         = getUInt64Bytes(0)
+	boltkeyTokenBucket                         = getUInt64Bytes(1)
+	boltkeyOrgsBucket                          = getUInt64Bytes(2)
+	boltkeyGroupsBucket                        = getUInt64Bytes(3)
+	boltkeyGroupMembersBucket                  = getUInt64Bytes(4)
+	boltkeyInvitationsBucket                   = getUInt64Bytes(5)
+	boltkeyAuditBucket                         = getUInt64Bytes(6)
+	boltkeySessionsBucket                      = getUInt64Bytes(7)
+	// boltkeyLegacyUserNamesBucket indexed the exact usernames, it is replaced by the normalized index
+	boltkeyLegacyUserNamesBucket = getUInt64Bytes(8)
+	boltkeyUserNamesBucket       = getUInt64Bytes(9)
+	// boltkeyUserIDsBucket indexes the users by id, the keys of the users bucket are not in numeric order
+	boltkeyUserIDsBucket = getUInt64Bytes(10)
 )
 
 func getUInt64Bytes(v uint64) []byte {
@@ -18,6 +29,20 @@ func getUInt64Bytes(v uint64) []byte {
 	return result
 }
 
+// getSortableUInt64Bytes encodes v so that the byte order of the results is their numeric order
+func getSortableUInt64Bytes(v uint64) []byte {
+	result := make([]byte, sizeOfUInt64)
+	binary.BigEndian.PutUint64(result, v)
+	return result
+}
+
 func getStringFromUInt64Bytes(uBytes []byte) string {
 	return strconv.FormatUint(boltByteOrder.Uint64(uBytes), 10)
 }
+
+func getInt64FromBytes(b []byte) int64 {
+	if len(b) != sizeOfUInt64 {
+		return 0
+	}
+	return int64(boltByteOrder.Uint64(b))
+}
@@ -0,0 +1,162 @@
+package stores
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	bolt "github.com/coreos/bbolt"
+)
+
+// All stores report failures by the following errors, possibly wrapped together with the cause
+// of the backend. Use errors.Is to check for them.
+
+// ErrNotFound is returned when the requested entity does not exist
+var ErrNotFound = errors.New("Not found")
+
+// ErrVersionConflict is returned when an entity was modified since it was read
+var ErrVersionConflict = errors.New("Version conflict")
+
+// ErrConflict is returned when an entity can not be stored because it collides with an existing one
+var ErrConflict = errors.New("Conflict")
+
+// ErrUnavailable is returned when the backend of a store can not be reached or is busy, retrying later may succeed
+var ErrUnavailable = errors.New("Store unavailable")
+
+// isStoreError reports whether err already is one of the errors of the package
+func isStoreError(err error) bool {
+	return errors.Is(err, ErrNotFound) || errors.Is(err, ErrVersionConflict) ||
+		errors.Is(err, ErrConflict) || errors.Is(err, ErrUnavailable)
+}
+
+// unavailable wraps err into ErrUnavailable, keeping it as cause
+func unavailable(err error) error {
+	return fmt.Errorf("%w: %w", ErrUnavailable, err)
+}
+
+// contextError returns the error of ctx wrapped into ErrUnavailable, or nil if ctx is not done yet.
+// Stores without a backend that reports the context's error check it by contextError.
+func contextError(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return unavailable(err)
+	}
+	return nil
+}
+
+// unavailableMessages are parts of error messages of drivers that indicate a temporary failure
+var unavailableMessages = []string{
+	"database is locked",
+	"database table is locked",
+	"unable to open database file",
+	"disk I/O error",
+	"connection refused",
+	"bad connection",
+	"too many connections",
+	"interrupted",
+	"Error 1205", // MySQL, lock wait timeout
+	"Error 1213", // MySQL, deadlock
+	"deadlock detected",
+	"could not serialize access",
+	"too many clients",
+	"the database system is starting up",
+	"the database system is shutting down",
+	"canceling statement due to",
+}
+
+// uniqueViolationMessages are parts of error messages of drivers caused by a UNIQUE or PRIMARY KEY constraint
+var uniqueViolationMessages = []string{
+	"UNIQUE constraint failed", // SQLite
+	"Error 1062",               // MySQL, duplicate entry
+	"duplicate key value violates unique constraint", // PostgreSQL
+}
+
+// isUniqueViolation reports whether err was caused by a UNIQUE or PRIMARY KEY constraint
+func isUniqueViolation(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	for _, m := range uniqueViolationMessages {
+		if strings.Contains(msg, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// sqlError maps errors of database/sql and its drivers onto the errors of the package.
+// Other errors, e.g. of invalid statements, are returned unchanged.
+func sqlError(err error) error {
+	switch {
+	case err == nil || isStoreError(err):
+		return err
+	case errors.Is(err, sql.ErrNoRows):
+		return ErrNotFound
+	case isUniqueViolation(err):
+		return fmt.Errorf("%w: %v", ErrConflict, err)
+	case errors.Is(err, driver.ErrBadConn), errors.Is(err, sql.ErrConnDone),
+		errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return unavailable(err)
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return unavailable(err)
+	}
+	msg := err.Error()
+	for _, m := range unavailableMessages {
+		if strings.Contains(msg, m) {
+			return unavailable(err)
+		}
+	}
+	return err
+}
+
+// boltError maps errors of BoltDB onto the errors of the package.
+// Other errors, e.g. of corrupted values, are returned unchanged.
+func boltError(err error) error {
+	switch {
+	case err == nil || isStoreError(err):
+		return err
+	case errors.Is(err, bolt.ErrDatabaseNotOpen), errors.Is(err, bolt.ErrTimeout),
+		errors.Is(err, bolt.ErrDatabaseReadOnly), errors.Is(err, bolt.ErrTxClosed),
+		errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return unavailable(err)
+	}
+	return err
+}
+
+// boltView runs fn in a read-only transaction of db and maps its error by boltError
+func boltView(db *bolt.DB, fn func(tx *bolt.Tx) error) error {
+	return boltError(db.View(fn))
+}
+
+// boltUpdate runs fn in a read-write transaction of db and maps its error by boltError
+func boltUpdate(db *bolt.DB, fn func(tx *bolt.Tx) error) error {
+	return boltError(db.Update(fn))
+}
+
+// boltViewContext is boltView, which does not start if ctx is already done
+func boltViewContext(ctx context.Context, db *bolt.DB, fn func(tx *bolt.Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return boltError(err)
+	}
+	return boltView(db, fn)
+}
+
+// boltUpdateContext is boltUpdate, which does not start if ctx is already done
+// and rolls the changes of fn back if ctx is done before they are committed
+func boltUpdateContext(ctx context.Context, db *bolt.DB, fn func(tx *bolt.Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return boltError(err)
+	}
+	return boltUpdate(db, func(tx *bolt.Tx) error {
+		if err := fn(tx); err != nil {
+			return err
+		}
+		return ctx.Err()
+	})
+}
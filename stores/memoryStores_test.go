@@ -0,0 +1,148 @@
+package stores_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Kirides/simpleApi/models"
+	"github.com/Kirides/simpleApi/stores"
+)
+
+// TestMemoryStores runs the checks of TestSQLStores against the memory stores
+func TestMemoryStores(t *testing.T) {
+	t.Run("UserStore", func(t *testing.T) { testUserStore(t, stores.NewMemoryUserStore()) })
+	t.Run("TokenStore", func(t *testing.T) { testTokenStore(t, stores.NewMemoryTokenStore()) })
+	t.Run("OrgStore", func(t *testing.T) { testOrgStore(t, stores.NewMemoryOrgStore()) })
+	t.Run("InvitationStore", func(t *testing.T) { testInvitationStore(t, stores.NewMemoryInvitationStore()) })
+	t.Run("SessionStore", func(t *testing.T) { testSessionStore(t, stores.NewMemorySessionStore()) })
+	t.Run("AuditStore", func(t *testing.T) { testAuditStore(t, stores.NewMemoryAuditStore()) })
+}
+
+// The memory stores are shared by all requests, run the following tests with -race
+
+func TestMemoryUserStoreConcurrentInsertAndUpdate(t *testing.T) {
+	ctx := context.Background()
+	us := stores.NewMemoryUserStore()
+	const workers = 16
+
+	var wg sync.WaitGroup
+	inserted := make(chan models.User, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// every name is inserted twice, once lower and once upper case
+			name := fmt.Sprintf("user%d", i/2)
+			if i%2 == 1 {
+				name = fmt.Sprintf("USER%d", i/2)
+			}
+			u, err := us.Insert(ctx, models.User{Name: name})
+			if err == nil {
+				inserted <- u
+			} else if !errors.Is(err, stores.ErrConflict) {
+				t.Errorf("Insert returned %v, expected ErrConflict", err)
+			}
+			_, _ = us.Find(ctx, stores.UserQuery{Limit: -1})
+		}(i)
+	}
+	wg.Wait()
+	close(inserted)
+	ids := map[string]bool{}
+	for u := range inserted {
+		if ids[u.ID] {
+			t.Fatalf("the id %s was assigned twice", u.ID)
+		}
+		ids[u.ID] = true
+	}
+	if n, err := us.Count(ctx, stores.UserQuery{}); err != nil || n != workers/2 || len(ids) != workers/2 {
+		t.Fatalf("stored %d users and inserted %d, expected one per name (%d). Error: %v", n, len(ids), workers/2, err)
+	}
+
+	u, err := us.GetByName(ctx, "user0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var updated sync.WaitGroup
+	succeeded := make(chan int, workers)
+	for i := 0; i < workers; i++ {
+		updated.Add(1)
+		go func(i int, u models.User) {
+			defer updated.Done()
+			u.DisplayName = fmt.Sprintf("writer %d", i)
+			err := us.Update(ctx, u)
+			if err == nil {
+				succeeded <- i
+			} else if !errors.Is(err, stores.ErrVersionConflict) {
+				t.Errorf("Update returned %v, expected ErrVersionConflict", err)
+			}
+			_, _ = us.Get(ctx, u.ID)
+		}(i, u)
+	}
+	updated.Wait()
+	close(succeeded)
+	if len(succeeded) != 1 {
+		t.Fatalf("%d updates of the same version succeeded, expected 1", len(succeeded))
+	}
+	winner := <-succeeded
+	got, err := us.Get(ctx, u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Version != u.Version+1 || got.DisplayName != fmt.Sprintf("writer %d", winner) {
+		t.Fatalf("stored %+v, expected the update of writer %d", got, winner)
+	}
+}
+
+func TestMemoryTokenStoreConcurrentAccess(t *testing.T) {
+	ctx := context.Background()
+	ts := stores.NewMemoryTokenStore()
+	now := time.Now()
+	const workers = 16
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := fmt.Sprintf("token%d", i%4)
+			for j := 0; j < 100; j++ {
+				date := now.Add(time.Hour).Unix()
+				if j%2 == 1 {
+					date = now.Add(-time.Hour).Unix()
+				}
+				if err := ts.Set(ctx, id, date); err != nil {
+					t.Error(err)
+					return
+				}
+				if _, err := ts.Get(ctx, id); err != nil && !errors.Is(err, stores.ErrNotFound) {
+					t.Error(err)
+				}
+				if err := ts.Remove(ctx, id); err != nil && !errors.Is(err, stores.ErrNotFound) {
+					t.Error(err)
+				}
+				if _, err := ts.RemoveExpired(ctx, now); err != nil {
+					t.Error(err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < 4; i++ {
+		id := fmt.Sprintf("token%d", i)
+		if _, err := ts.Get(ctx, id); err == nil {
+			if err := ts.Remove(ctx, id); err != nil {
+				t.Fatalf("could not remove the token %s that was found. Error: %v", id, err)
+			}
+		} else if !errors.Is(err, stores.ErrNotFound) {
+			t.Fatal(err)
+		}
+	}
+	if n, err := ts.RemoveExpired(ctx, now.Add(2*time.Hour)); err != nil || n != 0 {
+		t.Fatalf("RemoveExpired removed %d tokens after all were removed. Error: %v", n, err)
+	}
+}
@@ -0,0 +1,125 @@
+package migrations
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// files contains the migrations of every dialect in a directory named like the dialect.
+// Migrations are named NNNN_name.up.sql and NNNN_name.down.sql, the down migration is optional.
+//
+//go:embed sqlite mysql postgres
+var files embed.FS
+
+// Dialect describes how the migrator talks to a kind of database
+type Dialect struct {
+	// Name is the name of the directory of the migrations
+	Name string
+	// Placeholder returns the placeholder of the n-th (1-based) parameter of a statement
+	Placeholder func(n int) string
+}
+
+// SQLite is the dialect of github.com/mattn/go-sqlite3
+var SQLite = Dialect{
+	Name:        "sqlite",
+	Placeholder: func(int) string { return "?" },
+}
+
+// MySQL is the dialect of github.com/go-sql-driver/mysql, the DSN needs multiStatements=true
+var MySQL = Dialect{
+	Name:        "mysql",
+	Placeholder: func(int) string { return "?" },
+}
+
+// Postgres is the dialect of github.com/lib/pq
+var Postgres = Dialect{
+	Name:        "postgres",
+	Placeholder: func(n int) string { return "$" + strconv.Itoa(n) },
+}
+
+// Bind replaces the '?' placeholders of the query by the ones of the dialect.
+// Queries must not contain '?' in other places, e.g. in string literals.
+func (d Dialect) Bind(query string) string {
+	parts := strings.Split(query, "?")
+	var sb strings.Builder
+	for i, p := range parts {
+		if i > 0 {
+			sb.WriteString(d.Placeholder(i))
+		}
+		sb.WriteString(p)
+	}
+	return sb.String()
+}
+
+// Migration is a versioned change of the schema
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	// Down reverts Up, migrations without Down can not be reverted
+	Down string
+}
+
+// Checksum identifies the content of the up migration, so modifications after it was applied are detected
+func (m Migration) Checksum() string {
+	sum := sha256.Sum256([]byte(m.Up))
+	return hex.EncodeToString(sum[:])
+}
+
+var rxMigrationFile = regexp.MustCompile(`^([0-9]+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Load returns the migrations of the dialect ordered by their version
+func Load(d Dialect) ([]Migration, error) {
+	return load(files, d.Name)
+}
+
+func load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read migrations of '%s'. Error: %v", dir, err)
+	}
+	byVersion := map[int64]*Migration{}
+	for _, e := range entries {
+		match := rxMigrationFile.FindStringSubmatch(e.Name())
+		if e.IsDir() || match == nil {
+			return nil, fmt.Errorf("Invalid migration file '%s', expected NNNN_name.up.sql or NNNN_name.down.sql", e.Name())
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("Invalid version of migration file '%s'", e.Name())
+		}
+		b, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("Migrations '%s' and '%s' have the same version %d", m.Name, match[2], version)
+		}
+		if match[3] == "up" {
+			m.Up = string(b)
+		} else {
+			m.Down = string(b)
+		}
+	}
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if strings.TrimSpace(m.Up) == "" {
+			return nil, fmt.Errorf("Migration %d (%s) has no up migration", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
@@ -0,0 +1,379 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// lockRetryInterval is the time between two attempts to acquire the lock
+const lockRetryInterval = time.Second
+
+// Status describes a migration and whether it is applied
+type Status struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	// Modified reports that the migration was changed after it was applied
+	Modified bool
+	// Unknown reports an applied migration that is not part of this version, e.g. applied by a newer version
+	Unknown bool
+}
+
+// Migrator applies the migrations of a dialect to a database.
+// Applied migrations are recorded in the table schema_version together with their checksum,
+// the table schema_lock ensures that only one process migrates the database at a time.
+type Migrator struct {
+	db         *sql.DB
+	dialect    Dialect
+	migrations []Migration
+	// BeforeFirst is called before the first migration is applied to a database,
+	// e.g. to bring tables created before migrations existed up to date
+	BeforeFirst func(ctx context.Context, db *sql.DB) error
+	// LockTimeout is the time to wait for another process to finish migrating
+	LockTimeout time.Duration
+	// StaleLockAge is the age after which a lock is considered abandoned, e.g. by a crashed process, and broken
+	StaleLockAge time.Duration
+}
+
+// New creates a Migrator for the embedded migrations of the dialect
+func New(db *sql.DB, d Dialect) (*Migrator, error) {
+	migrations, err := Load(d)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{
+		db:           db,
+		dialect:      d,
+		migrations:   migrations,
+		LockTimeout:  time.Minute,
+		StaleLockAge: 15 * time.Minute,
+	}, nil
+}
+
+// Migrations returns all known migrations, ordered by their version
+func (m *Migrator) Migrations() []Migration {
+	return append([]Migration(nil), m.migrations...)
+}
+
+func (m *Migrator) createTables(ctx context.Context) error {
+	for _, stmt := range []string{
+		`CREATE TABLE IF NOT EXISTS schema_version (
+		version BIGINT PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		checksum CHAR(64) NOT NULL,
+		applied_at BIGINT NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS schema_lock (
+		id INTEGER PRIMARY KEY,
+		owner VARCHAR(255) NOT NULL,
+		locked_at BIGINT NOT NULL
+		)`,
+	} {
+		if _, err := m.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("Could not create migration tables. Error: %w", err)
+		}
+	}
+	return nil
+}
+
+type appliedMigration struct {
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int64]appliedMigration, error) {
+	rows, err := m.db.QueryContext(ctx, "SELECT version, name, checksum, applied_at FROM schema_version")
+	if err != nil {
+		return nil, fmt.Errorf("Could not read schema version. Error: %w", err)
+	}
+	defer rows.Close()
+	applied := map[int64]appliedMigration{}
+	for rows.Next() {
+		var (
+			version, appliedAt int64
+			a                  appliedMigration
+		)
+		if err := rows.Scan(&version, &a.name, &a.checksum, &appliedAt); err != nil {
+			return nil, err
+		}
+		a.appliedAt = time.Unix(appliedAt, 0).UTC()
+		applied[version] = a
+	}
+	return applied, rows.Err()
+}
+
+// Status returns the state of every known migration and of applied migrations that are unknown, ordered by version
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	if err := m.createTables(ctx); err != nil {
+		return nil, err
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return m.status(applied), nil
+}
+
+func (m *Migrator) status(applied map[int64]appliedMigration) []Status {
+	result := make([]Status, 0, len(m.migrations))
+	known := map[int64]bool{}
+	for _, mig := range m.migrations {
+		known[mig.Version] = true
+		s := Status{Version: mig.Version, Name: mig.Name}
+		if a, ok := applied[mig.Version]; ok {
+			s.Applied = true
+			s.AppliedAt = a.appliedAt
+			s.Modified = a.checksum != mig.Checksum()
+		}
+		result = append(result, s)
+	}
+	for version, a := range applied {
+		if !known[version] {
+			result = append(result, Status{Version: version, Name: a.name, Applied: true, AppliedAt: a.appliedAt, Unknown: true})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Version < result[j].Version })
+	return result
+}
+
+// verify returns an error if applied migrations were modified or are unknown,
+// in both cases the schema is not the one this version expects
+func verify(status []Status) error {
+	for _, s := range status {
+		switch {
+		case s.Modified:
+			return fmt.Errorf("Migration %d (%s) was modified after it was applied", s.Version, s.Name)
+		case s.Unknown:
+			return fmt.Errorf("Migration %d (%s) is unknown, the database was migrated by a newer version", s.Version, s.Name)
+		}
+	}
+	return nil
+}
+
+// Pending returns the amount of migrations that are not applied yet.
+// It fails if applied migrations were modified or are unknown.
+func (m *Migrator) Pending(ctx context.Context) (int, error) {
+	status, err := m.Status(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if err := verify(status); err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, s := range status {
+		if !s.Applied {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Up applies all pending migrations in order and returns their amount.
+// Every migration is applied in its own transaction, MySQL commits schema changes immediately though.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	if err := m.createTables(ctx); err != nil {
+		return 0, err
+	}
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if err := verify(m.status(applied)); err != nil {
+		return 0, err
+	}
+	if len(applied) == 0 && m.BeforeFirst != nil {
+		if err := m.BeforeFirst(ctx, m.db); err != nil {
+			return 0, fmt.Errorf("Could not prepare database for migrations. Error: %w", err)
+		}
+	}
+	n := 0
+	for _, mig := range m.migrations {
+		if _, ok := applied[mig.Version]; ok {
+			continue
+		}
+		if err := m.apply(ctx, mig.Up, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, m.dialect.Bind("INSERT INTO schema_version (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)"),
+				mig.Version, mig.Name, mig.Checksum(), time.Now().Unix())
+			return err
+		}); err != nil {
+			return n, fmt.Errorf("Could not apply migration %d (%s). Error: %w", mig.Version, mig.Name, err)
+		}
+		log.Printf("applied migration %d (%s)", mig.Version, mig.Name)
+		n++
+	}
+	return n, nil
+}
+
+// Down reverts the latest steps applied migrations in reverse order and returns their amount
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	if err := m.createTables(ctx); err != nil {
+		return 0, err
+	}
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return 0, err
+	}
+	status := m.status(applied)
+	if err := verify(status); err != nil {
+		return 0, err
+	}
+	n := 0
+	for i := len(m.migrations) - 1; i >= 0 && n < steps; i-- {
+		mig := m.migrations[i]
+		if _, ok := applied[mig.Version]; !ok {
+			continue
+		}
+		if mig.Down == "" {
+			return n, fmt.Errorf("Migration %d (%s) can not be reverted", mig.Version, mig.Name)
+		}
+		if err := m.apply(ctx, mig.Down, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, m.dialect.Bind("DELETE FROM schema_version WHERE version = ?"), mig.Version)
+			return err
+		}); err != nil {
+			return n, fmt.Errorf("Could not revert migration %d (%s). Error: %w", mig.Version, mig.Name, err)
+		}
+		log.Printf("reverted migration %d (%s)", mig.Version, mig.Name)
+		n++
+	}
+	return n, nil
+}
+
+// apply runs the script and record in a single transaction
+func (m *Migrator) apply(ctx context.Context, script string, record func(tx *sql.Tx) error) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := record(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// lock acquires the migration lock of the database and returns the function releasing it.
+// It waits up to LockTimeout for other processes and breaks locks older than StaleLockAge.
+func (m *Migrator) lock(ctx context.Context) (func(), error) {
+	owner := lockOwner()
+	deadline := time.Now().Add(m.LockTimeout)
+	for {
+		_, err := m.db.ExecContext(ctx, m.dialect.Bind("INSERT INTO schema_lock (id, owner, locked_at) VALUES (1, ?, ?)"), owner, time.Now().Unix())
+		if err == nil {
+			stopRefresh := m.refreshLock(owner)
+			return func() {
+				stopRefresh()
+				if _, err := m.db.Exec(m.dialect.Bind("DELETE FROM schema_lock WHERE id = 1 AND owner = ?"), owner); err != nil {
+					log.Printf("Could not release migration lock. Error: %v", err)
+				}
+			}, nil
+		}
+		var (
+			holder   string
+			lockedAt int64
+		)
+		switch qerr := m.db.QueryRowContext(ctx, m.dialect.Bind("SELECT owner, locked_at FROM schema_lock WHERE id = 1")).Scan(&holder, &lockedAt); {
+		case errors.Is(qerr, sql.ErrNoRows):
+			// released in the meantime, unless inserting failed for another reason
+			if time.Now().After(deadline) {
+				return nil, fmt.Errorf("Could not acquire migration lock. Error: %w", err)
+			}
+			if err := waitForLock(ctx); err != nil {
+				return nil, err
+			}
+			continue
+		case qerr != nil:
+			return nil, fmt.Errorf("Could not acquire migration lock. Error: %w", err)
+		}
+		since := time.Unix(lockedAt, 0)
+		if m.StaleLockAge > 0 && time.Since(since) > m.StaleLockAge {
+			log.Printf("Breaking migration lock of '%s', which is held since %s", holder, since.UTC().Format(time.RFC3339))
+			if _, err := m.db.ExecContext(ctx, m.dialect.Bind("DELETE FROM schema_lock WHERE id = 1 AND owner = ? AND locked_at = ?"), holder, lockedAt); err != nil {
+				return nil, fmt.Errorf("Could not break migration lock. Error: %w", err)
+			}
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("Migrations are locked by '%s' since %s", holder, since.UTC().Format(time.RFC3339))
+		}
+		if err := waitForLock(ctx); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// refreshLock updates locked_at of the lock held by owner until the returned function is called,
+// so other processes do not break the lock of a migration that runs longer than StaleLockAge
+func (m *Migrator) refreshLock(owner string) func() {
+	if m.StaleLockAge <= 0 {
+		return func() {}
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		t := time.NewTicker(m.StaleLockAge / 3)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+			}
+			r, err := m.db.Exec(m.dialect.Bind("UPDATE schema_lock SET locked_at = ? WHERE id = 1 AND owner = ?"), time.Now().Unix(), owner)
+			if err != nil {
+				log.Printf("Could not refresh migration lock. Error: %v", err)
+				continue
+			}
+			if n, err := r.RowsAffected(); err == nil && n == 0 {
+				log.Printf("Migration lock of '%s' was broken by another process", owner)
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// waitForLock waits lockRetryInterval before the next attempt to acquire the lock, or until ctx is done
+func waitForLock(ctx context.Context) error {
+	t := time.NewTimer(lockRetryInterval)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// lockOwner identifies the process holding the lock
+func lockOwner() string {
+	host, _ := os.Hostname()
+	return host + ":" + strconv.Itoa(os.Getpid()) + ":" + strconv.FormatInt(time.Now().UnixNano(), 36)
+}
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS Tokens;
+DROP TABLE IF EXISTS Users;
@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS Users (
+	Id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+	Username VARCHAR(255) NOT NULL,
+	Hash VARCHAR(255) COLLATE utf8mb4_bin NOT NULL,
+	Role VARCHAR(64) NOT NULL DEFAULT 'user',
+	DisplayName VARCHAR(255) NOT NULL DEFAULT '',
+	Email VARCHAR(255) NOT NULL DEFAULT '',
+	Locale VARCHAR(64) NOT NULL DEFAULT '',
+	CreatedAt BIGINT NOT NULL DEFAULT 0,
+	UpdatedAt BIGINT NOT NULL DEFAULT 0,
+	Version BIGINT NOT NULL DEFAULT 1,
+	Status VARCHAR(32) NOT NULL DEFAULT 'active',
+	DeletedAt BIGINT NOT NULL DEFAULT 0,
+	OrgID VARCHAR(255) NOT NULL DEFAULT 'default',
+	Avatar VARCHAR(255) NOT NULL DEFAULT '',
+	TokenGeneration BIGINT NOT NULL DEFAULT 0,
+	-- compared binary, the normalization already ignores case
+	NormalizedUsername VARCHAR(255) COLLATE utf8mb4_bin NULL,
+	UNIQUE KEY UX_Users_NormalizedUsername (NormalizedUsername)
+) DEFAULT CHARSET = utf8mb4 COLLATE = utf8mb4_unicode_ci;
+
+CREATE TABLE IF NOT EXISTS Tokens (
+	Id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+	TokenId VARCHAR(255) COLLATE utf8mb4_bin NOT NULL,
+	Date BIGINT NOT NULL
+) DEFAULT CHARSET = utf8mb4 COLLATE = utf8mb4_unicode_ci;
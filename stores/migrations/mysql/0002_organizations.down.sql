@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS GroupMembers;
+DROP TABLE IF EXISTS `Groups`;
+DROP TABLE IF EXISTS Organizations;
@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS Organizations (
+	Id VARCHAR(255) NOT NULL PRIMARY KEY,
+	Name VARCHAR(255) NOT NULL,
+	CreatedAt BIGINT NOT NULL DEFAULT 0
+) DEFAULT CHARSET = utf8mb4 COLLATE = utf8mb4_unicode_ci;
+
+-- GROUPS is a reserved word of MySQL
+CREATE TABLE IF NOT EXISTS `Groups` (
+	Id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+	OrgID VARCHAR(255) NOT NULL,
+	Name VARCHAR(255) NOT NULL,
+	Description VARCHAR(1024) NOT NULL DEFAULT '',
+	CreatedAt BIGINT NOT NULL DEFAULT 0,
+	UNIQUE KEY UX_Groups_OrgID_Name (OrgID, Name)
+) DEFAULT CHARSET = utf8mb4 COLLATE = utf8mb4_unicode_ci;
+
+CREATE TABLE IF NOT EXISTS GroupMembers (
+	GroupId BIGINT NOT NULL,
+	UserId VARCHAR(64) NOT NULL,
+	PRIMARY KEY (GroupId, UserId),
+	KEY IX_GroupMembers_UserId (UserId)
+) DEFAULT CHARSET = utf8mb4 COLLATE = utf8mb4_unicode_ci;
+
+INSERT IGNORE INTO Organizations (Id, Name, CreatedAt) VALUES ('default', 'Default', UNIX_TIMESTAMP());
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS Invitations (
+	Id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+	Email VARCHAR(255) NOT NULL,
+	Role VARCHAR(64) NOT NULL,
+	OrgID VARCHAR(255) NOT NULL,
+	InvitedBy VARCHAR(64) NOT NULL DEFAULT '',
+	CreatedAt BIGINT NOT NULL DEFAULT 0,
+	ExpiresAt BIGINT NOT NULL DEFAULT 0,
+	AcceptedAt BIGINT NOT NULL DEFAULT 0,
+	RevokedAt BIGINT NOT NULL DEFAULT 0,
+	UserId VARCHAR(64) NOT NULL DEFAULT ''
+) DEFAULT CHARSET = utf8mb4 COLLATE = utf8mb4_unicode_ci;
@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS AuditEvents (
+	Id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+	Time BIGINT NOT NULL,
+	Action VARCHAR(64) NOT NULL,
+	Outcome VARCHAR(32) NOT NULL,
+	ActorId VARCHAR(64) NOT NULL DEFAULT '',
+	ActorName VARCHAR(255) NOT NULL DEFAULT '',
+	TargetId VARCHAR(64) NOT NULL DEFAULT '',
+	OrgID VARCHAR(255) NOT NULL DEFAULT '',
+	IP VARCHAR(64) NOT NULL DEFAULT '',
+	UserAgent TEXT NOT NULL,
+	RequestId VARCHAR(64) NOT NULL DEFAULT '',
+	Details TEXT NOT NULL,
+	PrevHash VARCHAR(64) COLLATE utf8mb4_bin NOT NULL DEFAULT '',
+	Hash VARCHAR(64) COLLATE utf8mb4_bin NOT NULL DEFAULT '',
+	KEY IX_AuditEvents_ActorId (ActorId),
+	KEY IX_AuditEvents_TargetId (TargetId)
+) DEFAULT CHARSET = utf8mb4 COLLATE = utf8mb4_unicode_ci;
+
+-- audit events are append-only
+CREATE TRIGGER AuditEvents_NoUpdate BEFORE UPDATE ON AuditEvents FOR EACH ROW
+BEGIN
+	SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit events are append-only';
+END;
+
+CREATE TRIGGER AuditEvents_NoDelete BEFORE DELETE ON AuditEvents FOR EACH ROW
+BEGIN
+	SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit events are append-only';
+END;
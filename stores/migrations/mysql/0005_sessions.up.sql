@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS Sessions (
+	Id VARCHAR(255) COLLATE utf8mb4_bin NOT NULL PRIMARY KEY,
+	UserId VARCHAR(64) NOT NULL,
+	Device VARCHAR(255) NOT NULL DEFAULT '',
+	IP VARCHAR(64) NOT NULL DEFAULT '',
+	UserAgent TEXT NOT NULL,
+	CreatedAt BIGINT NOT NULL DEFAULT 0,
+	LastSeenAt BIGINT NOT NULL DEFAULT 0,
+	ExpiresAt BIGINT NOT NULL DEFAULT 0,
+	RevokedAt BIGINT NOT NULL DEFAULT 0,
+	KEY IX_Sessions_UserId (UserId)
+) DEFAULT CHARSET = utf8mb4 COLLATE = utf8mb4_unicode_ci;
@@ -0,0 +1 @@
+ALTER TABLE Tokens DROP INDEX UX_Tokens_TokenId;
@@ -0,0 +1,5 @@
+-- keep only the latest date of tokens stored more than once by concurrent revocations
+DELETE t FROM Tokens t JOIN Tokens n
+ON n.TokenId = t.TokenId AND (n.Date > t.Date OR (n.Date = t.Date AND n.Id > t.Id));
+
+ALTER TABLE Tokens ADD UNIQUE KEY UX_Tokens_TokenId (TokenId);
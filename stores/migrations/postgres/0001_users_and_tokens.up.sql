@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS Users (
+	Id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	Username TEXT NOT NULL,
+	Hash TEXT NOT NULL,
+	Role TEXT NOT NULL DEFAULT 'user',
+	DisplayName TEXT NOT NULL DEFAULT '',
+	Email TEXT NOT NULL DEFAULT '',
+	Locale TEXT NOT NULL DEFAULT '',
+	CreatedAt BIGINT NOT NULL DEFAULT 0,
+	UpdatedAt BIGINT NOT NULL DEFAULT 0,
+	Version BIGINT NOT NULL DEFAULT 1,
+	Status TEXT NOT NULL DEFAULT 'active',
+	DeletedAt BIGINT NOT NULL DEFAULT 0,
+	OrgID TEXT NOT NULL DEFAULT 'default',
+	Avatar TEXT NOT NULL DEFAULT '',
+	TokenGeneration BIGINT NOT NULL DEFAULT 0,
+	NormalizedUsername TEXT
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS UX_Users_NormalizedUsername ON Users (NormalizedUsername);
+
+CREATE TABLE IF NOT EXISTS Tokens (
+	Id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	TokenId TEXT NOT NULL,
+	Date BIGINT NOT NULL
+);
@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS Organizations (
+	Id TEXT PRIMARY KEY,
+	Name TEXT NOT NULL,
+	CreatedAt BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS Groups (
+	Id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	OrgID TEXT NOT NULL,
+	Name TEXT NOT NULL,
+	Description TEXT NOT NULL DEFAULT '',
+	CreatedAt BIGINT NOT NULL DEFAULT 0
+);
+
+-- names of groups are unique regardless of case
+CREATE UNIQUE INDEX IF NOT EXISTS UX_Groups_OrgID_Name ON Groups (OrgID, LOWER(Name));
+
+CREATE TABLE IF NOT EXISTS GroupMembers (
+	GroupId BIGINT NOT NULL,
+	UserId TEXT NOT NULL,
+	PRIMARY KEY (GroupId, UserId)
+);
+
+CREATE INDEX IF NOT EXISTS IX_GroupMembers_UserId ON GroupMembers (UserId);
+
+INSERT INTO Organizations (Id, Name, CreatedAt) VALUES ('default', 'Default', CAST(EXTRACT(EPOCH FROM NOW()) AS BIGINT))
+ON CONFLICT DO NOTHING;
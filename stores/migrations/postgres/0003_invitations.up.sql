@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS Invitations (
+	Id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	Email TEXT NOT NULL,
+	Role TEXT NOT NULL,
+	OrgID TEXT NOT NULL,
+	InvitedBy TEXT NOT NULL DEFAULT '',
+	CreatedAt BIGINT NOT NULL DEFAULT 0,
+	ExpiresAt BIGINT NOT NULL DEFAULT 0,
+	AcceptedAt BIGINT NOT NULL DEFAULT 0,
+	RevokedAt BIGINT NOT NULL DEFAULT 0,
+	UserId TEXT NOT NULL DEFAULT ''
+);
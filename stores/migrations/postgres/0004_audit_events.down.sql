@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS AuditEvents;
+DROP FUNCTION IF EXISTS AuditEvents_AppendOnly();
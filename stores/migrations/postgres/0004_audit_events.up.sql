@@ -0,0 +1,32 @@
+CREATE TABLE IF NOT EXISTS AuditEvents (
+	Id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	Time BIGINT NOT NULL,
+	Action TEXT NOT NULL,
+	Outcome TEXT NOT NULL,
+	ActorId TEXT NOT NULL DEFAULT '',
+	ActorName TEXT NOT NULL DEFAULT '',
+	TargetId TEXT NOT NULL DEFAULT '',
+	OrgID TEXT NOT NULL DEFAULT '',
+	IP TEXT NOT NULL DEFAULT '',
+	UserAgent TEXT NOT NULL DEFAULT '',
+	RequestId TEXT NOT NULL DEFAULT '',
+	Details TEXT NOT NULL DEFAULT '',
+	PrevHash TEXT NOT NULL DEFAULT '',
+	Hash TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS IX_AuditEvents_ActorId ON AuditEvents (ActorId);
+CREATE INDEX IF NOT EXISTS IX_AuditEvents_TargetId ON AuditEvents (TargetId);
+
+-- audit events are append-only
+CREATE OR REPLACE FUNCTION AuditEvents_AppendOnly() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit events are append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER AuditEvents_NoUpdate BEFORE UPDATE ON AuditEvents
+FOR EACH ROW EXECUTE FUNCTION AuditEvents_AppendOnly();
+
+CREATE TRIGGER AuditEvents_NoDelete BEFORE DELETE ON AuditEvents
+FOR EACH ROW EXECUTE FUNCTION AuditEvents_AppendOnly();
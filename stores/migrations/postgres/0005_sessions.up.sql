@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS Sessions (
+	Id TEXT PRIMARY KEY,
+	UserId TEXT NOT NULL,
+	Device TEXT NOT NULL DEFAULT '',
+	IP TEXT NOT NULL DEFAULT '',
+	UserAgent TEXT NOT NULL DEFAULT '',
+	CreatedAt BIGINT NOT NULL DEFAULT 0,
+	LastSeenAt BIGINT NOT NULL DEFAULT 0,
+	ExpiresAt BIGINT NOT NULL DEFAULT 0,
+	RevokedAt BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS IX_Sessions_UserId ON Sessions (UserId);
@@ -0,0 +1,5 @@
+-- keep only the latest date of tokens stored more than once by concurrent revocations
+DELETE FROM Tokens t USING Tokens n
+WHERE n.TokenId = t.TokenId AND (n.Date > t.Date OR (n.Date = t.Date AND n.Id > t.Id));
+
+CREATE UNIQUE INDEX IF NOT EXISTS UX_Tokens_TokenId ON Tokens (TokenId);
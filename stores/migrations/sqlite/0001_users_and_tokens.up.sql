@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS Users (
+	Id INTEGER PRIMARY KEY AUTOINCREMENT,
+	Username TEXT NOT NULL,
+	Hash TEXT NOT NULL,
+	Role TEXT NOT NULL DEFAULT 'user',
+	DisplayName TEXT NOT NULL DEFAULT '',
+	Email TEXT NOT NULL DEFAULT '',
+	Locale TEXT NOT NULL DEFAULT '',
+	CreatedAt INTEGER NOT NULL DEFAULT 0,
+	UpdatedAt INTEGER NOT NULL DEFAULT 0,
+	Version INTEGER NOT NULL DEFAULT 1,
+	Status TEXT NOT NULL DEFAULT 'active',
+	DeletedAt INTEGER NOT NULL DEFAULT 0,
+	OrgID TEXT NOT NULL DEFAULT 'default',
+	Avatar TEXT NOT NULL DEFAULT '',
+	TokenGeneration INTEGER NOT NULL DEFAULT 0,
+	NormalizedUsername TEXT
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS UX_Users_NormalizedUsername ON Users (NormalizedUsername);
+
+CREATE TABLE IF NOT EXISTS Tokens (
+	Id INTEGER PRIMARY KEY AUTOINCREMENT,
+	TokenId TEXT NOT NULL,
+	Date INTEGER NOT NULL
+);
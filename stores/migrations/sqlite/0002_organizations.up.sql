@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS Organizations (
+	Id TEXT PRIMARY KEY,
+	Name TEXT NOT NULL,
+	CreatedAt INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS Groups (
+	Id INTEGER PRIMARY KEY AUTOINCREMENT,
+	OrgID TEXT NOT NULL,
+	Name TEXT NOT NULL COLLATE NOCASE,
+	Description TEXT NOT NULL DEFAULT '',
+	CreatedAt INTEGER NOT NULL DEFAULT 0,
+	UNIQUE (OrgID, Name)
+);
+
+CREATE TABLE IF NOT EXISTS GroupMembers (
+	GroupId INTEGER NOT NULL,
+	UserId TEXT NOT NULL,
+	PRIMARY KEY (GroupId, UserId)
+);
+
+CREATE INDEX IF NOT EXISTS IX_GroupMembers_UserId ON GroupMembers (UserId);
+
+INSERT OR IGNORE INTO Organizations (Id, Name, CreatedAt) VALUES ('default', 'Default', CAST(strftime('%s', 'now') AS INTEGER));
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS Invitations (
+	Id INTEGER PRIMARY KEY AUTOINCREMENT,
+	Email TEXT NOT NULL,
+	Role TEXT NOT NULL,
+	OrgID TEXT NOT NULL,
+	InvitedBy TEXT NOT NULL DEFAULT '',
+	CreatedAt INTEGER NOT NULL DEFAULT 0,
+	ExpiresAt INTEGER NOT NULL DEFAULT 0,
+	AcceptedAt INTEGER NOT NULL DEFAULT 0,
+	RevokedAt INTEGER NOT NULL DEFAULT 0,
+	UserId TEXT NOT NULL DEFAULT ''
+);
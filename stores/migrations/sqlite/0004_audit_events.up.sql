@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS AuditEvents (
+	Id INTEGER PRIMARY KEY AUTOINCREMENT,
+	Time INTEGER NOT NULL,
+	Action TEXT NOT NULL,
+	Outcome TEXT NOT NULL,
+	ActorId TEXT NOT NULL DEFAULT '',
+	ActorName TEXT NOT NULL DEFAULT '',
+	TargetId TEXT NOT NULL DEFAULT '',
+	OrgID TEXT NOT NULL DEFAULT '',
+	IP TEXT NOT NULL DEFAULT '',
+	UserAgent TEXT NOT NULL DEFAULT '',
+	RequestId TEXT NOT NULL DEFAULT '',
+	Details TEXT NOT NULL DEFAULT '',
+	PrevHash TEXT NOT NULL DEFAULT '',
+	Hash TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS IX_AuditEvents_ActorId ON AuditEvents (ActorId);
+CREATE INDEX IF NOT EXISTS IX_AuditEvents_TargetId ON AuditEvents (TargetId);
+
+-- audit events are append-only
+CREATE TRIGGER IF NOT EXISTS AuditEvents_NoUpdate BEFORE UPDATE ON AuditEvents
+BEGIN SELECT RAISE(ABORT, 'audit events are append-only'); END;
+
+CREATE TRIGGER IF NOT EXISTS AuditEvents_NoDelete BEFORE DELETE ON AuditEvents
+BEGIN SELECT RAISE(ABORT, 'audit events are append-only'); END;
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS Sessions (
+	Id TEXT PRIMARY KEY,
+	UserId TEXT NOT NULL,
+	Device TEXT NOT NULL DEFAULT '',
+	IP TEXT NOT NULL DEFAULT '',
+	UserAgent TEXT NOT NULL DEFAULT '',
+	CreatedAt INTEGER NOT NULL DEFAULT 0,
+	LastSeenAt INTEGER NOT NULL DEFAULT 0,
+	ExpiresAt INTEGER NOT NULL DEFAULT 0,
+	RevokedAt INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS IX_Sessions_UserId ON Sessions (UserId);
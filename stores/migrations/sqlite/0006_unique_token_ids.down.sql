@@ -0,0 +1 @@
+DROP INDEX IF EXISTS UX_Tokens_TokenId;
@@ -0,0 +1,7 @@
+-- keep only the latest date of tokens stored more than once by concurrent revocations
+DELETE FROM Tokens WHERE EXISTS (
+	SELECT 1 FROM Tokens n
+	WHERE n.TokenId = Tokens.TokenId AND (n.Date > Tokens.Date OR (n.Date = Tokens.Date AND n.Id > Tokens.Id))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS UX_Tokens_TokenId ON Tokens (TokenId);
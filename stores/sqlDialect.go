@@ -0,0 +1,234 @@
+package stores
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Kirides/simpleApi/stores/migrations"
+	"github.com/go-sql-driver/mysql"
+)
+
+// SQLDialect describes a kind of database the SQL stores support.
+// The stores write their statements for SQLite with '?' placeholders, the dialect rewrites the parts that differ.
+type SQLDialect struct {
+	// Name selects the dialect, see SQLDialectByName
+	Name string
+	// Driver is the name of the database/sql driver, it has to be imported by the program
+	Driver string
+	// Migrations creates the tables of the stores
+	Migrations migrations.Dialect
+	// nocase makes comparing and ordering by the expression ignore case
+	nocase func(expr string) string
+	// like matches the column against a LIKE pattern with '!' as escape character, ignoring case
+	like func(column string) string
+	// insertIgnore turns an INSERT statement into one that skips rows that already exist
+	insertIgnore func(stmt string) string
+	// upsert turns an INSERT statement into one that overwrites the columns of the row
+	// whose unique key already exists
+	upsert func(stmt, key string, columns ...string) string
+	// ident quotes table names that are reserved words of the database
+	ident func(name string) string
+	// returningID makes INSERT statements return the generated Id, the driver does not support LastInsertId
+	returningID bool
+	// prepareDSN sets the options of the connection the stores rely on
+	prepareDSN func(dsn string) (string, error)
+}
+
+// SQLiteDialect talks to SQLite using github.com/mattn/go-sqlite3
+var SQLiteDialect = SQLDialect{
+	Name:         "sqlite",
+	Driver:       "sqlite3",
+	Migrations:   migrations.SQLite,
+	nocase:       func(expr string) string { return expr + " COLLATE NOCASE" },
+	like:         func(column string) string { return column + " LIKE ? ESCAPE '!'" },
+	insertIgnore: func(stmt string) string { return strings.Replace(stmt, "INSERT", "INSERT OR IGNORE", 1) },
+	upsert:       onConflictUpdate,
+	ident:        func(name string) string { return name },
+}
+
+// MySQLDialect talks to MySQL 8 using github.com/go-sql-driver/mysql.
+// Text columns use a case-insensitive collation, so comparisons ignore case without rewriting them.
+var MySQLDialect = SQLDialect{
+	Name:         "mysql",
+	Driver:       "mysql",
+	Migrations:   migrations.MySQL,
+	nocase:       func(expr string) string { return expr },
+	like:         func(column string) string { return column + " LIKE ? ESCAPE '!'" },
+	insertIgnore: func(stmt string) string { return strings.Replace(stmt, "INSERT", "INSERT IGNORE", 1) },
+	upsert: func(stmt, key string, columns ...string) string {
+		set := make([]string, len(columns))
+		for i, c := range columns {
+			set[i] = c + " = VALUES(" + c + ")"
+		}
+		return stmt + " ON DUPLICATE KEY UPDATE " + strings.Join(set, ", ")
+	},
+	ident: func(name string) string { return "`" + name + "`" },
+	prepareDSN: func(dsn string) (string, error) {
+		cfg, err := mysql.ParseDSN(dsn)
+		if err != nil {
+			return "", err
+		}
+		// migrations consist of multiple statements
+		cfg.MultiStatements = true
+		return cfg.FormatDSN(), nil
+	},
+}
+
+// PostgresDialect talks to PostgreSQL using github.com/lib/pq
+var PostgresDialect = SQLDialect{
+	Name:         "postgres",
+	Driver:       "postgres",
+	Migrations:   migrations.Postgres,
+	nocase:       func(expr string) string { return "LOWER(" + expr + ")" },
+	like:         func(column string) string { return column + " ILIKE ? ESCAPE '!'" },
+	insertIgnore: func(stmt string) string { return stmt + " ON CONFLICT DO NOTHING" },
+	upsert:       onConflictUpdate,
+	ident:        func(name string) string { return name },
+	returningID:  true,
+}
+
+// onConflictUpdate is the upsert of SQLite and PostgreSQL
+func onConflictUpdate(stmt, key string, columns ...string) string {
+	set := make([]string, len(columns))
+	for i, c := range columns {
+		set[i] = c + " = excluded." + c
+	}
+	return stmt + " ON CONFLICT (" + key + ") DO UPDATE SET " + strings.Join(set, ", ")
+}
+
+// SQLDialectByName returns the dialect named sqlite, mysql or postgres
+func SQLDialectByName(name string) (SQLDialect, error) {
+	for _, d := range []SQLDialect{SQLiteDialect, MySQLDialect, PostgresDialect} {
+		if d.Name == name {
+			return d, nil
+		}
+	}
+	return SQLDialect{}, fmt.Errorf("Unknown database '%s', expected 'sqlite', 'mysql' or 'postgres'", name)
+}
+
+// Open connects to the database of the DSN using the driver of the dialect
+func (d SQLDialect) Open(dsn string) (*sql.DB, error) {
+	if d.prepareDSN != nil {
+		var err error
+		if dsn, err = d.prepareDSN(dsn); err != nil {
+			return nil, fmt.Errorf("Invalid DSN. Error: %v", err)
+		}
+	}
+	return sql.Open(d.Driver, dsn)
+}
+
+// NewSQLMigrator creates the Migrator that creates and updates the tables of the SQL stores
+func NewSQLMigrator(db *sql.DB, d SQLDialect) (*migrations.Migrator, error) {
+	m, err := migrations.New(db, d.Migrations)
+	if err != nil {
+		return nil, err
+	}
+	if d.Name == SQLiteDialect.Name {
+		m.BeforeFirst = adoptSQLiteSchema
+	}
+	return m, nil
+}
+
+// validSQLID reports whether id can be the Id of a row. Databases reject comparing
+// their integer ids with other values instead of not finding a row.
+func validSQLID(id string) bool {
+	_, err := strconv.ParseInt(id, 10, 64)
+	return err == nil
+}
+
+// sqlQueryer is implemented by sqlDB and sqlTx
+type sqlQueryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	insert(ctx context.Context, query string, args ...interface{}) (int64, error)
+}
+
+// sqlDB rewrites the statements of the stores for the dialect of the database
+type sqlDB struct {
+	db *sql.DB
+	d  SQLDialect
+}
+
+func (db sqlDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return db.db.Query(db.d.Migrations.Bind(query), args...)
+}
+
+func (db sqlDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return db.db.QueryContext(ctx, db.d.Migrations.Bind(query), args...)
+}
+
+func (db sqlDB) QueryRow(query string, args ...interface{}) *sql.Row {
+	return db.db.QueryRow(db.d.Migrations.Bind(query), args...)
+}
+
+func (db sqlDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return db.db.QueryRowContext(ctx, db.d.Migrations.Bind(query), args...)
+}
+
+func (db sqlDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return db.db.Exec(db.d.Migrations.Bind(query), args...)
+}
+
+func (db sqlDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return db.db.ExecContext(ctx, db.d.Migrations.Bind(query), args...)
+}
+
+func (db sqlDB) insert(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	return sqlInsert(ctx, db, db.d, query, args...)
+}
+
+func (db sqlDB) Begin() (sqlTx, error) {
+	return db.BeginTx(context.Background(), nil)
+}
+
+func (db sqlDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (sqlTx, error) {
+	tx, err := db.db.BeginTx(ctx, opts)
+	return sqlTx{tx: tx, d: db.d}, err
+}
+
+// sqlTx rewrites the statements of a transaction for the dialect of the database
+type sqlTx struct {
+	tx *sql.Tx
+	d  SQLDialect
+}
+
+func (tx sqlTx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return tx.tx.Exec(tx.d.Migrations.Bind(query), args...)
+}
+
+func (tx sqlTx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return tx.tx.ExecContext(ctx, tx.d.Migrations.Bind(query), args...)
+}
+
+func (tx sqlTx) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return tx.tx.QueryRowContext(ctx, tx.d.Migrations.Bind(query), args...)
+}
+
+func (tx sqlTx) insert(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	return sqlInsert(ctx, tx, tx.d, query, args...)
+}
+
+func (tx sqlTx) Commit() error {
+	return tx.tx.Commit()
+}
+
+func (tx sqlTx) Rollback() error {
+	return tx.tx.Rollback()
+}
+
+// sqlInsert runs an INSERT statement and returns the Id generated for the row
+func sqlInsert(ctx context.Context, q sqlQueryer, d SQLDialect, query string, args ...interface{}) (int64, error) {
+	var id int64
+	if d.returningID {
+		err := q.QueryRowContext(ctx, query+" RETURNING Id", args...).Scan(&id)
+		return id, err
+	}
+	r, err := q.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return r.LastInsertId()
+}
@@ -0,0 +1,131 @@
+package stores
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/Kirides/simpleApi/models"
+	"github.com/Kirides/simpleApi/stores/migrations"
+)
+
+// NewSQLiteMigrator creates the Migrator that creates and updates the tables of the Sqlite3 stores.
+// Databases created before migrations existed are brought up to date before the first migration, which then adopts their tables.
+func NewSQLiteMigrator(db *sql.DB) (*migrations.Migrator, error) {
+	return NewSQLMigrator(db, SQLiteDialect)
+}
+
+// adoptSQLiteSchema adds the columns that older versions added on startup to an existing Users table,
+// so the first migration finds the table it would have created
+func adoptSQLiteSchema(ctx context.Context, db *sql.DB) error {
+	var n int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'Users'").Scan(&n); err != nil {
+		return err
+	}
+	if n == 0 {
+		return nil
+	}
+	if err := addMissingColumnsSQLite(ctx, db, "Users",
+		"Role TEXT NOT NULL DEFAULT 'user'",
+		"DisplayName TEXT NOT NULL DEFAULT ''",
+		"Email TEXT NOT NULL DEFAULT ''",
+		"Locale TEXT NOT NULL DEFAULT ''",
+		"CreatedAt INTEGER NOT NULL DEFAULT 0",
+		"UpdatedAt INTEGER NOT NULL DEFAULT 0",
+		"Version INTEGER NOT NULL DEFAULT 1",
+		"Status TEXT NOT NULL DEFAULT 'active'",
+		"DeletedAt INTEGER NOT NULL DEFAULT 0",
+		"OrgID TEXT NOT NULL DEFAULT 'default'",
+		"Avatar TEXT NOT NULL DEFAULT ''",
+		"TokenGeneration INTEGER NOT NULL DEFAULT 0",
+		"NormalizedUsername TEXT",
+	); err != nil {
+		return err
+	}
+	return normalizeUsernamesSQLite(ctx, db)
+}
+
+// addMissingColumnsSQLite adds columns to tables created by older versions.
+// Every column is specified by its definition, which starts with its name.
+func addMissingColumnsSQLite(ctx context.Context, db *sql.DB, table string, columns ...string) error {
+	rows, err := db.QueryContext(ctx, "PRAGMA table_info("+table+")")
+	if err != nil {
+		return err
+	}
+	existing := map[string]bool{}
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, colType    string
+			defaultValue     sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			rows.Close()
+			return err
+		}
+		existing[strings.ToLower(name)] = true
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+	for _, c := range columns {
+		name := strings.ToLower(strings.Fields(c)[0])
+		if existing[name] {
+			continue
+		}
+		if _, err := db.ExecContext(ctx, "ALTER TABLE "+table+" ADD COLUMN "+c); err != nil {
+			return fmt.Errorf("Could not add column '%s' to '%s'. Error: %v", name, table, err)
+		}
+	}
+	return nil
+}
+
+// normalizeUsernamesSQLite fills in the normalized usernames of users created by older versions.
+// Users whose name is already used by another user keep none and can not sign in.
+func normalizeUsernamesSQLite(ctx context.Context, db *sql.DB) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	rows, err := tx.QueryContext(ctx, "SELECT Id, Username, NormalizedUsername FROM Users ORDER BY Id")
+	if err != nil {
+		return err
+	}
+	var (
+		taken   = map[string]string{}
+		pending []models.User
+	)
+	for rows.Next() {
+		var (
+			u          models.User
+			normalized sql.NullString
+		)
+		if err := rows.Scan(&u.ID, &u.Name, &normalized); err != nil {
+			rows.Close()
+			return err
+		}
+		if normalized.Valid {
+			taken[normalized.String] = u.ID
+		} else {
+			pending = append(pending, u)
+		}
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+	for _, u := range pending {
+		name := NormalizeUserName(u.Name)
+		if existing, ok := taken[name]; ok {
+			log.Printf("Username '%s' of user '%s' is already used by user '%s', it can not sign in", u.Name, u.ID, existing)
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE Users SET NormalizedUsername = ? WHERE Id = ?", name, u.ID); err != nil {
+			return fmt.Errorf("Could not normalize username of user '%s'. Error: %v", u.ID, err)
+		}
+		taken[name] = u.ID
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,48 @@
+package stores
+
+import (
+	"sort"
+	"time"
+
+	"github.com/Kirides/simpleApi/models"
+)
+
+// timeFromUnix converts unix seconds into a time, keeping 0 as the zero time
+func timeFromUnix(sec int64) time.Time {
+	if sec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(sec, 0).UTC()
+}
+
+// timeToUnix converts a time into unix seconds, keeping the zero time as 0
+func timeToUnix(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+// withInsertDefaults fills the fields every store sets when a user is inserted
+func withInsertDefaults(u models.User) models.User {
+	if u.Role == "" {
+		u.Role = models.RoleUser
+	}
+	if u.OrgID == "" {
+		u.OrgID = models.DefaultOrgID
+	}
+	if u.CreatedAt.IsZero() {
+		u.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	}
+	u.UpdatedAt = u.CreatedAt
+	if u.Status == "" {
+		u.Status = models.StatusActive
+	}
+	u.Version = 1
+	return u
+}
+
+// sortIDs sorts numeric ids by value
+func sortIDs(ids []string) {
+	sort.Slice(ids, func(i, j int) bool { return compareIDs(ids[i], ids[j]) < 0 })
+}
@@ -0,0 +1,15 @@
+package stores
+
+import (
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+var userNameFolder = cases.Fold()
+
+// NormalizeUserName returns the form usernames are compared in. Names that only differ in case
+// or in the Unicode representation of their characters (e.g. "ﬁ" and "fi") are the same.
+// Stores keep the name as it was entered and use the normalized form to look it up and to enforce uniqueness.
+func NormalizeUserName(name string) string {
+	return norm.NFKC.String(userNameFolder.String(norm.NFKC.String(name)))
+}
@@ -0,0 +1,252 @@
+package stores
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Kirides/simpleApi/models"
+)
+
+// Fields users can be sorted by
+const (
+	UserSortID          = "id"
+	UserSortName        = "username"
+	UserSortDisplayName = "display_name"
+	UserSortEmail       = "email"
+	UserSortCreatedAt   = "created_at"
+	UserSortUpdatedAt   = "updated_at"
+)
+
+// UserSortFields contains all fields that are allowed in UserQuery.SortBy
+var UserSortFields = []string{
+	UserSortID, UserSortName, UserSortDisplayName, UserSortEmail, UserSortCreatedAt, UserSortUpdatedAt,
+}
+
+// IsUserSortField reports whether field is allowed in UserQuery.SortBy
+func IsUserSortField(field string) bool {
+	return containsString(UserSortFields, field)
+}
+
+// UserQuery filters, sorts and pages users. Empty fields are ignored,
+// all string comparisons are case-insensitive.
+type UserQuery struct {
+	// NamePrefix only returns users whose name starts with it
+	NamePrefix string
+	// Email only returns users with exactly this email
+	Email string
+	// Role only returns users with this role
+	Role string
+	// OrgID only returns users of this organization
+	OrgID string
+	// Statuses only returns users with one of the statuses
+	Statuses []string
+	// CreatedFrom only returns users created at or after it
+	CreatedFrom time.Time
+	// CreatedUntil only returns users created before it
+	CreatedUntil time.Time
+	// Search only returns users whose name, display name or email contain it
+	Search string
+	// SortBy is one of UserSortFields, users are sorted by id if it is empty.
+	// Users with equal values are always sorted by id.
+	SortBy   string
+	SortDesc bool
+
+	// After only returns users that are sorted after the cursor
+	After *UserCursor
+	// Before only returns the last users that are sorted before the cursor
+	Before *UserCursor
+
+	// Offset is ignored if After or Before is set
+	Offset int64
+	Limit  int64
+}
+
+// UserCursor is a position in a sorted list of users, used for keyset pagination
+type UserCursor struct {
+	// Value is the value of the sort field of the user at the position, see UserSortKey.
+	// Text is kept as it is, so every store compares it the same way it compares its column.
+	Value string
+	ID    string
+}
+
+// NewUserCursor creates a cursor pointing at the user in a list sorted by field
+func NewUserCursor(field string, u models.User) *UserCursor {
+	return &UserCursor{
+		Value: UserSortKey(field, u),
+		ID:    u.ID,
+	}
+}
+
+// UserSortKey returns the value users are sorted by.
+// Times are returned as unix seconds, strings unchanged, they are compared ignoring case.
+func UserSortKey(field string, u models.User) string {
+	switch field {
+	case UserSortName:
+		return u.Name
+	case UserSortDisplayName:
+		return u.DisplayName
+	case UserSortEmail:
+		return u.Email
+	case UserSortCreatedAt:
+		return strconv.FormatInt(timeToUnix(u.CreatedAt), 10)
+	case UserSortUpdatedAt:
+		return strconv.FormatInt(timeToUnix(u.UpdatedAt), 10)
+	}
+	return u.ID
+}
+
+func isNumericUserSortField(field string) bool {
+	switch field {
+	case UserSortName, UserSortDisplayName, UserSortEmail:
+		return false
+	}
+	return true
+}
+
+// compareToCursor compares the position of u with the cursor, ignoring the sort direction
+func (q UserQuery) compareToCursor(u models.User, c *UserCursor) int {
+	cmp := compareSortKeys(q.SortBy, UserSortKey(q.SortBy, u), c.Value)
+	if cmp == 0 {
+		cmp = compareIDs(u.ID, c.ID)
+	}
+	if q.SortDesc {
+		return -cmp
+	}
+	return cmp
+}
+
+// Matches reports whether the user satisfies all filters of the query
+func (q UserQuery) Matches(u models.User) bool {
+	if q.NamePrefix != "" && !strings.HasPrefix(strings.ToLower(u.Name), strings.ToLower(q.NamePrefix)) {
+		return false
+	}
+	if q.Email != "" && !strings.EqualFold(u.Email, q.Email) {
+		return false
+	}
+	if q.Role != "" && u.Role != q.Role {
+		return false
+	}
+	if q.OrgID != "" && u.OrgID != q.OrgID {
+		return false
+	}
+	if len(q.Statuses) > 0 && !containsString(q.Statuses, u.Status) {
+		return false
+	}
+	if !q.CreatedFrom.IsZero() && u.CreatedAt.Before(q.CreatedFrom) {
+		return false
+	}
+	if !q.CreatedUntil.IsZero() && !u.CreatedAt.Before(q.CreatedUntil) {
+		return false
+	}
+	if q.Search != "" {
+		search := strings.ToLower(q.Search)
+		if !strings.Contains(strings.ToLower(u.Name), search) &&
+			!strings.Contains(strings.ToLower(u.DisplayName), search) &&
+			!strings.Contains(strings.ToLower(u.Email), search) {
+			return false
+		}
+	}
+	return true
+}
+
+// Count returns the amount of users matching the filters, ignoring cursors and paging
+func (q UserQuery) Count(users []models.User) int64 {
+	var n int64
+	for _, u := range users {
+		if q.Matches(u) {
+			n++
+		}
+	}
+	return n
+}
+
+// Apply filters, sorts and pages users in memory.
+// It is used by stores that can not query natively.
+func (q UserQuery) Apply(users []models.User) []models.User {
+	result := make([]models.User, 0, len(users))
+	for _, u := range users {
+		if !q.Matches(u) {
+			continue
+		}
+		if q.After != nil && q.compareToCursor(u, q.After) <= 0 {
+			continue
+		}
+		if q.Before != nil && q.compareToCursor(u, q.Before) >= 0 {
+			continue
+		}
+		result = append(result, u)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return q.Less(result[i], result[j])
+	})
+	if q.Before != nil {
+		// the page directly in front of the cursor
+		if q.Limit >= 0 && q.Limit < int64(len(result)) {
+			result = result[int64(len(result))-q.Limit:]
+		}
+		return result
+	}
+	if q.After == nil {
+		if q.Offset >= int64(len(result)) {
+			return []models.User{}
+		}
+		result = result[q.Offset:]
+	}
+	if q.Limit >= 0 && q.Limit < int64(len(result)) {
+		result = result[:q.Limit]
+	}
+	return result
+}
+
+// Less reports whether a is sorted before b
+func (q UserQuery) Less(a, b models.User) bool {
+	c := compareSortKeys(q.SortBy, UserSortKey(q.SortBy, a), UserSortKey(q.SortBy, b))
+	if c == 0 {
+		c = compareIDs(a.ID, b.ID)
+	}
+	if q.SortDesc {
+		return c > 0
+	}
+	return c < 0
+}
+
+// compareSortKeys compares numbers by their value and text ignoring case,
+// in the same order as the index of the usernames of the BoltDB store
+func compareSortKeys(field string, a, b string) int {
+	if isNumericUserSortField(field) {
+		return compareNumeric(a, b)
+	}
+	return strings.Compare(NormalizeUserName(a), NormalizeUserName(b))
+}
+
+// compareIDs compares numeric ids by their value
+func compareIDs(a, b string) int {
+	return compareNumeric(a, b)
+}
+
+// compareNumeric compares strings of unsigned integers by their value
+func compareNumeric(a, b string) int {
+	ai, errA := strconv.ParseUint(a, 10, 64)
+	bi, errB := strconv.ParseUint(b, 10, 64)
+	if errA != nil || errB != nil {
+		return strings.Compare(a, b)
+	}
+	switch {
+	case ai < bi:
+		return -1
+	case ai > bi:
+		return 1
+	}
+	return 0
+}
+
+func containsString(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
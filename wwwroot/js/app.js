@@ -41,10 +41,9 @@ const register_component = {
             },
             password: {
                 value: '',
-                valid() {
-                    return this.value.length > 5;
-                },
-                error: 'Password must be atleast 6 characters long'
+                // replaced by the policy of the server, see created()
+                policy: { min_length: 1, max_length: 0, disallow_username: false },
+                error: ''
             },
             password2: {
                 value: '',
@@ -56,6 +55,7 @@ const register_component = {
                 error: 'Email must be like \'myemail@provider.com\''
             },
             errors: {
+                request: false,
                 password: false,
                 password2: false,
                 username: false,
@@ -68,6 +68,7 @@ const register_component = {
     <div class="row">
         <div class="col-md-6 col-lg-4">
             <h4>Create a new account.</h4>
+            <div v-if="errors.request && errors.request !== ''" class="alert alert-danger" role="alert">{{errors.request}}</div>
             <div class="form-group">
                 <label>Username</label>
                 <input required v-model="username.value" class="form-control" />
@@ -92,6 +93,15 @@ const register_component = {
         </div>
     </div>
 </div>`,
+    created() {
+        const vm = this;
+        // the server validates passwords anyway, without the policy its error is shown after submitting
+        this.$http.get('/account/password-policy')
+            .then((resp) => {
+                vm.password.policy = resp.data;
+            })
+            .catch(() => {});
+    },
     methods: {
         validate_username() {
             return !(this.errors.username = !(new RegExp(this.username.pattern).test(this.username.value)));
@@ -100,7 +110,19 @@ const register_component = {
             return !(this.errors.email = !(new RegExp(this.email.pattern).test(this.email.value)));
         },
         validate_password() {
-            return !(this.errors.password = !this.password.valid());
+            const policy = this.password.policy;
+            const value = this.password.value;
+            let error = '';
+            if ([...value].length < policy.min_length) {
+                error = 'Password must be at least ' + policy.min_length + ' characters long';
+            } else if (policy.max_length > 0 && new TextEncoder().encode(value).length > policy.max_length) {
+                error = 'Password must not be longer than ' + policy.max_length + ' bytes';
+            } else if (policy.disallow_username && this.username.value !== '' &&
+                value.toLowerCase().includes(this.username.value.toLowerCase())) {
+                error = 'Password must not contain the username';
+            }
+            this.password.error = error;
+            return !(this.errors.password = error !== '');
         },
         validate_password2() {
             return !(this.errors.password2 = (this.password.value !== this.password2.value));
@@ -114,9 +136,12 @@ const register_component = {
                     password: this.password.value,
                     email: this.email.value
                 };
+                const vm = this;
                 this.$signInManager.Register(payload)
                     .then(() => {})
-                    .catch(() => {});
+                    .catch((err) => {
+                        vm.errors.request = err.response.data;
+                    });
             }
         }
     }
@@ -206,6 +231,163 @@ const logout_component = {
     }
 };
 
+const manage_component = {
+    data() {
+        return {
+            user: null,
+            sessions: [],
+            file: null,
+            password: '',
+            errors: {
+                request: false
+            }
+        };
+    },
+    template: `<div>
+    <h2>Settings</h2>
+    <div class="row" v-if="user">
+        <div class="col-md-6 col-lg-4">
+            <h4>Profile picture</h4>
+            <hr />
+            <div v-if="errors.request && errors.request !== ''" class="alert alert-danger" role="alert">{{errors.request}}</div>
+            <p>
+                <img v-if="user.avatar_url" :src="user.avatar_url + '?size=128'" width="128" height="128" class="rounded" alt="Profile picture" />
+                <span v-else class="text-muted">No profile picture set</span>
+            </p>
+            <div class="form-group">
+                <input type="file" accept="image/jpeg,image/png,image/gif" class="form-control-file" @change="file = $event.target.files[0]" />
+            </div>
+            <button class="btn btn-default" :disabled="!file" @click="upload_avatar">Upload</button>
+            <button v-if="user.avatar_url" class="btn btn-link text-danger" @click="remove_avatar">Remove</button>
+        </div>
+        <div class="col-md-6 col-lg-4">
+            <h4>Personal data</h4>
+            <hr />
+            <p>
+                <button class="btn btn-default" @click="export_data">Download my data</button>
+            </p>
+            <div class="form-group">
+                <label>Password</label>
+                <input v-model="password" type="password" class="form-control" />
+            </div>
+            <button class="btn btn-danger" :disabled="!password" @click="delete_account">Delete my account</button>
+        </div>
+        <div class="col-md-12 col-lg-4">
+            <h4>Sessions</h4>
+            <hr />
+            <ul class="list-group">
+                <li v-for="s in sessions" :key="s.id" class="list-group-item">
+                    <strong>{{s.device}}</strong>
+                    <span v-if="s.current" class="badge badge-success">This device</span>
+                    <button v-else class="btn btn-link btn-sm text-danger float-right" @click="revoke_session(s)">Sign out</button>
+                    <br />
+                    <small class="text-muted">{{s.ip}}, last seen {{new Date(s.last_seen_at).toLocaleString()}}</small>
+                </li>
+            </ul>
+            <button class="btn btn-default mt-2" :disabled="sessions.length < 2" @click="revoke_other_sessions">Sign out everywhere else</button>
+        </div>
+    </div>
+</div>`,
+    created() {
+        const vm = this;
+        this.$http.get('/api/users/me', vm.auth())
+            .then((res) => {
+                vm.user = res.data;
+            })
+            .catch((err) => {
+                vm.errors.request = err.response.data;
+            });
+        this.load_sessions();
+    },
+    methods: {
+        auth() {
+            return {
+                headers: {
+                    'Authorization': 'Bearer ' + this.$signInManager.GetToken()
+                }
+            };
+        },
+        upload_avatar() {
+            const vm = this;
+            const form = new FormData();
+            form.append('avatar', vm.file);
+            this.$http.put('/api/users/me/avatar', form, vm.auth())
+                .then((res) => {
+                    vm.user = res.data;
+                    vm.errors.request = false;
+                })
+                .catch((err) => {
+                    vm.errors.request = err.response.data;
+                });
+        },
+        export_data() {
+            const vm = this;
+            const config = vm.auth();
+            config.responseType = 'blob';
+            this.$http.get('/api/users/me/export', config)
+                .then((res) => {
+                    const link = document.createElement('a');
+                    link.href = URL.createObjectURL(res.data);
+                    link.download = vm.user.username + '.zip';
+                    link.click();
+                    URL.revokeObjectURL(link.href);
+                })
+                .catch((err) => {
+                    vm.errors.request = err.response.data;
+                });
+        },
+        delete_account() {
+            const vm = this;
+            const config = vm.auth();
+            config.data = {
+                password: vm.password
+            };
+            this.$http.delete('/api/users/me', config)
+                .then(() => vm.$router.push('/account/logout'))
+                .catch((err) => {
+                    vm.errors.request = err.response.data;
+                });
+        },
+        load_sessions() {
+            const vm = this;
+            this.$http.get('/api/users/me/sessions', vm.auth())
+                .then((res) => {
+                    vm.sessions = res.data;
+                })
+                .catch(() => {
+                    vm.sessions = [];
+                });
+        },
+        revoke_session(session) {
+            const vm = this;
+            this.$http.delete('/api/users/me/sessions/' + encodeURIComponent(session.id), vm.auth())
+                .then(() => vm.load_sessions())
+                .catch((err) => {
+                    vm.errors.request = err.response.data;
+                });
+        },
+        revoke_other_sessions() {
+            const vm = this;
+            this.$http.delete('/api/users/me/sessions', vm.auth())
+                .then(() => vm.load_sessions())
+                .catch((err) => {
+                    vm.errors.request = err.response.data;
+                });
+        },
+        remove_avatar() {
+            const vm = this;
+            this.$http.delete('/api/users/me/avatar', vm.auth())
+                .then(() => {
+                    vm.user.avatar_url = '';
+                    vm.errors.request = false;
+                })
+                .catch((err) => {
+                    vm.errors.request = err.response.data;
+                });
+        }
+    }
+};
+
 const home_component = {
     props: ['authenticated'],
     template: `<div>
@@ -227,6 +409,9 @@ const routes = [{
 }, {
     path: '/account/logout',
     component: logout_component
+}, {
+    path: '/account/manage',
+    component: manage_component
 }];
 const router = new VueRouter({
     routes
@@ -240,7 +425,7 @@ class SignInManager {
     SignIn(username, password, remember) {
         const sim = this;
         return new Promise((res, rej) => {
-            if (username.length > 1 && password.length > 5) {
+            if (username.length > 1 && password.length > 0) {
                 const payload = {
                     username,
                     password,